@@ -5,6 +5,7 @@ import (
 
 	"connectrpc.com/connect"
 	"github.com/n-creativesystem/go-packages/lib/interceptors/auth"
+	"github.com/n-creativesystem/go-packages/lib/logging"
 )
 
 type authenticate[T any] struct {
@@ -62,5 +63,9 @@ func (a *authenticate[T]) authFunc(ctx context.Context, getter auth.Getter) (con
 	if err != nil {
 		return nil, auth.ErrUnAuthorization
 	}
-	return auth.SetContext(ctx, tokenInfo), nil
+	ctx = auth.SetContext(ctx, tokenInfo)
+	if v, ok := any(tokenInfo).(auth.Loggable); ok {
+		ctx = logging.AppendCtx(ctx, v.LogAttrs()...)
+	}
+	return ctx, nil
 }
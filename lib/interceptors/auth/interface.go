@@ -1,6 +1,9 @@
 package auth
 
-import "context"
+import (
+	"context"
+	"log/slog"
+)
 
 type Getter interface {
 	Get(string) string
@@ -9,3 +12,8 @@ type Getter interface {
 type Validator[T any] interface {
 	Execute(ctx context.Context, getter Getter) (*T, error)
 }
+
+// Loggable を実装した認証情報は、認証後にlogging.AppendCtxでログの属性としてコンテキストに追加される
+type Loggable interface {
+	LogAttrs() []slog.Attr
+}
@@ -3,11 +3,13 @@ package interceptors
 import (
 	"context"
 	"errors"
+	"log/slog"
 	"net/http"
 	"testing"
 
 	"connectrpc.com/connect"
 	"github.com/n-creativesystem/go-packages/lib/interceptors/auth"
+	"github.com/n-creativesystem/go-packages/lib/logging"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -40,6 +42,10 @@ type mockTokenInfo struct {
 	UserID string
 }
 
+func (m *mockTokenInfo) LogAttrs() []slog.Attr {
+	return []slog.Attr{slog.String("user-id", m.UserID)}
+}
+
 func (m *mockValidator) Execute(ctx context.Context, getter auth.Getter) (*mockTokenInfo, error) {
 	if m.shouldError {
 		return nil, errors.New("validation failed")
@@ -94,6 +100,8 @@ func TestAuthenticate_WrapUnary(t *testing.T) {
 				tokenInfo, ok := auth.AuthFromContext[mockTokenInfo](ctx)
 				require.True(t, ok)
 				assert.Equal(t, "test-user", tokenInfo.UserID)
+				// 認証情報がログの属性としてコンテキストに追加される / Auth info is added to the context as log attributes
+				assert.Equal(t, []slog.Attr{slog.String("user-id", "test-user")}, logging.AttrsFromContext(ctx))
 			},
 		},
 		{
@@ -9,6 +9,7 @@ import (
 
 	"connectrpc.com/connect"
 	"github.com/google/uuid"
+	"github.com/n-creativesystem/go-packages/lib/logging"
 )
 
 type loggingIntercept struct{}
@@ -25,28 +26,37 @@ func (l *loggingIntercept) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
 	return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
 		requestId := getRequestId(request.Header())
 		requestIdWith := slog.String("request-id", requestId)
+		// logging.SetDefaultやコンテキストで設定されたロガーにリクエストIDを付与する
+		base := logging.FromContext(ctx).With(requestIdWith)
+		// インターセプターのログは "interceptors" のレベルの上書きに従う
+		logger := logging.Named(base, "interceptors")
+		// 後続の処理はlogging.FromContextでリクエストIDを持つロガーを使える
+		// logging.ContextHandlerを使っていればコンテキストだけでもリクエストIDが付与される
+		// Sentryのパンくずとフライトレコーダーのレコードはリクエスト毎のスコープに記録する
+		ctx = logging.WithContext(logging.AppendCtx(logging.WithFlightRecorderScope(logging.WithSentryScope(ctx)), requestIdWith), base)
+		// エラーにならなかったリクエストのDEBUGのレコードはNewFlightRecorderHandlerから破棄する
+		defer logging.DiscardFlightRecords(ctx)
 		start := time.Now()
 		requestWith := []any{
-			requestIdWith,
 			slog.Time("request-time", start),
 		}
-		slog.With(requestWith...).Info(fmt.Sprintf("request calling: %s", request.Spec().Procedure))
-		slog.Debug(fmt.Sprintf("request body: %v", request.Any()))
+		logger.With(requestWith...).InfoContext(ctx, fmt.Sprintf("request calling: %s", request.Spec().Procedure))
+		// ボディはNewRedactHandlerでマスクできるよう属性として出力する
+		logger.DebugContext(ctx, "request body", slog.Any("body", request.Any()))
 		response, err := next(ctx, request)
 		end := time.Now()
 		latency := end.Sub(start)
 		responseWith := []any{
-			requestIdWith,
 			slog.Time("response-time", end),
 			slog.String("latency", secToTime(latency)),
 		}
 		if err != nil {
 			with := append(requestWith, responseWith...)
-			slog.With(with...).ErrorContext(ctx, fmt.Errorf("error %w", err).Error())
+			logger.With(with...).ErrorContext(ctx, fmt.Errorf("error %w", err).Error())
 		} else {
-			slog.Debug(fmt.Sprintf("response body: %v", response.Any()))
+			logger.DebugContext(ctx, "response body", slog.Any("body", response.Any()))
 		}
-		slog.With(responseWith...).Info(fmt.Sprintf("response calling: %s", request.Spec().Procedure))
+		logger.With(responseWith...).InfoContext(ctx, fmt.Sprintf("response calling: %s", request.Spec().Procedure))
 		return response, err
 	}
 }
@@ -59,25 +69,27 @@ func (l *loggingIntercept) WrapStreamingHandler(next connect.StreamingHandlerFun
 	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
 		requestId := getRequestId(conn.RequestHeader())
 		requestIdWith := slog.String("request-id", requestId)
+		base := logging.FromContext(ctx).With(requestIdWith)
+		logger := logging.Named(base, "interceptors")
+		ctx = logging.WithContext(logging.AppendCtx(logging.WithFlightRecorderScope(logging.WithSentryScope(ctx)), requestIdWith), base)
+		defer logging.DiscardFlightRecords(ctx)
 		start := time.Now()
 		requestWith := []any{
-			requestIdWith,
 			slog.Time("request-time", start),
 		}
-		slog.With(requestWith...).Info(fmt.Sprintf("request calling: %s", conn.Spec().Procedure))
+		logger.With(requestWith...).InfoContext(ctx, fmt.Sprintf("request calling: %s", conn.Spec().Procedure))
 		err := next(ctx, conn)
 		end := time.Now()
 		latency := end.Sub(start)
 		responseWith := []any{
-			requestIdWith,
 			slog.Time("response-time", end),
 			slog.String("latency", secToTime(latency)),
 		}
 		if err != nil {
 			with := append(requestWith, responseWith...)
-			slog.With(with...).ErrorContext(ctx, fmt.Errorf("error %w", err).Error())
+			logger.With(with...).ErrorContext(ctx, fmt.Errorf("error %w", err).Error())
 		}
-		slog.With(responseWith...).Info(fmt.Sprintf("response calling: %s", conn.Spec().Procedure))
+		logger.With(responseWith...).InfoContext(ctx, fmt.Sprintf("response calling: %s", conn.Spec().Procedure))
 		return err
 	}
 }
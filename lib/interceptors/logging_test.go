@@ -2,13 +2,18 @@ package interceptors
 
 import (
 	"context"
+	"errors"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"testing"
 	"time"
 
 	"connectrpc.com/connect"
 	"github.com/google/uuid"
+	"github.com/n-creativesystem/go-packages/lib/logging"
+	"github.com/n-creativesystem/go-packages/lib/logging/logtest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -78,6 +83,170 @@ func TestLoggingIntercept_WrapStreamingHandler(t *testing.T) {
 	require.NoError(t, err, "エラーが発生してはならない")
 }
 
+// setDefaultLogger はテストの間だけlogging.Defaultのロガーをhにする
+func setDefaultLogger(t *testing.T, h logging.Handle) {
+	t.Helper()
+	origLogger := logging.Default()
+	t.Cleanup(func() {
+		logging.SetDefault(logging.NewHandler(origLogger.Handler()))
+	})
+	logging.SetDefault(h)
+}
+
+func TestLoggingIntercept_RedactBody(t *testing.T) {
+	h := logtest.New(logtest.WithLevel(slog.LevelDebug))
+	setDefaultLogger(t, logging.NewRedactHandler(h))
+
+	type body struct {
+		Name     string
+		Password string
+	}
+	handler := func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		return connect.NewResponse(&body{Name: "response", Password: "response-secret"}), nil
+	}
+	req := connect.NewRequest(&body{Name: "request", Password: "request-secret"})
+	req.Header().Set("x-request-id", "test-request-id")
+
+	_, err := NewLoggingInterceptor().WrapUnary(handler)(context.Background(), req)
+	require.NoError(t, err)
+
+	// ボディは属性として出力され、パスワードはマスクされる
+	h.AssertLogged(t, logtest.Message("request body"), logtest.HasAttr("body.Name", "request"), logtest.HasAttr("body.Password", "********"))
+	h.AssertLogged(t, logtest.Message("response body"), logtest.HasAttr("body.Name", "response"), logtest.HasAttr("body.Password", "********"))
+	h.AssertNotLogged(t, logtest.HasAttr("body.Password", "request-secret"))
+	h.AssertNotLogged(t, logtest.HasAttr("body.Password", "response-secret"))
+}
+
+func TestLoggingIntercept_ContextLogger(t *testing.T) {
+	h := logtest.New()
+	setDefaultLogger(t, h)
+
+	// 後続の処理でコンテキストのロガーを使うとリクエストIDが付与される
+	handler := func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		logging.InfoContext(ctx, "in handler")
+		return connect.NewResponse(&struct{}{}), nil
+	}
+	req := connect.NewRequest(&struct{}{})
+	req.Header().Set("x-request-id", "test-request-id")
+	_, err := NewLoggingInterceptor().WrapUnary(handler)(context.Background(), req)
+	require.NoError(t, err)
+	h.AssertLogged(t, logtest.Message("in handler"), logtest.HasAttr("request-id", "test-request-id"))
+
+	h.Reset()
+	streamHandler := func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		logging.InfoContext(ctx, "in stream handler")
+		return nil
+	}
+	header := http.Header{}
+	header.Set("x-request-id", "test-streaming-id")
+	conn := &mockStreamingConn{header: header, trailer: http.Header{}}
+	require.NoError(t, NewLoggingInterceptor().WrapStreamingHandler(streamHandler)(context.Background(), conn))
+	h.AssertLogged(t, logtest.Message("in stream handler"), logtest.HasAttr("request-id", "test-streaming-id"))
+}
+
+func TestLoggingIntercept_BaseLogger(t *testing.T) {
+	h := logtest.New()
+	setDefaultLogger(t, h)
+	origLogger := slog.Default()
+	defer slog.SetDefault(origLogger)
+	other := logtest.New()
+	slog.SetDefault(other.Logger())
+
+	handler := func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		return connect.NewResponse(&struct{}{}), nil
+	}
+	req := connect.NewRequest(&struct{}{})
+	req.Header().Set("x-request-id", "test-request-id")
+
+	// slog.Defaultではなくlogging.Defaultに出力する
+	_, err := NewLoggingInterceptor().WrapUnary(handler)(context.Background(), req)
+	require.NoError(t, err)
+	h.AssertLogged(t, logtest.MessageMatches("^request calling"), logtest.HasAttr("request-id", "test-request-id"))
+	other.AssertNotLogged(t)
+
+	// コンテキストのロガーがあればそれを使う
+	h.Reset()
+	ctxLogger := logtest.New()
+	ctx := logging.WithContext(context.Background(), ctxLogger.Logger().With(slog.String("tenant", "t1")))
+	_, err = NewLoggingInterceptor().WrapUnary(handler)(ctx, req)
+	require.NoError(t, err)
+	ctxLogger.AssertLogged(t, logtest.MessageMatches("^request calling"), logtest.HasAttr("tenant", "t1"), logtest.HasAttr("request-id", "test-request-id"))
+	h.AssertNotLogged(t)
+
+	header := http.Header{}
+	header.Set("x-request-id", "test-streaming-id")
+	conn := &mockStreamingConn{header: header, trailer: http.Header{}}
+	streamHandler := func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		return nil
+	}
+	require.NoError(t, NewLoggingInterceptor().WrapStreamingHandler(streamHandler)(ctx, conn))
+	ctxLogger.AssertLogged(t, logtest.MessageMatches("^response calling"), logtest.HasAttr("tenant", "t1"), logtest.HasAttr("request-id", "test-streaming-id"))
+}
+
+func TestLoggingIntercept_FlightRecorder(t *testing.T) {
+	capture := logtest.New(logtest.WithLevel(slog.LevelInfo))
+	h := logging.NewFlightRecorderHandler(capture)
+	defer h.Close()
+	setDefaultLogger(t, h)
+
+	var handlerErr error
+	handler := func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		logging.DebugContext(ctx, "in handler")
+		return connect.NewResponse(&struct{}{}), handlerErr
+	}
+	call := func(id string) {
+		req := connect.NewRequest(&struct{}{})
+		req.Header().Set("x-request-id", id)
+		_, _ = NewLoggingInterceptor().WrapUnary(handler)(context.Background(), req)
+	}
+
+	// 正常に終わったリクエストのDEBUGのレコードは出力しない
+	call("ok-request-id")
+	capture.AssertNotLogged(t, logtest.AtLevel(slog.LevelDebug))
+	// 終わったリクエストのレコードは保持しない
+	logging.ErrorContext(logging.AppendCtx(context.Background(), slog.String("request-id", "ok-request-id")), "after request")
+	capture.AssertNotLogged(t, logtest.AtLevel(slog.LevelDebug))
+
+	// エラーになったリクエストはDEBUGのレコードをエラーの前に出力する
+	capture.Reset()
+	handlerErr = connect.NewError(connect.CodeInternal, errors.New("boom"))
+	call("error-request-id")
+	capture.AssertLogged(t, logtest.AtLevel(slog.LevelDebug), logtest.Message("request body"))
+	capture.AssertLogged(t, logtest.AtLevel(slog.LevelDebug), logtest.Message("in handler"), logtest.HasAttr("request-id", "error-request-id"))
+	messages := make([]string, 0, len(capture.Records()))
+	for _, r := range capture.Records() {
+		messages = append(messages, r.Message)
+	}
+	errorIndex := slices.IndexFunc(capture.Records(), func(r logtest.Record) bool {
+		return r.Level == slog.LevelError
+	})
+	assert.Less(t, slices.Index(messages, "in handler"), errorIndex)
+}
+
+func TestLoggingIntercept_NamedLevel(t *testing.T) {
+	h := logtest.New(logtest.WithLevel(logging.DefaultLevel()))
+	setDefaultLogger(t, h)
+	level := logging.DefaultLevel()
+	origLevel := level.Level()
+	defer level.Set(origLevel)
+	defer level.DeleteOverride("interceptors")
+	level.Set(slog.LevelInfo)
+	level.SetOverride("interceptors", slog.LevelDebug)
+
+	handler := func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		logging.FromContext(ctx).DebugContext(ctx, "in handler")
+		return connect.NewResponse(&struct{}{}), nil
+	}
+	req := connect.NewRequest(&struct{}{})
+	req.Header().Set("x-request-id", "test-request-id")
+	_, err := NewLoggingInterceptor().WrapUnary(handler)(context.Background(), req)
+	require.NoError(t, err)
+
+	// インターセプターのログだけ "interceptors" の上書きのレベルで出力する
+	h.AssertLogged(t, logtest.AtLevel(slog.LevelDebug), logtest.Message("request body"))
+	h.AssertNotLogged(t, logtest.Message("in handler"))
+}
+
 func TestGetRequestId(t *testing.T) {
 	t.Run("ヘッダーにリクエストIDが含まれる場合", func(t *testing.T) {
 		header := http.Header{}
@@ -2,45 +2,290 @@ package logging
 
 import (
 	"context"
+	"errors"
 	"io"
 	"log/slog"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// OverflowPolicy はキューが満杯のときの振る舞い
+type OverflowPolicy int
+
+const (
+	// OverflowDropNewest は新しいレコードを破棄する
+	OverflowDropNewest OverflowPolicy = iota
+	// OverflowDropOldest はキューの最も古いレコードを破棄して新しいレコードを積む
+	OverflowDropOldest
+	// OverflowBlock は空きができるまで呼び出し元をブロックする
+	OverflowBlock
+	// OverflowDropBelowLevel は閾値未満のレコードを破棄し、閾値以上のレコードはブロックして積む
+	OverflowDropBelowLevel
+)
+
+var (
+	ErrAsyncCloseTimeout = errors.New("logging: async handler close timed out")
+)
+
+type AsyncOption interface {
+	apply(opt *asyncOption)
+}
+
+type asyncOptionFn func(opt *asyncOption)
+
+func (fn asyncOptionFn) apply(opt *asyncOption) {
+	fn(opt)
+}
+
+type asyncOption struct {
+	queueSize    int
+	workers      int
+	overflow     OverflowPolicy
+	dropLevel    slog.Level
+	closeTimeout time.Duration
+}
+
+var (
+	defaultAsyncOption = asyncOption{
+		queueSize:    1024,
+		workers:      1,
+		overflow:     OverflowDropNewest,
+		dropLevel:    slog.LevelError,
+		closeTimeout: 5 * time.Second,
+	}
+)
+
+func WithQueueSize(size int) AsyncOption {
+	return asyncOptionFn(func(opt *asyncOption) {
+		if size > 0 {
+			opt.queueSize = size
+		}
+	})
+}
+
+// WithWorkers はワーカー数を指定する。2以上の場合はレコードの順序は保証されない
+func WithWorkers(n int) AsyncOption {
+	return asyncOptionFn(func(opt *asyncOption) {
+		if n > 0 {
+			opt.workers = n
+		}
+	})
+}
+
+func WithOverflow(policy OverflowPolicy) AsyncOption {
+	return asyncOptionFn(func(opt *asyncOption) {
+		opt.overflow = policy
+	})
+}
+
+func WithDropBelowLevel(level slog.Level) AsyncOption {
+	return asyncOptionFn(func(opt *asyncOption) {
+		opt.overflow = OverflowDropBelowLevel
+		opt.dropLevel = level
+	})
+}
+
+func WithCloseTimeout(timeout time.Duration) AsyncOption {
+	return asyncOptionFn(func(opt *asyncOption) {
+		opt.closeTimeout = timeout
+	})
+}
+
 type AsyncHandler struct {
 	slog.Handler
-	sync sync.WaitGroup
+	queue *asyncQueue
 }
 
 var (
 	_ Handle = (*AsyncHandler)(nil)
 )
 
-func NewAsyncHandler(h slog.Handler) slog.Handler {
-	return &AsyncHandler{Handler: h}
+// NewAsyncHandler はリングバッファと固定数のワーカーでレコードを非同期に処理する
+// WithAttrs/WithGroupで派生したハンドラーは同じキューとワーカーを共有する
+func NewAsyncHandler(h slog.Handler, opts ...AsyncOption) slog.Handler {
+	o := defaultAsyncOption
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+	q := &asyncQueue{
+		option: o,
+		buf:    make([]asyncEntry, o.queueSize),
+		done:   make(chan struct{}),
+		inner:  h,
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	q.start()
+	return &AsyncHandler{Handler: h, queue: q}
 }
 
+// Handle はレコードを複製してキューに積む
+// 呼び出し元の処理が終わってもキャンセルされないよう、コンテキストはキャンセルから切り離す
 func (h *AsyncHandler) Handle(ctx context.Context, r slog.Record) error {
-	h.sync.Add(1)
-	go func() {
-		defer h.sync.Done()
-		_ = h.Handler.Handle(ctx, r)
-	}()
+	h.queue.push(asyncEntry{handler: h.Handler, ctx: context.WithoutCancel(ctx), record: r.Clone()})
 	return nil
 }
 
 func (h *AsyncHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	return NewAsyncHandler(h.Handler.WithAttrs(attrs))
+	return &AsyncHandler{Handler: h.Handler.WithAttrs(attrs), queue: h.queue}
 }
 
 func (h *AsyncHandler) WithGroup(name string) slog.Handler {
-	return NewAsyncHandler(h.Handler.WithGroup(name))
+	return &AsyncHandler{Handler: h.Handler.WithGroup(name), queue: h.queue}
+}
+
+// Dropped はキューが溢れたことで破棄されたレコード数を返す
+func (h *AsyncHandler) Dropped() uint64 {
+	return h.queue.dropped.Load()
 }
 
+// Close はキューに残ったレコードを処理し終えるまで待つ
+// 待機時間がWithCloseTimeoutを超えた場合、残りのレコードは破棄してDroppedに数え、ErrAsyncCloseTimeoutを返す
+// そのときラップしたハンドラーは処理中のワーカーが終わってから閉じる
 func (h *AsyncHandler) Close() error {
-	h.sync.Wait()
-	if v, ok := h.Handler.(io.Closer); ok {
-		return v.Close()
+	return h.queue.close()
+}
+
+type asyncEntry struct {
+	handler slog.Handler
+	ctx     context.Context
+	record  slog.Record
+}
+
+type asyncQueue struct {
+	option asyncOption
+	inner  slog.Handler
+
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	buf      []asyncEntry
+	head     int
+	size     int
+	closed   bool
+
+	dropped   atomic.Uint64
+	wg        sync.WaitGroup
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func (q *asyncQueue) start() {
+	q.wg.Add(q.option.workers)
+	for range q.option.workers {
+		go q.work()
 	}
-	return nil
+	go func() {
+		q.wg.Wait()
+		close(q.done)
+	}()
+}
+
+func (q *asyncQueue) work() {
+	defer q.wg.Done()
+	for {
+		entry, ok := q.pop()
+		if !ok {
+			return
+		}
+		_ = entry.handler.Handle(entry.ctx, entry.record)
+	}
+}
+
+func (q *asyncQueue) push(entry asyncEntry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for !q.closed && q.size == len(q.buf) {
+		switch q.option.overflow {
+		case OverflowDropNewest:
+			q.dropped.Add(1)
+			return
+		case OverflowDropOldest:
+			q.buf[q.head] = asyncEntry{}
+			q.head = (q.head + 1) % len(q.buf)
+			q.size--
+			q.dropped.Add(1)
+		case OverflowDropBelowLevel:
+			if entry.record.Level < q.option.dropLevel {
+				q.dropped.Add(1)
+				return
+			}
+			q.notFull.Wait()
+		default:
+			q.notFull.Wait()
+		}
+	}
+	if q.closed {
+		q.dropped.Add(1)
+		return
+	}
+	q.buf[(q.head+q.size)%len(q.buf)] = entry
+	q.size++
+	q.notEmpty.Signal()
+}
+
+func (q *asyncQueue) pop() (asyncEntry, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.size == 0 {
+		if q.closed {
+			return asyncEntry{}, false
+		}
+		q.notEmpty.Wait()
+	}
+	entry := q.buf[q.head]
+	q.buf[q.head] = asyncEntry{}
+	q.head = (q.head + 1) % len(q.buf)
+	q.size--
+	q.notFull.Signal()
+	return entry, true
+}
+
+func (q *asyncQueue) discard() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.size > 0 {
+		q.buf[q.head] = asyncEntry{}
+		q.head = (q.head + 1) % len(q.buf)
+		q.size--
+		q.dropped.Add(1)
+	}
+}
+
+func (q *asyncQueue) close() error {
+	q.closeOnce.Do(func() {
+		q.mu.Lock()
+		q.closed = true
+		q.notEmpty.Broadcast()
+		q.notFull.Broadcast()
+		q.mu.Unlock()
+
+		var timeout <-chan time.Time
+		if q.option.closeTimeout > 0 {
+			timer := time.NewTimer(q.option.closeTimeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		v, ok := q.inner.(io.Closer)
+		select {
+		case <-q.done:
+		case <-timeout:
+			q.discard()
+			q.closeErr = ErrAsyncCloseTimeout
+			// ワーカーが処理中のハンドラーを閉じないよう、ワーカーが終わるのを待ってから閉じる
+			if ok {
+				go func() {
+					<-q.done
+					_ = v.Close()
+				}()
+			}
+			return
+		}
+		if ok {
+			q.closeErr = errors.Join(q.closeErr, v.Close())
+		}
+	})
+	return q.closeErr
 }
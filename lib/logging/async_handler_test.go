@@ -0,0 +1,258 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// 最初のレコードでブロックし、レコードを記録するハンドラー
+type blockingHandler struct {
+	mu       sync.Mutex
+	messages []string
+	started  chan struct{}
+	release  chan struct{}
+	once     sync.Once
+	closed   bool
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+}
+
+func (h *blockingHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *blockingHandler) Handle(_ context.Context, r slog.Record) error {
+	h.once.Do(func() {
+		close(h.started)
+		<-h.release
+	})
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.messages = append(h.messages, r.Message)
+	return nil
+}
+
+func (h *blockingHandler) WithAttrs([]slog.Attr) slog.Handler {
+	return h
+}
+
+func (h *blockingHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+func (h *blockingHandler) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	return nil
+}
+
+func (h *blockingHandler) Closed() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.closed
+}
+
+func (h *blockingHandler) Messages() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.messages...)
+}
+
+func newTestRecord(level slog.Level, msg string) slog.Record {
+	return slog.NewRecord(time.Now(), level, msg, 0)
+}
+
+func TestAsyncHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	h := NewAsyncHandler(NewTextHandler(WithWriter(buf))).(*AsyncHandler)
+	log := slog.New(h)
+	for range 10 {
+		log.Info("async message")
+	}
+	require.NoError(t, h.Close())
+	require.Equal(t, 10, bytes.Count(buf.Bytes(), []byte("async message")))
+	require.Zero(t, h.Dropped())
+}
+
+func TestAsyncHandlerOverflow(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []AsyncOption
+		records  []slog.Record
+		expected []string
+		dropped  uint64
+	}{
+		{
+			name: "drop newest",
+			opts: []AsyncOption{WithOverflow(OverflowDropNewest)},
+			records: []slog.Record{
+				newTestRecord(slog.LevelInfo, "2"),
+				newTestRecord(slog.LevelInfo, "3"),
+				newTestRecord(slog.LevelInfo, "4"),
+			},
+			expected: []string{"1", "2", "3"},
+			dropped:  1,
+		},
+		{
+			name: "drop oldest",
+			opts: []AsyncOption{WithOverflow(OverflowDropOldest)},
+			records: []slog.Record{
+				newTestRecord(slog.LevelInfo, "2"),
+				newTestRecord(slog.LevelInfo, "3"),
+				newTestRecord(slog.LevelInfo, "4"),
+			},
+			expected: []string{"1", "3", "4"},
+			dropped:  1,
+		},
+		{
+			name: "drop below level",
+			opts: []AsyncOption{WithDropBelowLevel(slog.LevelWarn)},
+			records: []slog.Record{
+				newTestRecord(slog.LevelInfo, "2"),
+				newTestRecord(slog.LevelInfo, "3"),
+				newTestRecord(slog.LevelDebug, "4"),
+			},
+			expected: []string{"1", "2", "3"},
+			dropped:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := newBlockingHandler()
+			opts := append([]AsyncOption{WithQueueSize(2)}, tt.opts...)
+			h := NewAsyncHandler(inner, opts...).(*AsyncHandler)
+			ctx := context.Background()
+
+			// ワーカーが最初のレコードを処理中の状態にする
+			require.NoError(t, h.Handle(ctx, newTestRecord(slog.LevelInfo, "1")))
+			<-inner.started
+
+			for _, r := range tt.records {
+				require.NoError(t, h.Handle(ctx, r))
+			}
+			require.Equal(t, tt.dropped, h.Dropped())
+
+			close(inner.release)
+			require.NoError(t, h.Close())
+			require.Equal(t, tt.expected, inner.Messages())
+			require.True(t, inner.closed)
+		})
+	}
+}
+
+func TestAsyncHandlerBlock(t *testing.T) {
+	inner := newBlockingHandler()
+	h := NewAsyncHandler(inner, WithQueueSize(1), WithOverflow(OverflowBlock)).(*AsyncHandler)
+	ctx := context.Background()
+
+	require.NoError(t, h.Handle(ctx, newTestRecord(slog.LevelInfo, "1")))
+	<-inner.started
+	require.NoError(t, h.Handle(ctx, newTestRecord(slog.LevelInfo, "2")))
+
+	pushed := make(chan struct{})
+	go func() {
+		_ = h.Handle(ctx, newTestRecord(slog.LevelInfo, "3"))
+		close(pushed)
+	}()
+
+	// キューが満杯の間はブロックされていること
+	select {
+	case <-pushed:
+		t.Fatal("handle must block while the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(inner.release)
+	<-pushed
+	require.NoError(t, h.Close())
+	require.Equal(t, []string{"1", "2", "3"}, inner.Messages())
+	require.Zero(t, h.Dropped())
+}
+
+func TestAsyncHandlerCloseTimeout(t *testing.T) {
+	inner := newBlockingHandler()
+	h := NewAsyncHandler(inner, WithQueueSize(4), WithCloseTimeout(10*time.Millisecond)).(*AsyncHandler)
+	ctx := context.Background()
+
+	require.NoError(t, h.Handle(ctx, newTestRecord(slog.LevelInfo, "1")))
+	<-inner.started
+	require.NoError(t, h.Handle(ctx, newTestRecord(slog.LevelInfo, "2")))
+	require.NoError(t, h.Handle(ctx, newTestRecord(slog.LevelInfo, "3")))
+
+	require.ErrorIs(t, h.Close(), ErrAsyncCloseTimeout)
+	require.Equal(t, uint64(2), h.Dropped())
+
+	// Close後のレコードは破棄される
+	require.NoError(t, h.Handle(ctx, newTestRecord(slog.LevelInfo, "4")))
+	require.Equal(t, uint64(3), h.Dropped())
+
+	// 処理中のワーカーが終わるまでラップしたハンドラーは閉じない
+	require.False(t, inner.Closed())
+	close(inner.release)
+	require.Eventually(t, inner.Closed, time.Second, time.Millisecond)
+	require.Equal(t, []string{"1"}, inner.Messages())
+}
+
+func TestAsyncHandlerSharedQueue(t *testing.T) {
+	buf := &bytes.Buffer{}
+	h := NewAsyncHandler(NewTextHandler(WithWriter(buf)), WithWorkers(1)).(*AsyncHandler)
+	child := h.WithAttrs([]slog.Attr{slog.String("child", "value")}).WithGroup("group").(*AsyncHandler)
+	require.Same(t, h.queue, child.queue)
+
+	slog.New(child).Info("child message", slog.String("key", "value"))
+	require.NoError(t, h.Close())
+
+	output := buf.String()
+	require.Contains(t, output, "child=value")
+	require.Contains(t, output, "group.key=value")
+}
+
+// コンテキストを記録するハンドラー
+type contextRecordHandler struct {
+	mockHandler
+	mu    sync.Mutex
+	errs  []error
+	attrs [][]slog.Attr
+}
+
+func (h *contextRecordHandler) Handle(ctx context.Context, r slog.Record) error {
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.errs = append(h.errs, ctx.Err())
+	h.attrs = append(h.attrs, attrs)
+	return nil
+}
+
+func TestAsyncHandlerDetachContext(t *testing.T) {
+	inner := &contextRecordHandler{}
+	h := NewAsyncHandler(inner).(*AsyncHandler)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := newTestRecord(slog.LevelInfo, "message")
+	r.AddAttrs(slog.String("key", "value"))
+	require.NoError(t, h.Handle(ctx, r))
+	// 呼び出し元でのキャンセルとレコードの変更は非同期処理に影響しない
+	cancel()
+	r.AddAttrs(slog.String("after", "value"))
+	require.NoError(t, h.Close())
+
+	require.Equal(t, []error{nil}, inner.errs)
+	require.Equal(t, [][]slog.Attr{{slog.String("key", "value")}}, inner.attrs)
+}
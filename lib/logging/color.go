@@ -3,94 +3,207 @@ package logging
 import (
 	"bytes"
 	"context"
-	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"strings"
+	"sync"
+
+	"github.com/mattn/go-isatty"
 )
 
-// define color code
+// levelColors はレベルの色。名前付きのレベル以上で最も近いものを使う
 var (
-	levelToColor = map[slog.Level]string{
-		slog.LevelError: "\x1b[31;20m",
-		slog.LevelWarn:  "\x1b[33;20m",
-		slog.LevelInfo:  resetColor,
-		slog.LevelDebug: "\x1b[35;20m",
+	levelColors = [...]struct {
+		level slog.Level
+		color string
+	}{
+		{LevelFatal, "\x1b[31;1m"},
+		{slog.LevelError, "\x1b[31;20m"},
+		{slog.LevelWarn, "\x1b[33;20m"},
+		{LevelNotice, "\x1b[36;20m"},
+		{slog.LevelInfo, resetColor},
+		{slog.LevelDebug, "\x1b[35;20m"},
+		{LevelTrace, "\x1b[90;20m"},
 	}
 	resetColor           = "\x1b[0m"
 	enabledTerminalColor bool
 )
 
+// levelColorIndex はlevelColorsのうちレベルに使う色の位置を返す
+func levelColorIndex(level slog.Level) int {
+	for i, c := range levelColors {
+		if level >= c.level {
+			return i
+		}
+	}
+	return len(levelColors) - 1
+}
+
 func init() {
-	colorTerminals := []string{
-		"xterm",
-		"vt100",
-		"rxvt",
-		"screen",
+	enabledTerminalColor = isColorTerminal(os.Stdout)
+}
+
+// isColorTerminal は色付けするかを判定する
+// NO_COLORが空でなければ無効、FORCE_COLORが0とfalse以外なら有効、それ以外は出力先が端末なら有効
+func isColorTerminal(w io.Writer) bool {
+	if v := os.Getenv("NO_COLOR"); v != "" {
+		return false
 	}
-	if v, ok := os.LookupEnv("TERM"); ok {
-		for _, t := range colorTerminals {
-			if strings.Contains(v, t) {
-				enabledTerminalColor = true
-				break
-			}
+	if v, ok := os.LookupEnv("FORCE_COLOR"); ok {
+		switch strings.ToLower(v) {
+		case "0", "false":
+			return false
+		default:
+			return true
 		}
 	}
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	f, ok := w.(interface{ Fd() uintptr })
+	if !ok {
+		return false
+	}
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
 }
 
+// IsEnabledTerminalColor は標準出力を色付けするかを返す
+// NewColorHandlerは出力先毎に判定する
 func IsEnabledTerminalColor() bool {
 	return enabledTerminalColor
 }
 
 type colorHandler struct {
-	slog.Handler
-	buf *bytes.Buffer
-	w   io.Writer
+	option *option
+	out    *colorWriter
+	// parentとopはWithAttrsとWithGroupで作成した子ハンドラーの親と、親のハンドラーに適用する関数
+	parent *colorHandler
+	op     func(slog.Handler) slog.Handler
+	// chains は色毎のJSONのハンドラー。使われた色だけ子ハンドラー毎に1度作成する
+	chains [len(levelColors)]colorChain
 }
 
-func NewColorHandler(opts ...Option) slog.Handler {
-	buf := &bytes.Buffer{}
-	o := defaultOptions(opts...)
-	w := o.writer
-	o.writer = buf
-	return newColorHandler(newJSONHandler(o), buf, w)
+type colorChain struct {
+	once    sync.Once
+	handler slog.Handler
 }
 
-func newColorHandler(h slog.Handler, buf *bytes.Buffer, w io.Writer) slog.Handler {
-	return &colorHandler{h, buf, w}
+// colorWriter は整形された1レコードを色付けして書き込む
+// 全ての子ハンドラーで共有し、書き込みだけをmuで直列化する
+type colorWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+	// enabled は出力先毎に判定した色付けの有無
+	enabled bool
+}
+
+// colorSink はJSONのハンドラーがレコード毎に整形したバッファを色付けしてcolorWriterに書き込む
+type colorSink struct {
+	out   *colorWriter
+	color string
+}
+
+var (
+	colorBufferPool = sync.Pool{
+		New: func() any {
+			return &bytes.Buffer{}
+		},
+	}
+)
+
+func NewColorHandler(opts ...Option) slog.Handler {
+	o := defaultOptions(opts...)
+	out := &colorWriter{w: o.writer, enabled: isColorTerminal(o.writer)}
+	return &colorHandler{option: o, out: out}
 }
 
 var (
-	_ slog.Handler = (*processHandler)(nil)
+	_ Handle    = (*colorHandler)(nil)
+	_ io.Writer = (*colorSink)(nil)
 )
 
+func (h *colorHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= LevelFor(ctx, h.option.level)
+}
+
+func (h *colorHandler) acceptReplay() {}
+
 func (h *colorHandler) Handle(ctx context.Context, r slog.Record) error {
-	err := h.Handler.Handle(ctx, r)
-	if err != nil {
-		return err
+	i := 0
+	if h.out.enabled {
+		i = levelColorIndex(r.Level)
 	}
+	return h.chain(i).Handle(ctx, r)
+}
 
-	// 色付けロジック
-	level := r.Level
-	color := levelToColor[level]
-	str := h.buf.String()
-	if str != "" {
-		if enabledTerminalColor {
-			str = fmt.Sprintf("%s%s%s\n", color, str, resetColor)
-		} else {
-			str = fmt.Sprintf("%s\n", str)
+// chain はi番目の色で書き込むハンドラーを返す
+// 子ハンドラーは親のハンドラーにWithAttrsとWithGroupを適用して作成するため、属性の整形は1度だけになる
+func (h *colorHandler) chain(i int) slog.Handler {
+	c := &h.chains[i]
+	c.once.Do(func() {
+		if h.parent != nil {
+			c.handler = h.op(h.parent.chain(i))
+			return
 		}
-	}
-	_, err = h.w.Write([]byte(str))
-	h.buf.Reset()
-	return err
+		o := *h.option
+		o.writer = &colorSink{out: h.out, color: levelColors[i].color}
+		o.closers = nil
+		c.handler = newJSONHandler(&o)
+	})
+	return c.handler
 }
 
 func (h *colorHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	return newColorHandler(h.Handler.WithAttrs(attrs), h.buf, h.w)
+	if len(attrs) == 0 {
+		return h
+	}
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
 }
 
 func (h *colorHandler) WithGroup(name string) slog.Handler {
-	return newColorHandler(h.Handler.WithGroup(name), h.buf, h.w)
+	if name == "" {
+		return h
+	}
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+func (h *colorHandler) with(op func(slog.Handler) slog.Handler) *colorHandler {
+	return &colorHandler{option: h.option, out: h.out, parent: h, op: op}
+}
+
+// Close はWithFileで作成した出力先を閉じる
+func (h *colorHandler) Close() error {
+	return h.option.close()
+}
+
+func (s *colorSink) Write(p []byte) (int, error) {
+	if err := s.out.write(p, s.color); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// write は1レコード分のpを色付けしてから、ロックして書き込む
+func (w *colorWriter) write(p []byte, color string) error {
+	if !w.enabled {
+		return w.locked(p)
+	}
+	buf := colorBufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		buf.Reset()
+		colorBufferPool.Put(buf)
+	}()
+	buf.WriteString(color)
+	buf.Write(bytes.TrimSuffix(p, []byte("\n")))
+	buf.WriteString(resetColor)
+	buf.WriteByte('\n')
+	return w.locked(buf.Bytes())
+}
+
+func (w *colorWriter) locked(p []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := w.w.Write(p)
+	return err
 }
@@ -1,10 +1,15 @@
 package logging
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/json"
+	"io"
 	"log/slog"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -76,50 +81,204 @@ func TestColorHandlerWithGroup(t *testing.T) {
 	require.Contains(t, output, "testgroup")
 }
 
-func TestIsEnabledTerminalColor(t *testing.T) {
-	// 現在の状態を保存
-	origTerm := os.Getenv("TERM")
-	defer os.Setenv("TERM", origTerm)
+func TestColorHandlerColorOutput(t *testing.T) {
+	forceColor(t)
 
-	// TERMが設定されていない場合
-	os.Unsetenv("TERM")
-	resetEnabledTerminalColor()
-	// initの代わりに明示的に設定関数を呼び出す
-	updateTerminalColorSetting()
-	require.False(t, IsEnabledTerminalColor())
+	buf := &bytes.Buffer{}
+	logger := slog.New(NewColorHandler(WithWriter(buf)))
+	logger.Warn("warning")
+	logger.Info("info")
+
+	// 1レコードを1行で色付けし、末尾で色を戻す
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	require.True(t, strings.HasPrefix(lines[0], levelColors[levelColorIndex(slog.LevelWarn)].color+"{"))
+	require.True(t, strings.HasSuffix(lines[0], "}"+resetColor))
+	require.True(t, strings.HasPrefix(lines[1], resetColor+"{"))
+}
+
+func TestColorHandlerConcurrent(t *testing.T) {
+	forceColor(t)
+
+	// ロックのないバッファでも書き込みが直列化されていれば-raceで検出されない
+	buf := &bytes.Buffer{}
+	root := NewColorHandler(WithWriter(buf), WithLevel(slog.LevelDebug))
+	levels := []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError}
 
-	// TERMがxterm系の場合
-	os.Setenv("TERM", "xterm-256color")
-	resetEnabledTerminalColor()
-	updateTerminalColorSetting()
-	require.True(t, IsEnabledTerminalColor())
+	const (
+		goroutines = 16
+		records    = 200
+	)
+	var wg sync.WaitGroup
+	for g := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// WithAttrsとWithGroupの子ハンドラーからも同時に出力する
+			logger := slog.New(root).With(slog.Int("goroutine", g)).WithGroup("g")
+			for i := range records {
+				logger.Log(t.Context(), levels[i%len(levels)], "message", slog.Int("i", i))
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 全ての行が色で囲まれた完全なJSONになっている
+	scanner := bufio.NewScanner(strings.NewReader(buf.String()))
+	count := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		require.True(t, strings.HasPrefix(line, "\x1b["), line)
+		require.True(t, strings.HasSuffix(line, resetColor), line)
+		body := line[strings.Index(line, "m")+1 : len(line)-len(resetColor)]
+		var m map[string]any
+		require.NoError(t, json.Unmarshal([]byte(body), &m), line)
+		require.Equal(t, levelColors[levelColorIndex(levelOf(t, m["level"]))].color, line[:strings.Index(line, "m")+1])
+		count++
+	}
+	require.Equal(t, goroutines*records, count)
+}
 
-	// TERMが無関係な値の場合
-	os.Setenv("TERM", "unknown")
-	resetEnabledTerminalColor()
-	updateTerminalColorSetting()
-	require.False(t, IsEnabledTerminalColor())
+// blockingValue は解決されるとreleaseが閉じられるまで待つ
+type blockingValue struct {
+	resolving chan struct{}
+	release   chan struct{}
 }
 
-// テストのためにenabledTerminalColor変数をリセットする
-func resetEnabledTerminalColor() {
-	enabledTerminalColor = false
+func (v blockingValue) LogValue() slog.Value {
+	close(v.resolving)
+	<-v.release
+	return slog.StringValue("resolved")
 }
 
-// init関数の内容を抽出した関数
-func updateTerminalColorSetting() {
-	colorTerminals := []string{
-		"xterm",
-		"vt100",
-		"rxvt",
-		"screen",
+func TestColorHandlerFormatWithoutLock(t *testing.T) {
+	forceColor(t)
+	buf := &syncBuffer{}
+	logger := slog.New(NewColorHandler(WithWriter(buf)))
+
+	v := blockingValue{resolving: make(chan struct{}), release: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		logger.Info("slow", slog.Any("value", v))
+	}()
+	<-v.resolving
+
+	// 整形中のレコードがあっても他のレコードは書き込める
+	logger.Warn("fast")
+	require.Contains(t, buf.String(), "fast")
+	require.NotContains(t, buf.String(), "slow")
+
+	close(v.release)
+	<-done
+	require.Contains(t, buf.String(), `"value":"resolved"`)
+}
+
+// countingValue は解決された回数を数える
+type countingValue struct {
+	count *atomic.Int32
+}
+
+func (v countingValue) LogValue() slog.Value {
+	v.count.Add(1)
+	return slog.StringValue("counted")
+}
+
+func TestColorHandlerWithAttrsFormatOnce(t *testing.T) {
+	forceColor(t)
+	buf := &bytes.Buffer{}
+	count := &atomic.Int32{}
+	logger := slog.New(NewColorHandler(WithWriter(buf))).With(slog.Any("value", countingValue{count: count}))
+
+	// WithAttrsの属性は子ハンドラー毎に1度だけ整形する
+	for range 10 {
+		logger.Info("message")
 	}
-	if v, ok := os.LookupEnv("TERM"); ok {
-		for _, t := range colorTerminals {
-			if strings.Contains(v, t) {
-				enabledTerminalColor = true
-				break
-			}
+	require.Equal(t, 10, countLines(buf.String(), `"value":"counted"`))
+	require.Equal(t, int32(1), count.Load())
+}
+
+func TestColorHandlerCustomLevel(t *testing.T) {
+	forceColor(t)
+	buf := &bytes.Buffer{}
+	logger := slog.New(NewColorHandler(WithWriter(buf)))
+	logger.Log(t.Context(), slog.LevelWarn+1, "custom")
+
+	// 名前付きのレベル以上で最も近い色を使い、末尾で色を戻す
+	line := strings.TrimSuffix(buf.String(), "\n")
+	require.True(t, strings.HasPrefix(line, levelColors[levelColorIndex(slog.LevelWarn)].color+"{"), line)
+	require.True(t, strings.HasSuffix(line, "}"+resetColor), line)
+	require.Equal(t, levelColorIndex(LevelTrace), levelColorIndex(LevelTrace-4))
+}
+
+// forceColor は端末でない出力先でも色付けする
+func forceColor(tb testing.TB) {
+	tb.Setenv("NO_COLOR", "")
+	tb.Setenv("FORCE_COLOR", "1")
+}
+
+func TestColorHandlerDetectPerWriter(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	t.Setenv("FORCE_COLOR", "")
+	os.Unsetenv("FORCE_COLOR")
+	orig := enabledTerminalColor
+	defer func() {
+		enabledTerminalColor = orig
+	}()
+	// 標準出力が端末でも、端末でない出力先は色付けしない
+	enabledTerminalColor = true
+
+	buf := &bytes.Buffer{}
+	slog.New(NewColorHandler(WithWriter(buf))).Warn("warning")
+	require.NotContains(t, buf.String(), "\x1b[")
+	require.True(t, strings.HasPrefix(buf.String(), "{"))
+}
+
+func levelOf(t *testing.T, v any) slog.Level {
+	t.Helper()
+	level, err := ParseLevel(v.(string))
+	require.NoError(t, err)
+	return level
+}
+
+func BenchmarkColorHandler(b *testing.B) {
+	forceColor(b)
+
+	logger := slog.New(NewColorHandler(WithWriter(io.Discard))).With(slog.String("service", "bench"))
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			logger.Info("message", slog.Int("key", 1), slog.String("name", "value"))
 		}
-	}
+	})
+}
+
+func TestIsColorTerminal(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	t.Setenv("TERM", "xterm-256color")
+	// 終了時に元の値に戻すためにt.Setenvしてから削除する
+	t.Setenv("FORCE_COLOR", "")
+	os.Unsetenv("FORCE_COLOR")
+
+	// 端末でない出力先は色付けしない
+	require.False(t, isColorTerminal(&bytes.Buffer{}))
+
+	// FORCE_COLORで強制的に有効にする
+	t.Setenv("FORCE_COLOR", "1")
+	require.True(t, isColorTerminal(&bytes.Buffer{}))
+	t.Setenv("FORCE_COLOR", "0")
+	require.False(t, isColorTerminal(&bytes.Buffer{}))
+
+	// NO_COLORはFORCE_COLORより優先する
+	t.Setenv("FORCE_COLOR", "1")
+	t.Setenv("NO_COLOR", "1")
+	require.False(t, isColorTerminal(&bytes.Buffer{}))
+
+	// 通常のファイルは端末ではない
+	t.Setenv("NO_COLOR", "")
+	os.Unsetenv("FORCE_COLOR")
+	f, err := os.CreateTemp(t.TempDir(), "color")
+	require.NoError(t, err)
+	defer f.Close()
+	require.False(t, isColorTerminal(f))
 }
@@ -0,0 +1,178 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type Config struct {
+	// Level はnilのときに環境変数LOG_LEVEL、なければINFO
+	Level       *Level          `yaml:"level" env:"LOG_LEVEL" default:"info"`
+	Handlers    []LoggingHandle `yaml:"handlers" env:"LOG_HANDLERS" envSeparator:","`
+	Service     string          `yaml:"service" env:"LOG_SERVICE"`
+	Environment string          `yaml:"environment" env:"LOG_ENVIRONMENT"`
+	Version     string          `yaml:"version" env:"LOG_VERSION"`
+	File        *FileConfig     `yaml:"file"`
+	Sentry      *SentryConfig   `yaml:"sentry"`
+	Rollbar     *RollbarConfig  `yaml:"rollbar"`
+	OTLP        *OTLPConfig     `yaml:"otlp"`
+
+	// LevelController はハンドラーが参照するレベル。指定しなければNew毎にLevelで初期化したものを使う
+	// HTTPやシグナルでレベルを変更するにはDefaultLevelを指定する。Levelが指定されていればそのレベルに変更する
+	LevelController *LevelController `yaml:"-"`
+}
+
+func (c Config) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.Handlers, validation.Each(validation.In(LoggingHandlersToInf()...))),
+		validation.Field(&c.Sentry, validation.When(c.has(SentryHandler), validation.Required)),
+		validation.Field(&c.Rollbar, validation.When(c.has(RollbarHandler), validation.Required)),
+		validation.Field(&c.OTLP, validation.When(c.has(OTLPHandler), validation.Required)),
+		validation.Field(&c.Service, validation.When(c.has(DatadogHandler), validation.Required)),
+		validation.Field(&c.File),
+	)
+}
+
+func (c *Config) has(h LoggingHandle) bool {
+	return slices.Contains(c.Handlers, h)
+}
+
+func (c *Config) handlers() []LoggingHandle {
+	if len(c.Handlers) == 0 {
+		return []LoggingHandle{JsonHandler}
+	}
+	return c.Handlers
+}
+
+func (c *Config) getLevel() slog.Level {
+	return levelOr(c.Level, envLogLevel())
+}
+
+// New はConfigに従ってハンドラーを組み立てる
+// 返却されたHandleのCloseで全てのハンドラーとクライアントを閉じる
+func New(cfg Config, opts ...Option) (Handle, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	// 指定がなければ他のロガーのレベルを変更しないようにNew毎に作成する
+	level := cfg.LevelController
+	if level == nil {
+		level = newEnvLevelController(cfg.getLevel())
+	} else if cfg.Level != nil {
+		level.Set(cfg.getLevel())
+	}
+	// WithFileの出力先を1つだけ作成して全てのハンドラーで共有し、Closeで閉じる
+	o := defaultOptions(append([]Option{WithLevel(level)}, opts...)...)
+	writerClosers := o.closers
+	o.closers = nil
+	opts = []Option{optionFn(func(opt *option) {
+		*opt = *o
+	})}
+
+	var (
+		handlers []slog.Handler
+		closers  []func() error
+	)
+	// fail は作成済みのハンドラー、クライアント、出力先の順に閉じてエラーを返す
+	fail := func(err error) (Handle, error) {
+		_ = NewHandler(handlers...).Close()
+		closeAll(closers)
+		closeAll(writerClosers)
+		return nil, err
+	}
+	if cfg.File != nil {
+		w, err := NewFileWriter(cfg.File.Filename, cfg.File.options()...)
+		if err != nil {
+			return fail(err)
+		}
+		opts = append(opts, WithWriter(w))
+		writerClosers = append(writerClosers, w.Close)
+	}
+	for _, h := range cfg.handlers() {
+		switch h {
+		case JsonHandler:
+			handlers = append(handlers, NewJSONHandler(opts...))
+		case TextHandler:
+			handlers = append(handlers, NewTextHandler(opts...))
+		case ConsoleHandler:
+			handlers = append(handlers, newConsoleHandler(defaultOptions(opts...)))
+		case SentryHandler:
+			sentryConf := *cfg.Sentry
+			if sentryConf.Release == "" {
+				sentryConf.Release = cfg.Version
+			}
+			sentry, err := NewSentryHandler(&sentryConf, cfg.Environment)
+			if err != nil {
+				return fail(err)
+			}
+			handlers = append(handlers, sentry)
+		case RollbarHandler:
+			cfg.Rollbar.Init(cfg.Environment, cfg.Version, cfg.Rollbar.ServerRoot)
+			handlers = append(handlers, NewRollbarHandler(cfg.Rollbar))
+			closers = append(closers, func() error {
+				cfg.Rollbar.Close()
+				return nil
+			})
+		case OTLPHandler:
+			otlpOpts := append(cfg.OTLP.options(),
+				WithOTLPLevel(level),
+				WithOTLPResource(cfg.Service, cfg.Version, cfg.Environment),
+			)
+			otlp, err := NewOTLPHandler(context.Background(), otlpOpts...)
+			if err != nil {
+				return fail(err)
+			}
+			handlers = append(handlers, otlp)
+		}
+	}
+
+	if o.handler != nil {
+		handlers = append(handlers, o.handler)
+	}
+
+	var root Handle = NewHandler(handlers...)
+	if cfg.has(DatadogHandler) {
+		root = NewDatadogHandler(DDArgs{
+			ServiceName: cfg.Service,
+			Environment: cfg.Environment,
+			Version:     cfg.Version,
+		}, root)
+	}
+	// ハンドラーを全て閉じてから出力先を閉じる
+	closers = append([]func() error{root.Close}, closers...)
+	closers = append(closers, writerClosers...)
+	return &pipeline{
+		Handler: NewProcessHandler(NewContextHandler(root)),
+		closers: closers,
+	}, nil
+}
+
+type pipeline struct {
+	slog.Handler
+	closers []func() error
+}
+
+var (
+	_ Handle = (*pipeline)(nil)
+)
+
+// closeAll は初期化に失敗したときに作成済みのクライアントと出力先を閉じる
+func closeAll(closers []func() error) {
+	for _, fn := range closers {
+		_ = fn()
+	}
+}
+
+func (p *pipeline) Close() error {
+	var err error
+	for _, fn := range p.closers {
+		if e := fn(); e != nil {
+			err = errors.Join(err, e)
+		}
+	}
+	return err
+}
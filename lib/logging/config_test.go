@@ -0,0 +1,216 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{
+			name: "default",
+			cfg:  Config{},
+		},
+		{
+			name: "json and text",
+			cfg:  Config{Handlers: []LoggingHandle{JsonHandler, TextHandler}},
+		},
+		{
+			name:    "unknown handler",
+			cfg:     Config{Handlers: []LoggingHandle{"unknown"}},
+			wantErr: true,
+		},
+		{
+			name:    "sentry without config",
+			cfg:     Config{Handlers: []LoggingHandle{SentryHandler}},
+			wantErr: true,
+		},
+		{
+			name:    "sentry without dsn",
+			cfg:     Config{Handlers: []LoggingHandle{SentryHandler}, Sentry: &SentryConfig{}},
+			wantErr: true,
+		},
+		{
+			name:    "rollbar without config",
+			cfg:     Config{Handlers: []LoggingHandle{RollbarHandler}},
+			wantErr: true,
+		},
+		{
+			name:    "datadog without service",
+			cfg:     Config{Handlers: []LoggingHandle{DatadogHandler}},
+			wantErr: true,
+		},
+		{
+			name: "datadog",
+			cfg:  Config{Handlers: []LoggingHandle{JsonHandler, DatadogHandler}, Service: "svc"},
+		},
+		{
+			name:    "otlp without config",
+			cfg:     Config{Handlers: []LoggingHandle{OTLPHandler}},
+			wantErr: true,
+		},
+		{
+			name: "otlp",
+			cfg:  Config{Handlers: []LoggingHandle{OTLPHandler}, OTLP: &OTLPConfig{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	buf := &bytes.Buffer{}
+	restoreDefaultLevel(t)
+	h, err := New(Config{Level: NewLevel(slog.LevelDebug)}, WithWriter(buf))
+	require.NoError(t, err)
+	defer h.Close()
+
+	log := slog.New(h)
+	ctx := AppendCtx(context.Background(), slog.String("request-id", "req-1"))
+	log.DebugContext(ctx, "debug message", slog.String("key", "value"))
+
+	// JSONで出力され、プロセス情報とコンテキストの属性が付与されていること
+	output := buf.String()
+	require.Contains(t, output, "\"msg\":\"debug message\"")
+	require.Contains(t, output, "\"key\":\"value\"")
+	require.Contains(t, output, "\"pid\":")
+	require.Contains(t, output, "\"request-id\":\"req-1\"")
+}
+
+func TestNewWithHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	extra := &bytes.Buffer{}
+	restoreDefaultLevel(t)
+	h, err := New(Config{Level: NewLevel(slog.LevelInfo)}, WithWriter(buf), WithHandler(slog.NewTextHandler(extra, nil)))
+	require.NoError(t, err)
+	defer h.Close()
+
+	slog.New(h).Info("message")
+
+	// 設定のハンドラーに加えてWithHandlerのハンドラーにも出力する
+	require.Contains(t, buf.String(), "\"msg\":\"message\"")
+	require.Contains(t, extra.String(), "msg=message")
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	h, err := New(Config{Handlers: []LoggingHandle{SentryHandler}})
+	require.Error(t, err)
+	require.Nil(t, h)
+}
+
+func TestNewLevel(t *testing.T) {
+	buf := &bytes.Buffer{}
+	restoreDefaultLevel(t)
+	h, err := New(Config{Level: NewLevel(slog.LevelWarn), Handlers: []LoggingHandle{TextHandler}}, WithWriter(buf))
+	require.NoError(t, err)
+	defer h.Close()
+
+	log := slog.New(h)
+	log.Info("info message")
+	log.Warn("warn message")
+
+	output := buf.String()
+	require.NotContains(t, output, "info message")
+	require.Contains(t, output, "msg=\"warn message\"")
+}
+
+func TestNewDatadog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	cfg := Config{
+		Handlers:    []LoggingHandle{TextHandler, DatadogHandler},
+		Service:     "test-service",
+		Environment: "test",
+		Version:     "1.0.0",
+	}
+	h, err := New(cfg, WithWriter(buf))
+	require.NoError(t, err)
+	defer h.Close()
+
+	traceID, _ := trace.TraceIDFromHex("0000000000000000abcdef1234567890")
+	spanID, _ := trace.SpanIDFromHex("0000000000000001")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+	}))
+	slog.New(h).InfoContext(ctx, "datadog message")
+
+	output := buf.String()
+	require.Contains(t, output, "dd.service=test-service")
+	require.Contains(t, output, "dd.env=test")
+	require.Contains(t, output, "dd.version=1.0.0")
+}
+
+func TestNewSentry(t *testing.T) {
+	transport := &TransportMock{}
+	buf := &bytes.Buffer{}
+	cfg := Config{
+		Handlers: []LoggingHandle{JsonHandler, SentryHandler},
+		Sentry: &SentryConfig{
+			Level:     NewLevel(slog.LevelError),
+			DSN:       "https://public@example.com/1",
+			Transport: transport,
+		},
+	}
+	h, err := New(cfg, WithWriter(buf))
+	require.NoError(t, err)
+
+	slog.New(h).Error("sentry message")
+	require.NoError(t, h.Close())
+
+	require.Contains(t, buf.String(), "sentry message")
+	require.Len(t, transport.Events(), 1)
+}
+
+func TestNewClosesHandlersOnError(t *testing.T) {
+	transport := &TransportMock{}
+	cfg := Config{
+		Handlers: []LoggingHandle{SentryHandler, OTLPHandler},
+		Sentry: &SentryConfig{
+			DSN:       "https://public@example.com/1",
+			Transport: transport,
+		},
+		// 不正なエンドポイントでOTLPのハンドラーの作成に失敗する
+		OTLP: &OTLPConfig{Endpoint: "%%%"},
+	}
+	h, err := New(cfg)
+	require.Error(t, err)
+	require.Nil(t, h)
+
+	// 作成済みのハンドラーも閉じる
+	transport.mu.Lock()
+	flushed := transport.flushed
+	transport.mu.Unlock()
+	require.NotZero(t, flushed)
+}
+
+func TestPipelineClose(t *testing.T) {
+	closed := false
+	p := &pipeline{
+		Handler: &mockHandler{enabled: true},
+		closers: []func() error{
+			func() error {
+				closed = true
+				return nil
+			},
+		},
+	}
+	require.NoError(t, p.Close())
+	require.True(t, closed)
+}
@@ -0,0 +1,350 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	defaultConsoleTimeFormat = "15:04:05.000"
+	consoleIndent            = "    "
+
+	consoleDim   = "\x1b[2m"
+	consoleBold  = "\x1b[1m"
+	consoleKey   = "\x1b[36m"
+	consoleReset = "\x1b[0m"
+)
+
+// consoleLevelColors はレベルのバッジの色。名前付きのレベル以上で最も近いものを使う
+var consoleLevelColors = []struct {
+	level slog.Level
+	color string
+}{
+	{LevelFatal, "\x1b[1;97;41m"},
+	{slog.LevelError, "\x1b[1;31m"},
+	{slog.LevelWarn, "\x1b[1;33m"},
+	{LevelNotice, "\x1b[1;36m"},
+	{slog.LevelInfo, "\x1b[1;32m"},
+	{slog.LevelDebug, "\x1b[1;35m"},
+	{LevelTrace, "\x1b[90m"},
+}
+
+type ConsoleOption interface {
+	apply(opt *consoleOption)
+}
+
+type consoleOptionFn func(opt *consoleOption)
+
+func (fn consoleOptionFn) apply(opt *consoleOption) {
+	fn(opt)
+}
+
+type consoleOption struct {
+	level      slog.Leveler
+	color      *bool
+	timeFormat string
+	addSource  bool
+	// replace はNewなどで共通のoptionから作成したときの変換。時刻の形式もこれに従う
+	replace ReplaceAttr
+}
+
+func WithConsoleLevel(level slog.Leveler) ConsoleOption {
+	return consoleOptionFn(func(opt *consoleOption) {
+		opt.level = level
+	})
+}
+
+// WithConsoleColor は色付けを有効または無効にする
+// 指定しなければNO_COLOR、FORCE_COLORと出力先が端末かどうかで判定する
+func WithConsoleColor(enabled bool) ConsoleOption {
+	return consoleOptionFn(func(opt *consoleOption) {
+		opt.color = &enabled
+	})
+}
+
+// WithConsoleTimeFormat は時刻の形式を指定する。デフォルトは "15:04:05.000"
+func WithConsoleTimeFormat(layout string) ConsoleOption {
+	return consoleOptionFn(func(opt *consoleOption) {
+		opt.timeFormat = layout
+	})
+}
+
+// WithConsoleSource は呼び出し元のファイルと行番号を出力するかを指定する。デフォルトは出力する
+func WithConsoleSource(enabled bool) ConsoleOption {
+	return consoleOptionFn(func(opt *consoleOption) {
+		opt.addSource = enabled
+	})
+}
+
+type consoleHandler struct {
+	w          io.Writer
+	mu         *sync.Mutex
+	level      slog.Leveler
+	color      bool
+	timeFormat string
+	addSource  bool
+	replace    ReplaceAttr
+
+	// WithAttrsの属性は書式化して保持する
+	attrs  []byte
+	blocks []byte
+	groups []string
+}
+
+var (
+	_ slog.Handler = (*consoleHandler)(nil)
+)
+
+// NewConsoleHandler はローカル開発向けに人が読みやすい形式で出力する
+//
+//	15:04:05.000 INFO   api/server.go:42 request handled method=GET status=200
+//
+// WithStackやErrのスタックトレースは続く行にインデントして出力する
+func NewConsoleHandler(w io.Writer, opts ...ConsoleOption) slog.Handler {
+	o := &consoleOption{
+		level:      defaultLevel,
+		timeFormat: defaultConsoleTimeFormat,
+		addSource:  true,
+	}
+	for _, opt := range opts {
+		opt.apply(o)
+	}
+	color := isColorTerminal(w)
+	if o.color != nil {
+		color = *o.color
+	}
+	return &consoleHandler{
+		w:          w,
+		mu:         &sync.Mutex{},
+		level:      o.level,
+		color:      color,
+		timeFormat: o.timeFormat,
+		addSource:  o.addSource,
+		replace:    o.replace,
+	}
+}
+
+// newConsoleHandler はJSONとテキストのハンドラーと同じoptionからコンソールのハンドラーを作成する
+// ReplaceAttr、時刻の形式とタイムゾーン、キーの変更、呼び出し元の出力はoptionに従う
+func newConsoleHandler(o *option) slog.Handler {
+	return NewConsoleHandler(o.writer,
+		WithConsoleLevel(o.level),
+		WithConsoleSource(o.addSource),
+		consoleOptionFn(func(opt *consoleOption) {
+			opt.replace = o.replace
+		}),
+	)
+}
+
+func (h *consoleHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= LevelFor(ctx, h.level)
+}
+
+func (h *consoleHandler) acceptReplay() {}
+
+func (h *consoleHandler) Handle(ctx context.Context, r slog.Record) error {
+	buf := make([]byte, 0, 256)
+	if !r.Time.IsZero() {
+		if v, ok := h.builtin(slog.Time(slog.TimeKey, r.Time)); ok {
+			buf = h.paint(buf, consoleDim, v)
+			buf = append(buf, ' ')
+		}
+	}
+	if v, ok := h.builtin(slog.Any(slog.LevelKey, r.Level)); ok {
+		buf = h.paint(buf, consoleLevelColor(r.Level), fmt.Sprintf("%-6s", v))
+		buf = append(buf, ' ')
+	}
+	if h.addSource && r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		if frame.File != "" {
+			source := &slog.Source{Function: frame.Function, File: frame.File, Line: frame.Line}
+			if v, ok := h.builtin(slog.Any(slog.SourceKey, source)); ok {
+				buf = h.paint(buf, consoleDim, v)
+				buf = append(buf, ' ')
+			}
+		}
+	}
+	if v, ok := h.builtin(slog.String(slog.MessageKey, r.Message)); ok {
+		buf = h.paint(buf, consoleBold, v)
+	}
+	buf = append(buf, h.attrs...)
+	blocks := append([]byte(nil), h.blocks...)
+	r.Attrs(func(a slog.Attr) bool {
+		buf, blocks = h.appendAttr(buf, blocks, h.groups, a)
+		return true
+	})
+	buf = append(buf, '\n')
+	buf = append(buf, blocks...)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(buf)
+	return err
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.attrs = append([]byte(nil), h.attrs...)
+	h2.blocks = append([]byte(nil), h.blocks...)
+	for _, a := range attrs {
+		h2.attrs, h2.blocks = h.appendAttr(h2.attrs, h2.blocks, h.groups, a)
+	}
+	return &h2
+}
+
+func (h *consoleHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups = append(slices.Clip(h.groups), name)
+	return &h2
+}
+
+// builtin は時刻、レベル、呼び出し元、メッセージをReplaceAttrで変換して文字列にする
+// 空の属性に変換されたものは出力しない
+func (h *consoleHandler) builtin(a slog.Attr) (string, bool) {
+	if h.replace != nil {
+		a = h.replace(nil, a)
+	} else {
+		a = replaceLevelAttr(nil, a)
+	}
+	a.Value = a.Value.Resolve()
+	if a.Key == "" {
+		return "", false
+	}
+	switch a.Value.Kind() {
+	case slog.KindTime:
+		return a.Value.Time().Format(h.timeFormat), true
+	case slog.KindAny:
+		if source, ok := a.Value.Any().(*slog.Source); ok {
+			file := filepath.Join(filepath.Base(filepath.Dir(source.File)), filepath.Base(source.File))
+			return file + ":" + strconv.Itoa(source.Line), true
+		}
+	}
+	return a.Value.String(), true
+}
+
+// appendAttr は1行で出力する属性をbufに、複数行の属性をblocksに追加する
+func (h *consoleHandler) appendAttr(buf, blocks []byte, groups []string, a slog.Attr) ([]byte, []byte) {
+	a.Value = a.Value.Resolve()
+	if h.replace != nil && a.Value.Kind() != slog.KindGroup {
+		a = h.replace(groups, a)
+		a.Value = a.Value.Resolve()
+	}
+	if a.Equal(slog.Attr{}) {
+		return buf, blocks
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		attrs := a.Value.Group()
+		if len(attrs) == 0 {
+			return buf, blocks
+		}
+		if a.Key != "" {
+			groups = append(slices.Clip(groups), a.Key)
+		}
+		for _, ga := range attrs {
+			buf, blocks = h.appendAttr(buf, blocks, groups, ga)
+		}
+		return buf, blocks
+	}
+	key := groupPrefix(groups) + a.Key
+	if lines, ok := consoleLines(a.Value); ok {
+		blocks = append(blocks, consoleIndent...)
+		blocks = h.paint(blocks, consoleKey, key+":")
+		blocks = append(blocks, '\n')
+		for _, line := range lines {
+			blocks = append(blocks, consoleIndent+consoleIndent...)
+			blocks = append(blocks, line...)
+			blocks = append(blocks, '\n')
+		}
+		return buf, blocks
+	}
+	buf = append(buf, ' ')
+	buf = h.paint(buf, consoleKey, key+"=")
+	buf = append(buf, consoleValue(a.Value)...)
+	return buf, blocks
+}
+
+func (h *consoleHandler) paint(buf []byte, color, s string) []byte {
+	if !h.color {
+		return append(buf, s...)
+	}
+	buf = append(buf, color...)
+	buf = append(buf, s...)
+	return append(buf, consoleReset...)
+}
+
+// consoleLines はスタックトレースなど複数行で出力する値を行に分ける
+func consoleLines(v slog.Value) ([]string, bool) {
+	switch v.Kind() {
+	case slog.KindString:
+		s := strings.TrimRight(v.String(), "\n")
+		if !strings.Contains(s, "\n") {
+			return nil, false
+		}
+		return strings.Split(s, "\n"), true
+	case slog.KindAny:
+		frames, ok := v.Any().(ErrorFrames)
+		if !ok || len(frames) == 0 {
+			return nil, false
+		}
+		lines := make([]string, 0, len(frames)*2)
+		for _, f := range frames {
+			lines = append(lines, f.Function, fmt.Sprintf("\t%s:%d", f.File, f.Line))
+		}
+		return lines, true
+	}
+	return nil, false
+}
+
+func consoleValue(v slog.Value) string {
+	switch v.Kind() {
+	case slog.KindString:
+		return consoleQuote(v.String())
+	case slog.KindTime:
+		return v.Time().Format(time.RFC3339Nano)
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return consoleQuote(err.Error())
+		}
+		return consoleQuote(fmt.Sprint(v.Any()))
+	default:
+		return v.String()
+	}
+}
+
+// consoleQuote は空白や記号を含む文字列だけ引用符で囲む
+func consoleQuote(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, r := range s {
+		if unicode.IsSpace(r) || r == '=' || r == '"' || !unicode.IsPrint(r) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+func consoleLevelColor(level slog.Level) string {
+	for _, c := range consoleLevelColors {
+		if level >= c.level {
+			return c.color
+		}
+	}
+	return consoleLevelColors[len(consoleLevelColors)-1].color
+}
@@ -0,0 +1,143 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsoleHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(NewConsoleHandler(buf, WithConsoleColor(false), WithConsoleLevel(slog.LevelDebug)))
+
+	log.Info("request handled", slog.String("method", "GET"), slog.Int("status", 200), slog.String("path", "/users list"))
+
+	line := buf.String()
+	// 時刻、レベル、呼び出し元、メッセージ、属性の順に出力する
+	assert.Regexp(t, `^\d{2}:\d{2}:\d{2}\.\d{3} INFO   logging/console_test\.go:\d+ request handled method=GET status=200 path="/users list"\n$`, line)
+	assert.NotContains(t, line, "\x1b[")
+}
+
+func TestConsoleHandlerLevel(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(NewConsoleHandler(buf, WithConsoleColor(false), WithConsoleLevel(slog.LevelInfo), WithConsoleSource(false)))
+
+	log.Debug("hidden")
+	log.Log(t.Context(), LevelNotice, "notice")
+	log.Log(t.Context(), LevelFatal, "fatal")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	// レベルの幅を揃えてメッセージの位置を合わせる
+	assert.Equal(t, strings.Index(lines[0], "notice"), strings.Index(lines[1], "fatal"))
+	assert.Contains(t, lines[0], " NOTICE notice")
+	assert.Contains(t, lines[1], " FATAL  fatal")
+}
+
+func TestNewConsoleHandlerOptions(t *testing.T) {
+	restoreDefaultLevel(t)
+	buf := &bytes.Buffer{}
+	h, err := New(Config{Level: NewLevel(LevelTrace), Handlers: []LoggingHandle{ConsoleHandler}},
+		WithWriter(buf),
+		WithTimeFormat(time.DateTime),
+		WithTimeZone(time.FixedZone("JST", 9*60*60)),
+		WithAddSource(),
+		WithKeys(map[string]string{"user": "user_id"}),
+		WithReplaceAttr(func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == "password" {
+				return slog.String(a.Key, "********")
+			}
+			if len(groups) == 1 && groups[0] == "db" && a.Key == "table" {
+				return slog.String(a.Key, strings.ToUpper(a.Value.String()))
+			}
+			return a
+		}),
+	)
+	require.NoError(t, err)
+	defer h.Close()
+	log := slog.New(h)
+
+	log.Log(t.Context(), LevelTrace, "trace", slog.String("password", "secret"), slog.String("user", "u1"))
+	log.WithGroup("db").Log(t.Context(), LevelFatal, "fatal", slog.String("table", "users"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	// 共通のオプションの時刻の形式、レベル名、ReplaceAttr、キーの変更、呼び出し元に従う
+	assert.Regexp(t, `^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2} TRACE  logging/console_test\.go:\d+ trace password=\*{8} user_id=u1`, lines[0])
+	assert.Contains(t, lines[1], " FATAL  ")
+	assert.Contains(t, lines[1], "fatal db.table=USERS")
+	assert.NotContains(t, buf.String(), "secret")
+}
+
+func TestConsoleHandlerGroups(t *testing.T) {
+	buf := &bytes.Buffer{}
+	h := NewConsoleHandler(buf, WithConsoleColor(false), WithConsoleSource(false), WithConsoleTimeFormat(time.RFC3339))
+	log := slog.New(h).With(slog.String("service", "api")).WithGroup("http").With(slog.String("method", "POST"))
+
+	log.Info("request",
+		slog.Group("user", slog.String("id", "u1")),
+		slog.Group("empty"),
+		slog.Any("err", errors.New("boom")),
+	)
+
+	line := buf.String()
+	assert.Contains(t, line, "request service=api http.method=POST http.user.id=u1 http.err=boom\n")
+	assert.NotContains(t, line, "empty")
+
+	// 属性のないグループは出力しない
+	buf.Reset()
+	slog.New(h).WithGroup("unused").Info("no attrs")
+	assert.True(t, strings.HasSuffix(buf.String(), "no attrs\n"))
+}
+
+func TestConsoleHandlerStack(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(NewConsoleHandler(buf, WithConsoleColor(false), WithConsoleSource(false)))
+
+	log.Error("failed", WithStack(errors.New("boom")), slog.String("key", "value"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Greater(t, len(lines), 2)
+	// スタックトレースは属性の後に複数行で出力する
+	assert.True(t, strings.HasSuffix(lines[0], "failed key=value"))
+	assert.Equal(t, consoleIndent+"stack:", lines[1])
+	assert.True(t, strings.HasPrefix(lines[2], consoleIndent+consoleIndent))
+	assert.Contains(t, buf.String(), "TestConsoleHandlerStack")
+}
+
+func TestConsoleHandlerErrFrames(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(NewConsoleHandler(buf, WithConsoleColor(false), WithConsoleSource(false)))
+
+	log.Error("failed", Err(errors.New("boom")))
+
+	output := buf.String()
+	assert.Contains(t, output, "error.message=boom")
+	assert.Contains(t, output, consoleIndent+"error.stack:\n")
+	assert.Contains(t, output, "console_test.go:")
+}
+
+func TestConsoleHandlerColor(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(NewConsoleHandler(buf, WithConsoleColor(true), WithConsoleSource(false)))
+
+	log.Warn("warning", slog.String("key", "value"))
+
+	line := buf.String()
+	assert.Contains(t, line, "\x1b[1;33mWARN  "+consoleReset)
+	assert.Contains(t, line, consoleKey+"key="+consoleReset+"value")
+}
+
+func TestConsoleQuote(t *testing.T) {
+	assert.Equal(t, `""`, consoleQuote(""))
+	assert.Equal(t, "value", consoleQuote("value"))
+	assert.Equal(t, `"a b"`, consoleQuote("a b"))
+	assert.Equal(t, `"a=b"`, consoleQuote("a=b"))
+	assert.Equal(t, `"a\tb"`, consoleQuote("a\tb"))
+}
@@ -0,0 +1,188 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+)
+
+type ctxAttrsKey struct{}
+
+// AppendCtx はコンテキストに属性を追加する
+// ContextHandlerはこのコンテキストで出力する全てのレコードに属性を付与する
+func AppendCtx(ctx context.Context, attrs ...slog.Attr) context.Context {
+	if len(attrs) == 0 {
+		return ctx
+	}
+	current := AttrsFromContext(ctx)
+	return context.WithValue(ctx, ctxAttrsKey{}, append(slices.Clip(current), attrs...))
+}
+
+// AttrsFromContext はAppendCtxでコンテキストに追加された属性を返す
+func AttrsFromContext(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(ctxAttrsKey{}).([]slog.Attr)
+	return attrs
+}
+
+// groupOrAttrs はWithGroup/WithAttrsの呼び出しを順番に保持する
+type groupOrAttrs struct {
+	group string
+	attrs []slog.Attr
+}
+
+// topLevelHandler は最初のWithGroup以降の呼び出しを保持し、
+// Handle時にグループの外へ属性を追加できるようにする
+// OTelとDatadogのハンドラーがトレースIDなどをトップレベルに出力するために使う
+type topLevelHandler struct {
+	slog.Handler
+	// 最初のWithGroup以降の呼び出し
+	goas []groupOrAttrs
+	// トップレベルに追加済みの属性のキー
+	keys map[string]struct{}
+}
+
+func (h topLevelHandler) withAttrs(attrs []slog.Attr) topLevelHandler {
+	if len(attrs) == 0 {
+		return h
+	}
+	if len(h.goas) == 0 {
+		return topLevelHandler{
+			Handler: h.Handler.WithAttrs(attrs),
+			keys:    addKeys(h.keys, attrs),
+		}
+	}
+	return topLevelHandler{
+		Handler: h.Handler,
+		goas:    append(slices.Clip(h.goas), groupOrAttrs{attrs: attrs}),
+		keys:    h.keys,
+	}
+}
+
+func (h topLevelHandler) withGroup(name string) topLevelHandler {
+	if name == "" {
+		return h
+	}
+	return topLevelHandler{
+		Handler: h.Handler,
+		goas:    append(slices.Clip(h.goas), groupOrAttrs{group: name}),
+		keys:    h.keys,
+	}
+}
+
+// handle はtopをトップレベルに追加して出力する
+// WithAttrsやレコードに同じキーの属性があればtopの属性は追加しない
+func (h topLevelHandler) handle(ctx context.Context, record slog.Record, top []slog.Attr) error {
+	if len(top) == 0 && len(h.goas) == 0 {
+		return h.Handler.Handle(ctx, record)
+	}
+
+	attrs := make([]slog.Attr, 0, record.NumAttrs())
+	record.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	keys := h.keys
+	if len(h.goas) == 0 {
+		keys = addKeys(keys, attrs)
+	}
+	// グループの内側から順に組み立てる
+	for i := len(h.goas) - 1; i >= 0; i-- {
+		goa := h.goas[i]
+		if goa.group == "" {
+			attrs = append(slices.Clip(goa.attrs), attrs...)
+		} else {
+			attrs = []slog.Attr{slog.Group(goa.group, toInterface(attrs)...)}
+		}
+	}
+
+	r := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	for _, a := range top {
+		if _, ok := keys[a.Key]; !ok {
+			r.AddAttrs(a)
+		}
+	}
+	r.AddAttrs(attrs...)
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h topLevelHandler) Close() error {
+	if v, ok := h.Handler.(io.Closer); ok {
+		return v.Close()
+	}
+	return nil
+}
+
+// ContextHandler はAppendCtxでコンテキストに追加された属性をレコードに付与する
+// コンテキストの属性はレコードの属性と同じくWithGroupのグループの中に出力する
+// 同じグループのWithAttrsやレコードに同じキーの属性があればそちらを優先する
+type ContextHandler struct {
+	slog.Handler
+	// keys は最後のWithGroup以降にWithAttrsで追加された属性のキー
+	keys map[string]struct{}
+}
+
+var (
+	_ Handle = (*ContextHandler)(nil)
+)
+
+func NewContextHandler(handler slog.Handler) Handle {
+	return &ContextHandler{Handler: handler}
+}
+
+func (h *ContextHandler) Handle(ctx context.Context, record slog.Record) error {
+	attrs := AttrsFromContext(ctx)
+	if len(attrs) == 0 {
+		return h.Handler.Handle(ctx, record)
+	}
+	recordAttrs := make([]slog.Attr, 0, record.NumAttrs())
+	record.Attrs(func(a slog.Attr) bool {
+		recordAttrs = append(recordAttrs, a)
+		return true
+	})
+	keys := addKeys(h.keys, recordAttrs)
+
+	r := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	for _, a := range attrs {
+		if _, ok := keys[a.Key]; !ok {
+			r.AddAttrs(a)
+		}
+	}
+	r.AddAttrs(recordAttrs...)
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &ContextHandler{Handler: h.Handler.WithAttrs(attrs), keys: addKeys(h.keys, attrs)}
+}
+
+func (h *ContextHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &ContextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+func (h *ContextHandler) Close() error {
+	if v, ok := h.Handler.(io.Closer); ok {
+		return v.Close()
+	}
+	return nil
+}
+
+func addKeys(keys map[string]struct{}, attrs []slog.Attr) map[string]struct{} {
+	results := make(map[string]struct{}, len(keys)+len(attrs))
+	for k := range keys {
+		results[k] = struct{}{}
+	}
+	for _, a := range attrs {
+		results[a.Key] = struct{}{}
+	}
+	return results
+}
@@ -0,0 +1,90 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendCtx(t *testing.T) {
+	ctx := context.Background()
+	require.Nil(t, AttrsFromContext(ctx))
+	require.Equal(t, ctx, AppendCtx(ctx))
+
+	parent := AppendCtx(ctx, slog.String("request-id", "req-1"))
+	child1 := AppendCtx(parent, slog.String("tenant", "t1"))
+	child2 := AppendCtx(parent, slog.String("tenant", "t2"))
+
+	// 親のコンテキストの属性は子の追加で変わらない
+	require.Equal(t, []slog.Attr{slog.String("request-id", "req-1")}, AttrsFromContext(parent))
+	require.Equal(t, []slog.Attr{slog.String("request-id", "req-1"), slog.String("tenant", "t1")}, AttrsFromContext(child1))
+	require.Equal(t, []slog.Attr{slog.String("request-id", "req-1"), slog.String("tenant", "t2")}, AttrsFromContext(child2))
+}
+
+func TestContextHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(NewContextHandler(NewTextHandler(WithWriter(buf))))
+
+	ctx := AppendCtx(context.Background(), slog.String("request-id", "req-1"), slog.String("user", "alice"))
+	log.InfoContext(ctx, "with context", slog.String("key", "value"))
+	require.Contains(t, buf.String(), "msg=\"with context\" request-id=req-1 user=alice key=value")
+
+	// コンテキストに属性がなければそのまま出力する
+	buf.Reset()
+	log.Info("without context")
+	require.Contains(t, buf.String(), "msg=\"without context\"\n")
+}
+
+func TestContextHandlerWithGroup(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(NewContextHandler(NewJSONHandler(WithWriter(buf)))).
+		With(slog.String("service", "api")).
+		WithGroup("db").
+		With(slog.String("table", "users")).
+		WithGroup("query")
+
+	ctx := AppendCtx(context.Background(), slog.String("request-id", "req-1"))
+	log.InfoContext(ctx, "grouped", slog.Int("rows", 3))
+
+	// コンテキストの属性はレコードの属性と同じグループに出力する
+	m := decodeJSONLine(t, buf)
+	require.Equal(t, "api", m["service"])
+	require.NotContains(t, m, "request-id")
+	require.Equal(t, map[string]any{
+		"table": "users",
+		"query": map[string]any{"request-id": "req-1", "rows": float64(3)},
+	}, m["db"])
+}
+
+func TestContextHandlerDuplicateKey(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(NewContextHandler(NewTextHandler(WithWriter(buf))))
+	ctx := AppendCtx(context.Background(), slog.String("request-id", "from-context"), slog.String("tenant", "t1"))
+
+	// WithAttrsの属性を優先する
+	log.With(slog.String("request-id", "from-logger")).InfoContext(ctx, "logger attrs")
+	require.Contains(t, buf.String(), "msg=\"logger attrs\" request-id=from-logger tenant=t1\n")
+
+	// 別のグループのWithAttrsの属性とは重複しない
+	buf.Reset()
+	log.With(slog.String("request-id", "from-logger")).WithGroup("g").InfoContext(ctx, "grouped")
+	require.Contains(t, buf.String(), "msg=grouped request-id=from-logger g.request-id=from-context g.tenant=t1\n")
+
+	// レコードの属性を優先する
+	buf.Reset()
+	log.InfoContext(ctx, "record attrs", slog.String("tenant", "t2"))
+	require.Contains(t, buf.String(), "msg=\"record attrs\" request-id=from-context tenant=t2\n")
+}
+
+func TestContextHandlerClose(t *testing.T) {
+	closed := false
+	h := NewContextHandler(&mockCloseHandler{closeFn: func() error {
+		closed = true
+		return nil
+	}})
+	require.NoError(t, h.Close())
+	require.True(t, closed)
+}
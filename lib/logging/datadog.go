@@ -2,6 +2,8 @@ package logging
 
 import (
 	"context"
+	"encoding/binary"
+	"encoding/hex"
 	"io"
 	"log/slog"
 	"strconv"
@@ -13,6 +15,8 @@ type DDArgs struct {
 	ServiceName string
 	Environment string
 	Version     string
+	// OTelIDs を有効にするとOpenTelemetryの16進数のIDも出力する
+	OTelIDs bool
 }
 
 type datadogHandler struct {
@@ -28,11 +32,10 @@ func NewDatadogHandler(service DDArgs, handler slog.Handler) Handle {
 }
 
 func (h *datadogHandler) Handle(ctx context.Context, record slog.Record) error {
-	span := trace.SpanFromContext(ctx)
-	if span != nil {
-		// e.g. https://docs.datadoghq.com/ja/tracing/other_telemetry/connect_logs_and_traces/opentelemetry/?tab=go
-		record.AddAttrs(slog.String("dd.trace_id", convertTraceID(span.SpanContext().TraceID().String())))
-		record.AddAttrs(slog.String("dd.span_id", convertTraceID(span.SpanContext().SpanID().String())))
+	sc := trace.SpanContextFromContext(ctx)
+	if sc.IsValid() {
+		record = record.Clone()
+		record.AddAttrs(datadogTraceAttrs(sc, h.service.OTelIDs)...)
 		record.AddAttrs(slog.String("dd.service", h.service.ServiceName))
 		record.AddAttrs(slog.String("dd.env", h.service.Environment))
 		record.AddAttrs(slog.String("dd.version", h.service.Version))
@@ -55,16 +58,25 @@ func (h *datadogHandler) Close() error {
 	return nil
 }
 
-func convertTraceID(id string) string {
-	if len(id) < 16 {
-		return ""
+// datadogTraceAttrs はスパンコンテキストをDatadogのトレースIDとスパンIDの属性に変換する
+// dd.trace_idはトレースIDの下位64bitの10進数で、上位64bitは_dd.p.tidに16進数で出力する
+// e.g. https://docs.datadoghq.com/ja/tracing/other_telemetry/connect_logs_and_traces/opentelemetry/?tab=go
+func datadogTraceAttrs(sc trace.SpanContext, otelIDs bool) []slog.Attr {
+	traceID := sc.TraceID()
+	spanID := sc.SpanID()
+	attrs := make([]slog.Attr, 0, 5)
+	attrs = append(attrs,
+		slog.String("dd.trace_id", strconv.FormatUint(binary.BigEndian.Uint64(traceID[8:]), 10)),
+		slog.String("dd.span_id", strconv.FormatUint(binary.BigEndian.Uint64(spanID[:]), 10)),
+	)
+	if binary.BigEndian.Uint64(traceID[:8]) != 0 {
+		attrs = append(attrs, slog.String("_dd.p.tid", hex.EncodeToString(traceID[:8])))
 	}
-	if len(id) > 16 {
-		id = id[16:]
+	if otelIDs {
+		attrs = append(attrs,
+			slog.String("otel.trace_id", traceID.String()),
+			slog.String("otel.span_id", spanID.String()),
+		)
 	}
-	intValue, err := strconv.ParseUint(id, 16, 64)
-	if err != nil {
-		return ""
-	}
-	return strconv.FormatUint(intValue, 10)
+	return attrs
 }
@@ -0,0 +1,527 @@
+package logging
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DefaultDatadogIntakeURL = "https://http-intake.logs.datadoghq.com/api/v2/logs"
+
+	// Datadogのログ受付APIの制限
+	// https://docs.datadoghq.com/api/latest/logs/#send-logs
+	datadogMaxPayloadSize = 5 * 1024 * 1024
+	datadogMaxEntrySize   = 1024 * 1024
+	datadogMaxBatchSize   = 1000
+
+	// defaultDatadogBufferSize は送信を待つレコードを保持する最大サイズのデフォルト
+	defaultDatadogBufferSize = 10 * datadogMaxPayloadSize
+)
+
+var (
+	ErrDatadogEntryTooLarge = errors.New("datadog: log entry exceeds maximum size")
+	ErrDatadogBufferFull    = errors.New("datadog: pending log buffer is full")
+	ErrDatadogCloseTimeout  = errors.New("datadog: intake close timed out")
+)
+
+// DatadogIntakeError は受付APIがエラーを返したときのエラー
+type DatadogIntakeError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *DatadogIntakeError) Error() string {
+	return fmt.Sprintf("datadog: intake returned %d: %s", e.StatusCode, e.Body)
+}
+
+func (e *DatadogIntakeError) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+type DatadogIntakeOption interface {
+	apply(opt *datadogIntakeOption)
+}
+
+type datadogIntakeOptionFn func(opt *datadogIntakeOption)
+
+func (fn datadogIntakeOptionFn) apply(opt *datadogIntakeOption) {
+	fn(opt)
+}
+
+type datadogIntakeOption struct {
+	url            string
+	client         *http.Client
+	level          slog.Leveler
+	source         string
+	hostname       string
+	tags           []string
+	batchSize      int
+	flushInterval  time.Duration
+	maxPayloadSize int
+	bufferSize     int
+	gzip           bool
+	maxRetries     int
+	backoff        time.Duration
+	maxBackoff     time.Duration
+	closeTimeout   time.Duration
+	errorHandler   func(error)
+}
+
+func WithIntakeURL(url string) DatadogIntakeOption {
+	return datadogIntakeOptionFn(func(opt *datadogIntakeOption) {
+		opt.url = url
+	})
+}
+
+func WithIntakeHTTPClient(client *http.Client) DatadogIntakeOption {
+	return datadogIntakeOptionFn(func(opt *datadogIntakeOption) {
+		opt.client = client
+	})
+}
+
+func WithIntakeLevel(level slog.Leveler) DatadogIntakeOption {
+	return datadogIntakeOptionFn(func(opt *datadogIntakeOption) {
+		opt.level = level
+	})
+}
+
+// WithIntakeSource はddsourceを指定する。デフォルトは "go"
+func WithIntakeSource(source string) DatadogIntakeOption {
+	return datadogIntakeOptionFn(func(opt *datadogIntakeOption) {
+		opt.source = source
+	})
+}
+
+// WithIntakeHostname はhostnameを指定する。デフォルトはos.Hostname
+func WithIntakeHostname(hostname string) DatadogIntakeOption {
+	return datadogIntakeOptionFn(func(opt *datadogIntakeOption) {
+		opt.hostname = hostname
+	})
+}
+
+// WithIntakeTags はddtagsに "key:value" 形式のタグを追加する
+func WithIntakeTags(tags ...string) DatadogIntakeOption {
+	return datadogIntakeOptionFn(func(opt *datadogIntakeOption) {
+		opt.tags = append(opt.tags, tags...)
+	})
+}
+
+// WithIntakeBatch は1回で送信する最大件数と送信間隔を指定する
+func WithIntakeBatch(size int, interval time.Duration) DatadogIntakeOption {
+	return datadogIntakeOptionFn(func(opt *datadogIntakeOption) {
+		if size > 0 {
+			opt.batchSize = min(size, datadogMaxBatchSize)
+		}
+		if interval > 0 {
+			opt.flushInterval = interval
+		}
+	})
+}
+
+// WithIntakeMaxPayloadSize は1回で送信する圧縮前の最大サイズ(byte)を指定する
+func WithIntakeMaxPayloadSize(size int) DatadogIntakeOption {
+	return datadogIntakeOptionFn(func(opt *datadogIntakeOption) {
+		if size > 0 {
+			opt.maxPayloadSize = min(size, datadogMaxPayloadSize)
+		}
+	})
+}
+
+// WithIntakeBufferSize は送信を待つレコードを保持する最大サイズ(byte)を指定する。デフォルトは50MB
+// 送信が失敗し続けて超えた場合は新しいレコードを破棄し、破棄した数を数える
+func WithIntakeBufferSize(size int) DatadogIntakeOption {
+	return datadogIntakeOptionFn(func(opt *datadogIntakeOption) {
+		if size > 0 {
+			opt.bufferSize = size
+		}
+	})
+}
+
+func WithIntakeGzip(enabled bool) DatadogIntakeOption {
+	return datadogIntakeOptionFn(func(opt *datadogIntakeOption) {
+		opt.gzip = enabled
+	})
+}
+
+// WithIntakeRetry は送信に失敗したときの最大リトライ回数と初回の待ち時間を指定する
+// 待ち時間はリトライ毎に倍になる
+func WithIntakeRetry(maxRetries int, backoff time.Duration) DatadogIntakeOption {
+	return datadogIntakeOptionFn(func(opt *datadogIntakeOption) {
+		opt.maxRetries = maxRetries
+		opt.backoff = backoff
+	})
+}
+
+// WithIntakeCloseTimeout はCloseで残っているレコードの送信を待つ時間を指定する。デフォルトは5秒
+// 超えた場合は送信とリトライを中断し、ErrDatadogCloseTimeoutを返す
+func WithIntakeCloseTimeout(timeout time.Duration) DatadogIntakeOption {
+	return datadogIntakeOptionFn(func(opt *datadogIntakeOption) {
+		if timeout > 0 {
+			opt.closeTimeout = timeout
+		}
+	})
+}
+
+// WithIntakeErrorHandler は送信に失敗したときに呼び出す関数を指定する
+func WithIntakeErrorHandler(fn func(error)) DatadogIntakeOption {
+	return datadogIntakeOptionFn(func(opt *datadogIntakeOption) {
+		opt.errorHandler = fn
+	})
+}
+
+func (o *datadogIntakeOption) ddtags(service DDArgs) string {
+	var tags []string
+	if service.Environment != "" {
+		tags = append(tags, "env:"+service.Environment)
+	}
+	if service.Version != "" {
+		tags = append(tags, "version:"+service.Version)
+	}
+	return strings.Join(append(tags, o.tags...), ",")
+}
+
+type datadogIntakeHandler struct {
+	topLevelHandler
+	intake *datadogIntake
+}
+
+var (
+	_ Handle = (*datadogIntakeHandler)(nil)
+)
+
+// NewDatadogIntakeHandler はレコードをまとめてDatadogのログ受付APIに送信する
+// コンテキストに有効なスパンがあればdd.trace_idとdd.span_idを付与する
+// 送信を待つレコードがWithIntakeBufferSizeを超えて破棄した数は Dropped() uint64 で取得できる
+func NewDatadogIntakeHandler(apiKey string, service DDArgs, opts ...DatadogIntakeOption) Handle {
+	o := &datadogIntakeOption{
+		url:            DefaultDatadogIntakeURL,
+		client:         http.DefaultClient,
+		level:          defaultLevel,
+		source:         "go",
+		batchSize:      datadogMaxBatchSize,
+		flushInterval:  5 * time.Second,
+		maxPayloadSize: datadogMaxPayloadSize,
+		bufferSize:     defaultDatadogBufferSize,
+		gzip:           true,
+		maxRetries:     3,
+		backoff:        time.Second,
+		maxBackoff:     30 * time.Second,
+		closeTimeout:   5 * time.Second,
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		o.hostname = hostname
+	}
+	for _, opt := range opts {
+		opt.apply(o)
+	}
+	intake := newDatadogIntake(apiKey, o)
+	intake.otelIDs = service.OTelIDs
+	handler := slog.NewJSONHandler(intake, &slog.HandlerOptions{
+		Level:       o.level,
+		ReplaceAttr: replaceDatadogAttr,
+	}).WithAttrs([]slog.Attr{
+		slog.String("ddsource", o.source),
+		slog.String("ddtags", o.ddtags(service)),
+		slog.String("hostname", o.hostname),
+		slog.String("service", service.ServiceName),
+	})
+	return &datadogIntakeHandler{
+		topLevelHandler: topLevelHandler{Handler: handler},
+		intake:          intake,
+	}
+}
+
+// replaceDatadogAttr は標準のキーをDatadogの予約属性に変換する
+func replaceDatadogAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
+	}
+	switch a.Key {
+	case slog.MessageKey:
+		a.Key = "message"
+	case slog.TimeKey:
+		a.Key = "date"
+	case slog.LevelKey:
+		a.Key = "status"
+		if level, ok := a.Value.Any().(slog.Level); ok {
+			a.Value = slog.StringValue(datadogStatus(level))
+		}
+	}
+	return a
+}
+
+func datadogStatus(level slog.Level) string {
+	switch {
+	case level < slog.LevelDebug:
+		return "trace"
+	case level < slog.LevelInfo:
+		return "debug"
+	case level < LevelNotice:
+		return "info"
+	case level < slog.LevelWarn:
+		return "notice"
+	case level < slog.LevelError:
+		return "warn"
+	case level < LevelFatal:
+		return "error"
+	default:
+		return "critical"
+	}
+}
+
+func (h *datadogIntakeHandler) Handle(ctx context.Context, record slog.Record) error {
+	var attrs []slog.Attr
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		attrs = datadogTraceAttrs(sc, h.intake.otelIDs)
+	}
+	return h.handle(ctx, record, attrs)
+}
+
+func (h *datadogIntakeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &datadogIntakeHandler{topLevelHandler: h.withAttrs(attrs), intake: h.intake}
+}
+
+func (h *datadogIntakeHandler) WithGroup(name string) slog.Handler {
+	return &datadogIntakeHandler{topLevelHandler: h.withGroup(name), intake: h.intake}
+}
+
+// Dropped は送信を待つレコードが上限を超えたことで破棄されたレコード数を返す
+func (h *datadogIntakeHandler) Dropped() uint64 {
+	return h.intake.dropped.Load()
+}
+
+// Close は残っているレコードを送信して終了する
+func (h *datadogIntakeHandler) Close() error {
+	return h.intake.Close()
+}
+
+// datadogIntake はJSONHandlerが書き込んだ1行を1件としてまとめて送信する
+// WithAttrs/WithGroupで派生したハンドラーで共有する
+type datadogIntake struct {
+	apiKey  string
+	otelIDs bool
+	option  *datadogIntakeOption
+
+	mu      sync.Mutex
+	pending [][]byte
+	size    int
+	closed  bool
+	dropped atomic.Uint64
+
+	flushCh chan struct{}
+	doneCh  chan struct{}
+	wg      sync.WaitGroup
+	// ctx はCloseの待ち時間を超えたときに送信とリトライの待機を中断する
+	ctx    context.Context
+	cancel context.CancelFunc
+	// 終了時の送信のエラー
+	err error
+}
+
+var (
+	_ io.WriteCloser = (*datadogIntake)(nil)
+)
+
+func newDatadogIntake(apiKey string, option *datadogIntakeOption) *datadogIntake {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &datadogIntake{
+		apiKey:  apiKey,
+		option:  option,
+		flushCh: make(chan struct{}, 1),
+		doneCh:  make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	d.wg.Add(1)
+	go d.run()
+	return d
+}
+
+func (d *datadogIntake) Write(p []byte) (int, error) {
+	entry := bytes.TrimRight(p, "\n")
+	if len(entry) > datadogMaxEntrySize {
+		return 0, ErrDatadogEntryTooLarge
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return 0, os.ErrClosed
+	}
+	if d.size+len(entry) > d.option.bufferSize {
+		d.dropped.Add(1)
+		return 0, ErrDatadogBufferFull
+	}
+	d.pending = append(d.pending, bytes.Clone(entry))
+	d.size += len(entry)
+	if len(d.pending) >= d.option.batchSize || d.size >= d.option.maxPayloadSize {
+		select {
+		case d.flushCh <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+func (d *datadogIntake) run() {
+	defer d.wg.Done()
+	ticker := time.NewTicker(d.option.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = d.flush()
+		case <-d.flushCh:
+			_ = d.flush()
+		case <-d.doneCh:
+			// Closeで返すため最後の送信のエラーを保持する
+			d.err = d.flush()
+			return
+		}
+	}
+}
+
+// flush は溜まっているレコードを件数とサイズの上限で分割して送信する
+func (d *datadogIntake) flush() error {
+	var errs error
+	for {
+		batch := d.next()
+		if len(batch) == 0 {
+			return errs
+		}
+		if err := d.send(batch); err != nil {
+			errs = errors.Join(errs, err)
+			if d.option.errorHandler != nil {
+				d.option.errorHandler(err)
+			}
+		}
+	}
+}
+
+func (d *datadogIntake) next() [][]byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// JSON配列の "[", "]" と区切りの "," の分を含めて上限に収める
+	n, size := 0, 2
+	for n < len(d.pending) && n < d.option.batchSize {
+		entrySize := len(d.pending[n]) + 1
+		if n > 0 && size+entrySize > d.option.maxPayloadSize {
+			break
+		}
+		size += entrySize
+		n++
+	}
+	batch := d.pending[:n:n]
+	d.pending = d.pending[n:]
+	for _, entry := range batch {
+		d.size -= len(entry)
+	}
+	return batch
+}
+
+func (d *datadogIntake) send(batch [][]byte) error {
+	body, err := d.encode(batch)
+	if err != nil {
+		return err
+	}
+	backoff := d.option.backoff
+	for attempt := 0; ; attempt++ {
+		err = d.post(body)
+		var intakeErr *DatadogIntakeError
+		if err == nil || attempt >= d.option.maxRetries || (errors.As(err, &intakeErr) && !intakeErr.retryable()) {
+			return err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-d.ctx.Done():
+			timer.Stop()
+			return err
+		}
+		backoff = min(backoff*2, d.option.maxBackoff)
+	}
+}
+
+func (d *datadogIntake) encode(batch [][]byte) ([]byte, error) {
+	payload := make([]byte, 0, d.option.maxPayloadSize)
+	payload = append(payload, '[')
+	payload = append(payload, bytes.Join(batch, []byte{','})...)
+	payload = append(payload, ']')
+	if !d.option.gzip {
+		return payload, nil
+	}
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	if _, err := gw.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (d *datadogIntake) post(body []byte) error {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, d.option.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("DD-API-KEY", d.apiKey)
+	if d.option.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	resp, err := d.option.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &DatadogIntakeError{StatusCode: resp.StatusCode, Body: string(b)}
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// Close は残っているレコードを送信し、送信に失敗したエラーをまとめて返す
+// WithIntakeCloseTimeoutを超えた場合は送信を中断してErrDatadogCloseTimeoutを返す
+func (d *datadogIntake) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	d.mu.Unlock()
+
+	close(d.doneCh)
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	timer := time.NewTimer(d.option.closeTimeout)
+	defer timer.Stop()
+	defer d.cancel()
+	select {
+	case <-done:
+		return d.err
+	case <-timer.C:
+		d.cancel()
+		<-done
+		return errors.Join(ErrDatadogCloseTimeout, d.err)
+	}
+}
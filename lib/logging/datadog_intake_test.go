@@ -0,0 +1,298 @@
+package logging
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type intakeRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func (r intakeRequest) entries(t *testing.T) []map[string]any {
+	t.Helper()
+	var entries []map[string]any
+	require.NoError(t, json.Unmarshal(r.body, &entries))
+	return entries
+}
+
+type intakeServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []intakeRequest
+}
+
+// newIntakeServer はstatusesの順にステータスを返し、残りは202を返すサーバーを起動する
+func newIntakeServer(t *testing.T, statuses ...int) *intakeServer {
+	t.Helper()
+	s := &intakeServer{}
+	var calls atomic.Int32
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reader io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			reader = gr
+		}
+		body, _ := io.ReadAll(reader)
+		s.mu.Lock()
+		s.requests = append(s.requests, intakeRequest{header: r.Header.Clone(), body: body})
+		s.mu.Unlock()
+
+		if n := int(calls.Add(1)); n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *intakeServer) Requests() []intakeRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]intakeRequest(nil), s.requests...)
+}
+
+func TestDatadogIntakeHandler(t *testing.T) {
+	server := newIntakeServer(t)
+	h := NewDatadogIntakeHandler("api-key", DDArgs{
+		ServiceName: "test-service",
+		Environment: "test",
+		Version:     "1.0.0",
+	},
+		WithIntakeURL(server.URL),
+		WithIntakeHTTPClient(server.Client()),
+		WithIntakeHostname("test-host"),
+		WithIntakeTags("team:platform"),
+		WithIntakeLevel(slog.LevelInfo),
+		WithIntakeBatch(10, time.Hour),
+	)
+
+	log := slog.New(h).WithGroup("req")
+	log.Debug("debug message")
+	log.WarnContext(newTestSpanContext(t, true), "warn message", slog.String("method", "GET"))
+	require.NoError(t, h.Close())
+
+	requests := server.Requests()
+	require.Len(t, requests, 1)
+	assert.Equal(t, "api-key", requests[0].header.Get("DD-API-KEY"))
+	assert.Equal(t, "gzip", requests[0].header.Get("Content-Encoding"))
+	assert.Equal(t, "application/json", requests[0].header.Get("Content-Type"))
+
+	// レベル未満のレコードは送信しない
+	entries := requests[0].entries(t)
+	require.Len(t, entries, 1)
+	entry := entries[0]
+	assert.Equal(t, "go", entry["ddsource"])
+	assert.Equal(t, "env:test,version:1.0.0,team:platform", entry["ddtags"])
+	assert.Equal(t, "test-host", entry["hostname"])
+	assert.Equal(t, "test-service", entry["service"])
+	assert.Equal(t, "warn", entry["status"])
+	assert.Equal(t, "warn message", entry["message"])
+	assert.NotEmpty(t, entry["date"])
+	// トレースIDはグループの外に出力する
+	assert.Equal(t, "11803532876627986230", entry["dd.trace_id"])
+	assert.Equal(t, "67667974448284343", entry["dd.span_id"])
+	assert.Equal(t, "4bf92f3577b34da6", entry["_dd.p.tid"])
+	assert.Equal(t, map[string]any{"method": "GET"}, entry["req"])
+}
+
+func TestDatadogIntakeHandlerBatch(t *testing.T) {
+	server := newIntakeServer(t)
+	h := NewDatadogIntakeHandler("api-key", DDArgs{ServiceName: "svc"},
+		WithIntakeURL(server.URL),
+		WithIntakeGzip(false),
+		WithIntakeBatch(2, time.Hour),
+	)
+	log := slog.New(h)
+	for range 5 {
+		log.Info("batched")
+	}
+	require.NoError(t, h.Close())
+
+	// 1回の送信は最大件数以下に分割する
+	total := 0
+	for _, r := range server.Requests() {
+		assert.Empty(t, r.header.Get("Content-Encoding"))
+		entries := r.entries(t)
+		assert.LessOrEqual(t, len(entries), 2)
+		total += len(entries)
+	}
+	require.Equal(t, 5, total)
+}
+
+func TestDatadogIntakeHandlerMaxPayloadSize(t *testing.T) {
+	server := newIntakeServer(t)
+	const maxSize = 600
+	h := NewDatadogIntakeHandler("api-key", DDArgs{ServiceName: "svc"},
+		WithIntakeURL(server.URL),
+		WithIntakeBatch(100, time.Hour),
+		WithIntakeMaxPayloadSize(maxSize),
+	)
+	log := slog.New(h)
+	for range 10 {
+		log.Info(strings.Repeat("x", 100))
+	}
+	require.NoError(t, h.Close())
+
+	// 1回の送信は圧縮前のサイズが上限以下になる
+	requests := server.Requests()
+	require.Greater(t, len(requests), 1)
+	total := 0
+	for _, r := range requests {
+		assert.LessOrEqual(t, len(r.body), maxSize)
+		total += len(r.entries(t))
+	}
+	require.Equal(t, 10, total)
+}
+
+func TestDatadogIntakeHandlerEntryTooLarge(t *testing.T) {
+	server := newIntakeServer(t)
+	h := NewDatadogIntakeHandler("api-key", DDArgs{ServiceName: "svc"},
+		WithIntakeURL(server.URL),
+	)
+	defer h.Close()
+
+	err := h.Handle(t.Context(), newTestRecord(slog.LevelInfo, strings.Repeat("x", datadogMaxEntrySize)))
+	require.ErrorIs(t, err, ErrDatadogEntryTooLarge)
+}
+
+func TestDatadogIntakeHandlerBufferSize(t *testing.T) {
+	server := newIntakeServer(t)
+	h := NewDatadogIntakeHandler("api-key", DDArgs{ServiceName: "svc"},
+		WithIntakeURL(server.URL),
+		WithIntakeBatch(datadogMaxBatchSize, time.Hour),
+		WithIntakeBufferSize(1024),
+	)
+	dropped := h.(interface{ Dropped() uint64 })
+	require.Zero(t, dropped.Dropped())
+
+	// 送信を待つレコードが上限を超えたら新しいレコードを破棄して数える
+	var errs int
+	for range 20 {
+		if err := h.Handle(t.Context(), newTestRecord(slog.LevelInfo, strings.Repeat("x", 100))); err != nil {
+			require.ErrorIs(t, err, ErrDatadogBufferFull)
+			errs++
+		}
+	}
+	require.NotZero(t, errs)
+	require.Equal(t, uint64(errs), dropped.Dropped())
+	require.NoError(t, h.Close())
+
+	total := 0
+	for _, r := range server.Requests() {
+		total += len(r.entries(t))
+	}
+	require.Equal(t, 20-errs, total)
+}
+
+func TestDatadogIntakeHandlerRetry(t *testing.T) {
+	server := newIntakeServer(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	h := NewDatadogIntakeHandler("api-key", DDArgs{ServiceName: "svc"},
+		WithIntakeURL(server.URL),
+		WithIntakeRetry(3, time.Millisecond),
+	)
+	slog.New(h).Info("retried")
+	require.NoError(t, h.Close())
+
+	// 5xxと429はリトライする
+	requests := server.Requests()
+	require.Len(t, requests, 3)
+	require.Len(t, requests[2].entries(t), 1)
+}
+
+func TestDatadogIntakeHandlerRetryExhausted(t *testing.T) {
+	server := newIntakeServer(t, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError)
+	var handled []error
+	h := NewDatadogIntakeHandler("api-key", DDArgs{ServiceName: "svc"},
+		WithIntakeURL(server.URL),
+		WithIntakeRetry(2, time.Millisecond),
+		WithIntakeErrorHandler(func(err error) {
+			handled = append(handled, err)
+		}),
+	)
+	slog.New(h).Info("failed")
+	err := h.Close()
+
+	var intakeErr *DatadogIntakeError
+	require.ErrorAs(t, err, &intakeErr)
+	require.Equal(t, http.StatusInternalServerError, intakeErr.StatusCode)
+	require.Len(t, server.Requests(), 3)
+	require.Len(t, handled, 1)
+}
+
+func TestDatadogIntakeHandlerNoRetry(t *testing.T) {
+	server := newIntakeServer(t, http.StatusForbidden)
+	h := NewDatadogIntakeHandler("invalid-key", DDArgs{ServiceName: "svc"},
+		WithIntakeURL(server.URL),
+		WithIntakeRetry(3, time.Millisecond),
+	)
+	slog.New(h).Info("forbidden")
+
+	// 4xxはリトライしない
+	var intakeErr *DatadogIntakeError
+	require.ErrorAs(t, h.Close(), &intakeErr)
+	require.Equal(t, http.StatusForbidden, intakeErr.StatusCode)
+	require.Len(t, server.Requests(), 1)
+
+	// Close後のレコードは送信しない
+	require.Error(t, h.Handle(t.Context(), newTestRecord(slog.LevelInfo, "closed")))
+	require.NoError(t, h.Close())
+}
+
+func TestDatadogIntakeHandlerCloseTimeout(t *testing.T) {
+	server := newIntakeServer(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	h := NewDatadogIntakeHandler("api-key", DDArgs{ServiceName: "svc"},
+		WithIntakeURL(server.URL),
+		WithIntakeRetry(3, time.Hour),
+		WithIntakeCloseTimeout(50*time.Millisecond),
+	)
+	slog.New(h).Info("retrying")
+
+	// リトライの待機中でも待ち時間を超えたら中断する
+	start := time.Now()
+	err := h.Close()
+	require.ErrorIs(t, err, ErrDatadogCloseTimeout)
+	require.Less(t, time.Since(start), time.Second)
+	require.Len(t, server.Requests(), 1)
+}
+
+func TestDatadogStatus(t *testing.T) {
+	tests := []struct {
+		level slog.Level
+		want  string
+	}{
+		{level: LevelTrace, want: "trace"},
+		{level: slog.LevelDebug, want: "debug"},
+		{level: slog.LevelInfo, want: "info"},
+		{level: slog.LevelInfo + 1, want: "info"},
+		{level: LevelNotice, want: "notice"},
+		{level: slog.LevelWarn, want: "warn"},
+		{level: slog.LevelError, want: "error"},
+		{level: LevelFatal, want: "critical"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			require.Equal(t, tt.want, datadogStatus(tt.level))
+		})
+	}
+}
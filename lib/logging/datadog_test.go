@@ -10,6 +10,7 @@ import (
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/propagation"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestDatadogHandler(t *testing.T) {
@@ -65,42 +66,100 @@ func TestDatadogHandler(t *testing.T) {
 	require.Contains(t, output, "dd.version=1.0.0")
 }
 
-func TestConvertTraceID(t *testing.T) {
+func TestDatadogTraceAttrs(t *testing.T) {
 	tests := []struct {
-		name     string
-		input    string
-		expected string
+		name    string
+		traceID string
+		spanID  string
+		otelIDs bool
+		want    []slog.Attr
 	}{
 		{
-			name:     "valid hex id",
-			input:    "0000000000000000abcdef1234567890",
-			expected: "12379813812177893520", // decimal of abcdef1234567890
+			name:    "128bit trace id",
+			traceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+			spanID:  "00f067aa0ba902b7",
+			want: []slog.Attr{
+				slog.String("dd.trace_id", "11803532876627986230"),
+				slog.String("dd.span_id", "67667974448284343"),
+				slog.String("_dd.p.tid", "4bf92f3577b34da6"),
+			},
 		},
 		{
-			name:     "short id",
-			input:    "1234567890",
-			expected: "",
+			name:    "64bit trace id",
+			traceID: "0000000000000000abcdef1234567890",
+			spanID:  "ffffffffffffffff",
+			want: []slog.Attr{
+				slog.String("dd.trace_id", "12379813812177893520"),
+				slog.String("dd.span_id", "18446744073709551615"),
+			},
 		},
 		{
-			name:     "invalid hex",
-			input:    "0000000000000000abcdefghijklmno",
-			expected: "",
+			name:    "upper bits only",
+			traceID: "00000000000000010000000000000000",
+			spanID:  "0000000000000001",
+			want: []slog.Attr{
+				slog.String("dd.trace_id", "0"),
+				slog.String("dd.span_id", "1"),
+				slog.String("_dd.p.tid", "0000000000000001"),
+			},
 		},
 		{
-			name:     "empty id",
-			input:    "",
-			expected: "",
+			name:    "with otel ids",
+			traceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+			spanID:  "00f067aa0ba902b7",
+			otelIDs: true,
+			want: []slog.Attr{
+				slog.String("dd.trace_id", "11803532876627986230"),
+				slog.String("dd.span_id", "67667974448284343"),
+				slog.String("_dd.p.tid", "4bf92f3577b34da6"),
+				slog.String("otel.trace_id", "4bf92f3577b34da6a3ce929d0e0e4736"),
+				slog.String("otel.span_id", "00f067aa0ba902b7"),
+			},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := convertTraceID(tt.input)
-			require.Equal(t, tt.expected, result)
+			traceID, err := trace.TraceIDFromHex(tt.traceID)
+			require.NoError(t, err)
+			spanID, err := trace.SpanIDFromHex(tt.spanID)
+			require.NoError(t, err)
+			sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID})
+			require.Equal(t, tt.want, datadogTraceAttrs(sc, tt.otelIDs))
 		})
 	}
 }
 
+func TestDatadogHandlerInvalidSpan(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := slog.New(NewDatadogHandler(DDArgs{ServiceName: "test-service"}, NewTextHandler(WithWriter(buf))))
+
+	// トレースIDが0のスパンコンテキストでは付与しない
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		SpanID: spanID,
+	}))
+	logger.InfoContext(ctx, "invalid span")
+
+	output := buf.String()
+	require.Contains(t, output, "invalid span")
+	require.NotContains(t, output, "dd.")
+}
+
+func TestDatadogHandlerOTelIDs(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ddArgs := DDArgs{
+		ServiceName: "test-service",
+		OTelIDs:     true,
+	}
+	logger := slog.New(NewDatadogHandler(ddArgs, NewTextHandler(WithWriter(buf))))
+	logger.InfoContext(newTestSpanContext(t, true), "otel ids")
+
+	output := buf.String()
+	require.Contains(t, output, "dd.trace_id=11803532876627986230 dd.span_id=67667974448284343 _dd.p.tid=4bf92f3577b34da6")
+	require.Contains(t, output, "otel.trace_id=4bf92f3577b34da6a3ce929d0e0e4736 otel.span_id=00f067aa0ba902b7")
+}
+
 func TestDatadogHandlerWithoutSpan(t *testing.T) {
 	buf := &bytes.Buffer{}
 
@@ -121,6 +180,7 @@ func TestDatadogHandlerWithoutSpan(t *testing.T) {
 	// スパン関連の属性なしでログが出力されていることを確認
 	output := buf.String()
 	require.Contains(t, output, "Test log message without span")
+	require.NotContains(t, output, "dd.")
 }
 
 func TestDatadogHandlerWithGroup(t *testing.T) {
@@ -139,10 +199,10 @@ func TestDatadogHandlerWithGroup(t *testing.T) {
 	groupHandler := ddHandler.WithGroup("testgroup")
 	logger := slog.New(groupHandler)
 
-	logger.Info("Test group message")
+	logger.Info("Test group message", slog.String("key", "value"))
 
 	output := buf.String()
-	require.Contains(t, output, "testgroup")
+	require.Contains(t, output, "testgroup.key=value")
 	require.Contains(t, output, "Test group message")
 }
 
@@ -0,0 +1,290 @@
+package logging
+
+import (
+	"container/list"
+	"context"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDedupWindow     = 10 * time.Second
+	defaultDedupMaxEntries = 1000
+)
+
+type DedupOption interface {
+	apply(opt *dedupOption)
+}
+
+type dedupOptionFn func(opt *dedupOption)
+
+func (fn dedupOptionFn) apply(opt *dedupOption) {
+	fn(opt)
+}
+
+type dedupOption struct {
+	window     time.Duration
+	keys       []string
+	maxEntries int
+}
+
+// WithDedupWindow は最後のレコードからこの期間内の重複を抑制する。デフォルトは10秒
+// 重複が来る度に期間を延長し、重複が止まってから抑制した件数を出力する
+func WithDedupWindow(window time.Duration) DedupOption {
+	return dedupOptionFn(func(opt *dedupOption) {
+		opt.window = window
+	})
+}
+
+// WithDedupKeys はレベルとメッセージに加えて重複の判定に使う属性のキーを指定する
+// WithAttrsの属性はグループの外のものだけ判定に使う
+func WithDedupKeys(keys ...string) DedupOption {
+	return dedupOptionFn(func(opt *dedupOption) {
+		opt.keys = append(opt.keys, keys...)
+	})
+}
+
+// WithDedupMaxEntries は保持する重複の判定の数の上限を指定する。デフォルトは1000
+// 上限を超えると最も古く使われたものから抑制した件数を出力して破棄する。0以下はデフォルトを使う
+func WithDedupMaxEntries(n int) DedupOption {
+	return dedupOptionFn(func(opt *dedupOption) {
+		opt.maxEntries = n
+	})
+}
+
+type dedupEntry struct {
+	key     uint64
+	first   time.Time
+	last    time.Time
+	count   uint64
+	record  slog.Record
+	handler slog.Handler
+}
+
+type deduper struct {
+	option dedupOption
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[uint64]*list.Element
+	// lru は最近使われたものが先頭
+	lru *list.List
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// allow は重複でなければtrueを返す。期間の終わったものと上限を超えて破棄したものを合わせて返す
+func (d *deduper) allow(h slog.Handler, key uint64, r slog.Record) (bool, []*dedupEntry) {
+	now := d.now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var flushed []*dedupEntry
+	if e, ok := d.entries[key]; ok {
+		entry := e.Value.(*dedupEntry)
+		if now.Sub(entry.last) < d.option.window {
+			entry.count++
+			entry.last = now
+			entry.record = r.Clone()
+			entry.handler = h
+			d.lru.MoveToFront(e)
+			return false, nil
+		}
+		flushed = appendRepeated(flushed, d.remove(e))
+	}
+	d.entries[key] = d.lru.PushFront(&dedupEntry{key: key, first: now, last: now})
+	for d.lru.Len() > d.option.maxEntries {
+		flushed = appendRepeated(flushed, d.remove(d.lru.Back()))
+	}
+	return true, flushed
+}
+
+func (d *deduper) remove(e *list.Element) *dedupEntry {
+	entry := d.lru.Remove(e).(*dedupEntry)
+	delete(d.entries, entry.key)
+	return entry
+}
+
+// expire は期間の終わったものを破棄する。allがtrueであれば全て破棄する
+func (d *deduper) expire(all bool) []*dedupEntry {
+	now := d.now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var flushed []*dedupEntry
+	for e := d.lru.Back(); e != nil; {
+		prev := e.Prev()
+		if !all && now.Sub(e.Value.(*dedupEntry).last) < d.option.window {
+			// 後ろほど古いので、これより前は期間内
+			break
+		}
+		flushed = appendRepeated(flushed, d.remove(e))
+		e = prev
+	}
+	return flushed
+}
+
+func (d *deduper) run() {
+	defer close(d.done)
+	ticker := time.NewTicker(max(d.option.window/2, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			emitRepeated(d.expire(false))
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+func (d *deduper) close() {
+	d.closeOnce.Do(func() {
+		close(d.stop)
+		<-d.done
+		emitRepeated(d.expire(true))
+	})
+}
+
+// appendRepeated は抑制したレコードがあるものだけ追加する
+func appendRepeated(entries []*dedupEntry, entry *dedupEntry) []*dedupEntry {
+	if entry.count == 0 {
+		return entries
+	}
+	return append(entries, entry)
+}
+
+// emitRepeated は最後に抑制したレコードに件数と最初と最後の時刻を付けて出力する
+func emitRepeated(entries []*dedupEntry) {
+	for _, entry := range entries {
+		r := entry.record.Clone()
+		r.AddAttrs(
+			slog.Uint64("repeat_count", entry.count),
+			slog.Time("first_seen", entry.first),
+			slog.Time("last_seen", entry.last),
+		)
+		_ = entry.handler.Handle(context.Background(), r)
+	}
+}
+
+type dedupHandler struct {
+	slog.Handler
+	deduper *deduper
+	// attrs はWithAttrsで指定された判定に使う属性
+	attrs   []slog.Attr
+	grouped bool
+}
+
+var (
+	_ Handle = (*dedupHandler)(nil)
+)
+
+// NewDedupHandler は同じレベルとメッセージのレコードを期間内に1件だけ出力する
+// 抑制したレコードは期間の終わりとClose時にrepeat_count、first_seen、last_seenを付けて1件出力する
+// 期間は重複が来る度に延長するため、重複が続く間は件数を出力しない
+//
+//	h := logging.NewDedupHandler(sentry, logging.WithDedupWindow(time.Minute), logging.WithDedupKeys("error"))
+func NewDedupHandler(handler slog.Handler, opts ...DedupOption) Handle {
+	o := dedupOption{
+		window:     defaultDedupWindow,
+		maxEntries: defaultDedupMaxEntries,
+	}
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+	if o.maxEntries <= 0 {
+		o.maxEntries = defaultDedupMaxEntries
+	}
+	d := &deduper{
+		option:  o,
+		now:     time.Now,
+		entries: map[uint64]*list.Element{},
+		lru:     list.New(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go d.run()
+	return &dedupHandler{Handler: handler, deduper: d}
+}
+
+func (h *dedupHandler) Handle(ctx context.Context, record slog.Record) error {
+	allowed, flushed := h.deduper.allow(h.Handler, h.key(record), record)
+	emitRepeated(flushed)
+	if !allowed {
+		return nil
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+// key はレベル、メッセージと指定されたキーの属性の値からハッシュを作る
+func (h *dedupHandler) key(r slog.Record) uint64 {
+	hash := fnv.New64a()
+	_, _ = io.WriteString(hash, r.Level.String())
+	_, _ = hash.Write([]byte{0})
+	_, _ = io.WriteString(hash, r.Message)
+	for _, key := range h.deduper.option.keys {
+		value, ok := h.attrValue(r, key)
+		if !ok {
+			continue
+		}
+		_, _ = hash.Write([]byte{0})
+		_, _ = io.WriteString(hash, key)
+		_, _ = hash.Write([]byte{'='})
+		_, _ = io.WriteString(hash, value.String())
+	}
+	return hash.Sum64()
+}
+
+func (h *dedupHandler) attrValue(r slog.Record, key string) (slog.Value, bool) {
+	var (
+		value slog.Value
+		found bool
+	)
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == key {
+			value, found = a.Value.Resolve(), true
+			return false
+		}
+		return true
+	})
+	if found {
+		return value, true
+	}
+	// 後から追加された属性を優先する
+	for _, a := range slices.Backward(h.attrs) {
+		if a.Key == key {
+			return a.Value.Resolve(), true
+		}
+	}
+	return slog.Value{}, false
+}
+
+func (h *dedupHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.Handler = h.Handler.WithAttrs(attrs)
+	if !h.grouped {
+		h2.attrs = append(slices.Clip(h.attrs), attrs...)
+	}
+	return &h2
+}
+
+func (h *dedupHandler) WithGroup(name string) slog.Handler {
+	h2 := *h
+	h2.Handler = h.Handler.WithGroup(name)
+	h2.grouped = h.grouped || name != ""
+	return &h2
+}
+
+func (h *dedupHandler) Close() error {
+	h.deduper.close()
+	if v, ok := h.Handler.(io.Closer); ok {
+		return v.Close()
+	}
+	return nil
+}
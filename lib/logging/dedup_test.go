@@ -0,0 +1,156 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDedupHandler(buf *bytes.Buffer, clock *fakeClock, opts ...DedupOption) *dedupHandler {
+	h := NewDedupHandler(NewTextHandler(WithWriter(buf)), append([]DedupOption{WithDedupWindow(time.Minute)}, opts...)...).(*dedupHandler)
+	h.deduper.now = clock.Now
+	return h
+}
+
+func TestDedupHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	clock := newFakeClock()
+	h := newTestDedupHandler(buf, clock)
+	log := slog.New(h)
+
+	for i := range 5 {
+		log.Error("retry failed", slog.Int("attempt", i))
+		clock.Add(time.Second)
+	}
+	log.Error("other error")
+	// 最初の1件だけ出力される
+	require.Equal(t, 1, countLines(buf.String(), "msg=\"retry failed\""))
+	require.Equal(t, 1, countLines(buf.String(), "msg=\"other error\""))
+
+	// 期間が終わると最後のレコードに件数と時刻を付けて出力する
+	clock.Add(time.Minute)
+	emitRepeated(h.deduper.expire(false))
+	require.Contains(t, buf.String(),
+		"msg=\"retry failed\" attempt=4 repeat_count=4 first_seen=2026-01-01T00:00:00.000Z last_seen=2026-01-01T00:00:04.000Z")
+	// 重複のないレコードは件数を出力しない
+	require.NotContains(t, buf.String(), "msg=\"other error\" repeat_count")
+
+	// 次の期間は再び最初の1件が出力される
+	buf.Reset()
+	log.Error("retry failed")
+	require.Equal(t, 1, countLines(buf.String(), "msg=\"retry failed\""))
+	require.NoError(t, h.Close())
+	require.NotContains(t, buf.String(), "repeat_count")
+}
+
+func TestDedupHandlerExpiredOnHandle(t *testing.T) {
+	buf := &bytes.Buffer{}
+	clock := newFakeClock()
+	h := newTestDedupHandler(buf, clock)
+	log := slog.New(h)
+
+	log.Warn("flaky")
+	log.Warn("flaky")
+	clock.Add(time.Minute)
+	// 定期的な破棄より先に期間を過ぎたレコードが来たら件数を先に出力する
+	log.Warn("flaky")
+	require.Equal(t, 3, countLines(buf.String(), "msg=flaky"))
+	require.Equal(t, 1, countLines(buf.String(), "msg=flaky repeat_count=1"))
+	require.NoError(t, h.Close())
+}
+
+func TestDedupHandlerSlidingWindow(t *testing.T) {
+	buf := &bytes.Buffer{}
+	clock := newFakeClock()
+	h := newTestDedupHandler(buf, clock)
+	log := slog.New(h)
+
+	// 重複が来る度に期間を延長するため、最初のレコードから1分を過ぎても抑制する
+	for range 4 {
+		log.Warn("flood")
+		clock.Add(40 * time.Second)
+	}
+	require.Equal(t, 1, countLines(buf.String(), "msg=flood"))
+	emitRepeated(h.deduper.expire(false))
+	require.Equal(t, 1, countLines(buf.String(), "msg=flood"))
+
+	// 最後のレコードから期間が過ぎると件数を出力する
+	clock.Add(20 * time.Second)
+	emitRepeated(h.deduper.expire(false))
+	require.Equal(t, 1, countLines(buf.String(), "msg=flood repeat_count=3"))
+	require.NoError(t, h.Close())
+}
+
+func TestDedupHandlerKeys(t *testing.T) {
+	buf := &bytes.Buffer{}
+	clock := newFakeClock()
+	h := newTestDedupHandler(buf, clock, WithDedupKeys("error", "user"))
+	log := slog.New(h)
+
+	log.Error("failed", slog.Any("error", errors.New("timeout")))
+	log.Error("failed", slog.Any("error", errors.New("timeout")))
+	log.Error("failed", slog.Any("error", errors.New("refused")))
+	// WithAttrsの属性も判定に使う
+	log.With(slog.String("user", "u1")).Error("failed", slog.Any("error", errors.New("timeout")))
+	// レベルが違えば別のレコード
+	log.Warn("failed", slog.Any("error", errors.New("timeout")))
+
+	require.Equal(t, 4, countLines(buf.String(), "msg=failed"))
+	require.NoError(t, h.Close())
+	require.Contains(t, buf.String(), "level=ERROR msg=failed error=timeout repeat_count=1")
+}
+
+func TestDedupHandlerClose(t *testing.T) {
+	buf := &bytes.Buffer{}
+	clock := newFakeClock()
+	h := newTestDedupHandler(buf, clock)
+	log := slog.New(h).With(slog.String("service", "api"))
+
+	for range 3 {
+		log.Error("retry failed")
+	}
+	// Close時に期間の途中でも件数を出力する。WithAttrsの属性も引き継ぐ
+	require.NoError(t, h.Close())
+	require.Contains(t, buf.String(), "msg=\"retry failed\" service=api repeat_count=2")
+	// 2回目のCloseでは出力しない
+	require.NoError(t, h.Close())
+	require.Equal(t, 1, countLines(buf.String(), "repeat_count"))
+}
+
+func TestDedupHandlerMaxEntries(t *testing.T) {
+	buf := &bytes.Buffer{}
+	clock := newFakeClock()
+	h := newTestDedupHandler(buf, clock, WithDedupMaxEntries(2))
+	log := slog.New(h)
+
+	log.Error("a")
+	log.Error("a")
+	log.Error("b")
+	// 上限を超えると最も古く使われたものの件数を出力して破棄する
+	log.Error("c")
+	require.Contains(t, buf.String(), "msg=a repeat_count=1")
+	require.Equal(t, 2, h.deduper.lru.Len())
+
+	// 破棄されたものは再び出力される
+	log.Error("a")
+	require.Equal(t, 3, countLines(buf.String(), "msg=a"))
+	require.NoError(t, h.Close())
+}
+
+func TestDedupHandlerMaxEntriesDefault(t *testing.T) {
+	buf := &bytes.Buffer{}
+	clock := newFakeClock()
+	// 0以下はデフォルトの上限を使い、重複を抑制する
+	h := newTestDedupHandler(buf, clock, WithDedupMaxEntries(0))
+	log := slog.New(h)
+
+	log.Error("a")
+	log.Error("a")
+	require.Equal(t, 1, countLines(buf.String(), "msg=a"))
+	require.Equal(t, defaultDedupMaxEntries, h.deduper.option.maxEntries)
+	require.NoError(t, h.Close())
+}
@@ -2,58 +2,111 @@ package logging
 
 import (
 	"context"
+	"io"
 	"log/slog"
 	"os"
-	"strings"
+	"sync"
 )
 
 func envLogLevel() slog.Level {
-	switch strings.ToUpper(os.Getenv("LOG_LEVEL")) {
-	case "DEBUG":
-		return slog.LevelDebug
-	case "INFO":
-		return slog.LevelInfo
-	case "WARN", "WARNING":
-		return slog.LevelWarn
-	case "ERROR":
-		return slog.LevelError
-	default:
-		return slog.LevelInfo
+	return parseLevelOr(os.Getenv("LOG_LEVEL"), slog.LevelInfo)
+}
+
+var (
+	// exit はテストで置き換える
+	exit = os.Exit
+)
+
+var (
+	defaultLogger   = slog.New(NewProcessHandler(newJSONHandler(defaultOption)))
+	defaultLoggerMu sync.RWMutex
+)
+
+// Default はパッケージレベルの関数が使うロガーを返す
+func Default() *slog.Logger {
+	defaultLoggerMu.RLock()
+	defer defaultLoggerMu.RUnlock()
+	return defaultLogger
+}
+
+// SetDefault はパッケージレベルの関数が使うロガーを置き換える
+// 置き換え前のハンドラーは閉じないため、必要であれば呼び出し元で閉じる
+func SetDefault(h Handle) {
+	defaultLoggerMu.Lock()
+	defer defaultLoggerMu.Unlock()
+	defaultLogger = slog.New(h)
+}
+
+type loggerContextKey struct{}
+
+// WithContext はロガーをコンテキストに設定する
+func WithContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// FromContext はコンテキストに設定されたロガーを返す。設定されていなければDefaultを返す
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerContextKey{}).(*slog.Logger); ok && logger != nil {
+			return logger
+		}
 	}
+	return Default()
+}
+
+func Trace(msg string, args ...any) {
+	Default().Log(context.Background(), LevelTrace, msg, args...)
 }
 
-var defaultLogger = slog.New(NewProcessHandler(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-	Level: envLogLevel(),
-})))
+func TraceContext(ctx context.Context, msg string, args ...any) {
+	FromContext(ctx).Log(ctx, LevelTrace, msg, args...)
+}
 
 func Debug(msg string, args ...any) {
-	defaultLogger.Debug(msg, args...)
+	Default().Debug(msg, args...)
 }
 
 func DebugContext(ctx context.Context, msg string, args ...any) {
-	defaultLogger.DebugContext(ctx, msg, args...)
+	FromContext(ctx).DebugContext(ctx, msg, args...)
 }
 
 func Info(msg string, args ...any) {
-	defaultLogger.Info(msg, args...)
+	Default().Info(msg, args...)
 }
 
 func InfoContext(ctx context.Context, msg string, args ...any) {
-	defaultLogger.InfoContext(ctx, msg, args...)
+	FromContext(ctx).InfoContext(ctx, msg, args...)
 }
 
 func Warn(msg string, args ...any) {
-	defaultLogger.Warn(msg, args...)
+	Default().Warn(msg, args...)
 }
 
 func WarnContext(ctx context.Context, msg string, args ...any) {
-	defaultLogger.WarnContext(ctx, msg, args...)
+	FromContext(ctx).WarnContext(ctx, msg, args...)
 }
 
 func Error(msg string, args ...any) {
-	defaultLogger.Error(msg, args...)
+	Default().Error(msg, args...)
 }
 
 func ErrorContext(ctx context.Context, msg string, args ...any) {
-	defaultLogger.ErrorContext(ctx, msg, args...)
+	FromContext(ctx).ErrorContext(ctx, msg, args...)
+}
+
+// Fatal はFATALで出力し、ハンドラーを閉じて送信待ちのログを出力してから終了コード1で終了する
+func Fatal(msg string, args ...any) {
+	fatal(context.Background(), Default(), msg, args...)
+}
+
+func FatalContext(ctx context.Context, msg string, args ...any) {
+	fatal(ctx, FromContext(ctx), msg, args...)
+}
+
+func fatal(ctx context.Context, logger *slog.Logger, msg string, args ...any) {
+	logger.Log(ctx, LevelFatal, msg, args...)
+	if v, ok := logger.Handler().(io.Closer); ok {
+		_ = v.Close()
+	}
+	exit(1)
 }
@@ -20,6 +20,7 @@ func TestEnvLogLevel(t *testing.T) {
 		env      string
 		expected string
 	}{
+		{"TRACE", "DEBUG-4"}, // slog.LevelのStringでは名前がない
 		{"DEBUG", "DEBUG"},
 		{"INFO", "INFO"},
 		{"WARN", "WARN"},
@@ -68,3 +69,82 @@ func TestDefaultLoggerFunctions(t *testing.T) {
 	assert.Contains(t, output, "Warn with context")
 	assert.Contains(t, output, "Error with context")
 }
+
+func TestSetDefault(t *testing.T) {
+	orig := Default()
+	defer func() {
+		defaultLogger = orig
+	}()
+
+	buf := new(strings.Builder)
+	SetDefault(NewHandler(NewTextHandler(WithWriter(buf))))
+	Info("replaced")
+	assert.Contains(t, buf.String(), "msg=replaced")
+}
+
+func TestFromContext(t *testing.T) {
+	orig := Default()
+	defer func() {
+		defaultLogger = orig
+	}()
+
+	defaultBuf := new(strings.Builder)
+	SetDefault(NewHandler(NewTextHandler(WithWriter(defaultBuf))))
+
+	// コンテキストにロガーがなければデフォルトのロガーを使う
+	ctx := context.Background()
+	assert.Equal(t, Default(), FromContext(ctx))
+	InfoContext(ctx, "default logger")
+	assert.Contains(t, defaultBuf.String(), "msg=\"default logger\"")
+
+	// コンテキストのロガーを優先する
+	ctxBuf := new(strings.Builder)
+	logger := slog.New(NewTextHandler(WithWriter(ctxBuf))).With(slog.String("request-id", "req-1"))
+	ctx = WithContext(ctx, logger)
+	assert.Equal(t, logger, FromContext(ctx))
+
+	DebugContext(ctx, "debug with request")
+	InfoContext(ctx, "info with request")
+	WarnContext(ctx, "warn with request")
+	ErrorContext(ctx, "error with request")
+	output := ctxBuf.String()
+	assert.Contains(t, output, "msg=\"info with request\" request-id=req-1")
+	assert.Contains(t, output, "msg=\"warn with request\" request-id=req-1")
+	assert.Contains(t, output, "msg=\"error with request\" request-id=req-1")
+	assert.NotContains(t, defaultBuf.String(), "with request")
+}
+
+func TestTraceAndFatal(t *testing.T) {
+	orig := Default()
+	origExit := exit
+	defer func() {
+		defaultLogger = orig
+		exit = origExit
+	}()
+	var code int
+	exit = func(c int) {
+		code = c
+	}
+
+	buf := new(strings.Builder)
+	var closed bool
+	SetDefault(NewHandler(
+		NewTextHandler(WithWriter(buf), WithLevel(LevelTrace)),
+		&mockCloseHandler{closeFn: func() error {
+			closed = true
+			return nil
+		}},
+	))
+
+	Trace("trace message")
+	TraceContext(context.Background(), "trace with context")
+	Fatal("fatal message")
+
+	output := buf.String()
+	assert.Contains(t, output, "level=TRACE msg=\"trace message\"")
+	assert.Contains(t, output, "level=TRACE msg=\"trace with context\"")
+	assert.Contains(t, output, "level=FATAL msg=\"fatal message\"")
+	// 終了前にハンドラーを閉じる
+	assert.True(t, closed)
+	assert.Equal(t, 1, code)
+}
@@ -0,0 +1,178 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"connectrpc.com/connect"
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/errbase"
+)
+
+const (
+	// ErrorKey はErrで出力する属性のキー
+	ErrorKey = "error"
+	// errorDetailSuffix はエラー追跡サービスに送る詳細の属性のキーの接尾辞
+	errorDetailSuffix = "_detail"
+)
+
+// ErrorFrame はスタックトレースの1フレーム
+type ErrorFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// ErrorFrames は呼び出し元が後になる順のスタックトレース
+// JSONでは配列、テキストでは1行で出力する
+type ErrorFrames []ErrorFrame
+
+func (frames ErrorFrames) String() string {
+	values := make([]string, len(frames))
+	for i, f := range frames {
+		values[i] = fmt.Sprintf("%s(%s:%d)", f.Function, f.File, f.Line)
+	}
+	return strings.Join(values, " < ")
+}
+
+// Err はエラーを構造化した属性を返す
+// メッセージ、型、ラップされたエラーのメッセージ、スタックトレース、
+// cockroachdb/errorsのヒントと詳細、connectのエラーコードをグループで出力する
+// ErrorTrackingではエラーをそのまま渡し、SentryやRollbarがスタックトレースを取得できるようにする
+func Err(err error) slog.Attr {
+	if err == nil {
+		return slog.Attr{}
+	}
+	return slog.Any(ErrorKey, errorValue{err: err})
+}
+
+type errorValue struct {
+	err error
+}
+
+var (
+	_ slog.LogValuer = errorValue{}
+)
+
+func (v errorValue) LogValue() slog.Value {
+	attrs := append([]slog.Attr{slog.String("message", v.err.Error())}, v.detailAttrs()...)
+	if frames := errorFrames(v.err); len(frames) > 0 {
+		attrs = append(attrs, slog.Any("stack", frames))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// detailAttrs はメッセージとスタックトレース以外の属性を返す
+func (v errorValue) detailAttrs() []slog.Attr {
+	attrs := []slog.Attr{slog.String("type", fmt.Sprintf("%T", errors.UnwrapAll(v.err)))}
+	var connectErr *connect.Error
+	if errors.As(v.err, &connectErr) {
+		attrs = append(attrs, slog.String("code", connectErr.Code().String()))
+	}
+	if causes := errorCauses(v.err); len(causes) > 1 {
+		attrs = append(attrs, slog.Any("causes", causes))
+	}
+	if hints := errors.GetAllHints(v.err); len(hints) > 0 {
+		attrs = append(attrs, slog.Any("hints", hints))
+	}
+	if details := errors.GetAllDetails(v.err); len(details) > 0 {
+		attrs = append(attrs, slog.Any("details", details))
+	}
+	if safeDetails := errorSafeDetails(v.err); len(safeDetails) > 0 {
+		attrs = append(attrs, slog.Any("safe_details", safeDetails))
+	}
+	return attrs
+}
+
+// errorCauses はラップされたエラーのメッセージを外側から順に返す
+// メッセージが変わらないラップは省く
+func errorCauses(err error) []string {
+	var causes []string
+	for e := err; e != nil; e = errors.UnwrapOnce(e) {
+		msg := e.Error()
+		if len(causes) == 0 || causes[len(causes)-1] != msg {
+			causes = append(causes, msg)
+		}
+	}
+	return causes
+}
+
+// errorSafeDetails はメッセージやスタックトレースに含まれないセーフな詳細を返す
+func errorSafeDetails(err error) []string {
+	var results []string
+	for e := err; e != nil; e = errors.UnwrapOnce(e) {
+		cause := errors.UnwrapOnce(e)
+		if cause == nil || cause.Error() != e.Error() {
+			continue
+		}
+		if _, ok := e.(errbase.StackTraceProvider); ok {
+			continue
+		}
+		for _, d := range errors.GetSafeDetails(e).SafeDetails {
+			if d != "" {
+				results = append(results, d)
+			}
+		}
+	}
+	return results
+}
+
+// errorFrames は最も内側のエラーのスタックトレースを返す
+func errorFrames(err error) ErrorFrames {
+	var st *errors.ReportableStackTrace
+	for e := err; e != nil; e = errors.UnwrapOnce(e) {
+		if s := errors.GetReportableStackTrace(e); s != nil {
+			st = s
+		}
+	}
+	if st == nil {
+		return nil
+	}
+	// Sentryの形式は呼び出し元が先なので逆順にする
+	frames := make(ErrorFrames, 0, len(st.Frames))
+	for i := len(st.Frames) - 1; i >= 0; i-- {
+		f := st.Frames[i]
+		function := f.Function
+		if f.Module != "" {
+			function = f.Module + "." + f.Function
+		}
+		file := f.AbsPath
+		if file == "" {
+			file = f.Filename
+		}
+		frames = append(frames, ErrorFrame{Function: function, File: file, Line: f.Lineno})
+	}
+	return frames
+}
+
+// errorTrackingAttr はErrの属性をエラー追跡サービス向けに元のエラーと詳細のグループに分ける
+func errorTrackingAttr(a slog.Attr) []slog.Attr {
+	v, ok := a.Value.Any().(errorValue)
+	if !ok {
+		return []slog.Attr{a}
+	}
+	return []slog.Attr{
+		slog.Any(a.Key, v.err),
+		slog.Group(a.Key+errorDetailSuffix, toInterface(v.detailAttrs())...),
+	}
+}
+
+// errorTrackingAttrs はErrの属性を含む場合だけ変換した属性を返す
+func errorTrackingAttrs(attrs []slog.Attr) ([]slog.Attr, bool) {
+	found := false
+	for _, a := range attrs {
+		if _, ok := a.Value.Any().(errorValue); ok {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return attrs, false
+	}
+	results := make([]slog.Attr, 0, len(attrs)+1)
+	for _, a := range attrs {
+		results = append(results, errorTrackingAttr(a)...)
+	}
+	return results, true
+}
@@ -0,0 +1,139 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrNil(t *testing.T) {
+	require.Equal(t, slog.Attr{}, Err(nil))
+}
+
+func TestErrJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(NewJSONHandler(WithWriter(buf)))
+
+	base := errors.New("base")
+	err := errors.Wrap(base, "wrapped")
+	err = errors.WithHint(err, "retry later")
+	err = errors.WithDetail(err, "user 42")
+	err = errors.WithSafeDetails(err, "id=%d", errors.Safe(42))
+	log.Error("failed", Err(err))
+
+	m := decodeJSONLine(t, buf)
+	e, ok := m["error"].(map[string]any)
+	require.True(t, ok)
+	assert.Equal(t, "wrapped: base", e["message"])
+	assert.Equal(t, "*errutil.leafError", e["type"])
+	assert.Equal(t, []any{"wrapped: base", "base"}, e["causes"])
+	assert.Equal(t, []any{"retry later"}, e["hints"])
+	assert.Equal(t, []any{"user 42"}, e["details"])
+	assert.Equal(t, []any{"id=42"}, e["safe_details"])
+	assert.NotContains(t, e, "code")
+
+	// スタックトレースは最も内側のエラーのもので、このテストの関数を含む
+	stack, ok := e["stack"].([]any)
+	require.True(t, ok)
+	require.NotEmpty(t, stack)
+	frame := stack[0].(map[string]any)
+	assert.Contains(t, frame["function"], "TestErrJSON")
+	assert.Contains(t, frame["file"], "error_attr_test.go")
+	assert.NotZero(t, frame["line"])
+}
+
+func TestErrText(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(NewTextHandler(WithWriter(buf)))
+
+	log.Error("failed", Err(errors.New("boom")))
+
+	out := buf.String()
+	assert.Contains(t, out, "error.message=boom")
+	assert.Contains(t, out, "error.stack=")
+	assert.Contains(t, out, "TestErrText(")
+	assert.NotContains(t, out, "error.causes")
+}
+
+func TestErrConnectCode(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(NewJSONHandler(WithWriter(buf)))
+
+	err := errors.Wrap(connect.NewError(connect.CodeNotFound, errors.New("user not found")), "get user")
+	log.Error("failed", Err(err))
+
+	e := decodeJSONLine(t, buf)["error"].(map[string]any)
+	assert.Equal(t, "not_found", e["code"])
+}
+
+func TestErrStandardError(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(NewJSONHandler(WithWriter(buf)))
+
+	log.Error("failed", Err(context.Canceled))
+
+	e := decodeJSONLine(t, buf)["error"].(map[string]any)
+	assert.Equal(t, "context canceled", e["message"])
+	// スタックトレースのないエラーはstackを出力しない
+	assert.NotContains(t, e, "stack")
+	assert.NotContains(t, e, "causes")
+}
+
+func TestErrorTrackingErrAttr(t *testing.T) {
+	inner := &contextRecordHandler{}
+	h := NewErrorTracking(inner)
+
+	err := errors.WithHint(errors.New("boom"), "check config")
+	r := newTestRecord(slog.LevelError, "failed")
+	r.AddAttrs(Err(err), slog.String("key", "value"))
+	require.NoError(t, h.Handle(context.Background(), r))
+
+	// エラー追跡サービスには元のエラーと詳細のグループを渡す
+	require.Len(t, inner.attrs, 1)
+	attrs := inner.attrs[0]
+	require.Len(t, attrs, 3)
+	assert.Equal(t, "error", attrs[0].Key)
+	assert.Same(t, err, attrs[0].Value.Any())
+	assert.Equal(t, "error_detail", attrs[1].Key)
+	assert.Equal(t, slog.KindGroup, attrs[1].Value.Kind())
+	detail := map[string]any{}
+	for _, a := range attrs[1].Value.Group() {
+		detail[a.Key] = a.Value.Any()
+	}
+	assert.Equal(t, []string{"check config"}, detail["hints"])
+	assert.NotContains(t, detail, "stack")
+	assert.Equal(t, "key", attrs[2].Key)
+
+	// 元のレコードは変更しない
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == "error" {
+			assert.IsType(t, errorValue{}, a.Value.Any())
+		}
+		return true
+	})
+}
+
+func TestErrorTrackingErrAttrWithAttrs(t *testing.T) {
+	inner := &contextRecordHandler{}
+	h := NewErrorTracking(inner)
+
+	err := errors.New("boom")
+	attrs, ok := errorTrackingAttrs([]slog.Attr{Err(err)})
+	require.True(t, ok)
+	require.Len(t, attrs, 2)
+	assert.Same(t, err, attrs[0].Value.Any())
+
+	// Err以外の属性はそのまま
+	plain := []slog.Attr{slog.String("key", "value")}
+	attrs, ok = errorTrackingAttrs(plain)
+	require.False(t, ok)
+	assert.Equal(t, plain, attrs)
+
+	require.NotNil(t, h.WithAttrs([]slog.Attr{Err(err)}))
+}
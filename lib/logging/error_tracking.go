@@ -2,30 +2,97 @@ package logging
 
 import (
 	"context"
+	"errors"
 	"io"
 	"log/slog"
+	"slices"
+
+	"connectrpc.com/connect"
 )
 
 var (
+	// IgnoreTracking をロガーかレコードの属性に指定するとエラー追跡サービスに送信しない
 	IgnoreTracking = slog.Attr{
 		Key:   "Ignore",
 		Value: slog.BoolValue(true),
 	}
 )
 
+type ErrorTrackingOption interface {
+	apply(opt *errorTrackingOption)
+}
+
+type errorTrackingOptionFn func(opt *errorTrackingOption)
+
+func (fn errorTrackingOptionFn) apply(opt *errorTrackingOption) {
+	fn(opt)
+}
+
+type errorTrackingOption struct {
+	ignoreErrors []error
+	ignoreTypes  []func(err error) bool
+	trackTypes   []func(err error) bool
+	ignoreCodes  []connect.Code
+}
+
+// WithIgnoreErrors はerrors.Isで一致するエラーを含むレコードを送信しない
+//
+//	logging.WithIgnoreErrors(context.Canceled, sql.ErrNoRows)
+func WithIgnoreErrors(targets ...error) ErrorTrackingOption {
+	return errorTrackingOptionFn(func(opt *errorTrackingOption) {
+		opt.ignoreErrors = append(opt.ignoreErrors, targets...)
+	})
+}
+
+// WithIgnoreErrorType はerrors.Asで型が一致するエラーを含むレコードを送信しない
+func WithIgnoreErrorType[T error]() ErrorTrackingOption {
+	return errorTrackingOptionFn(func(opt *errorTrackingOption) {
+		opt.ignoreTypes = append(opt.ignoreTypes, errorTypeMatcher[T]())
+	})
+}
+
+// WithTrackErrorType を指定するとエラーを含むレコードは型が一致するものだけ送信する
+// エラーを含まないレコードは送信する
+func WithTrackErrorType[T error]() ErrorTrackingOption {
+	return errorTrackingOptionFn(func(opt *errorTrackingOption) {
+		opt.trackTypes = append(opt.trackTypes, errorTypeMatcher[T]())
+	})
+}
+
+// WithIgnoreConnectCodes はconnectのエラーコードが一致するエラーを含むレコードを送信しない
+//
+//	logging.WithIgnoreConnectCodes(connect.CodeNotFound, connect.CodeInvalidArgument)
+func WithIgnoreConnectCodes(codes ...connect.Code) ErrorTrackingOption {
+	return errorTrackingOptionFn(func(opt *errorTrackingOption) {
+		opt.ignoreCodes = append(opt.ignoreCodes, codes...)
+	})
+}
+
+func errorTypeMatcher[T error]() func(err error) bool {
+	return func(err error) bool {
+		var target T
+		return errors.As(err, &target)
+	}
+}
+
+// ErrorTracking はエラー追跡サービスに送信するレコードを選別する
+// 送信するかはレコード毎にロガーとレコードの属性から判定し、ハンドラーの状態は変更しない
 type ErrorTracking struct {
 	slog.Handler
+	option *errorTrackingOption
 	ignore bool
+	// errs はWithAttrsで指定されたエラー
+	errs []error
 }
 
-func NewErrorTracking(handler slog.Handler) Handle {
-	return newErrorTracking(handler, false)
-}
-
-func newErrorTracking(handler slog.Handler, ignore bool) Handle {
+func NewErrorTracking(handler slog.Handler, opts ...ErrorTrackingOption) Handle {
+	o := &errorTrackingOption{}
+	for _, opt := range opts {
+		opt.apply(o)
+	}
 	return &ErrorTracking{
 		Handler: handler,
-		ignore:  ignore,
+		option:  o,
 	}
 }
 
@@ -33,23 +100,46 @@ func (h *ErrorTracking) Handle(ctx context.Context, record slog.Record) error {
 	if h.ignore {
 		return nil
 	}
-	_ = h.Handler.Handle(ctx, record)
+	// WithAttrsのエラーと共有しないように容量を切り詰める
+	errs := slices.Clip(h.errs)
+	ignore := false
+	record.Attrs(func(a slog.Attr) bool {
+		if a.Equal(IgnoreTracking) {
+			ignore = true
+			return false
+		}
+		if err := attrError(a); err != nil {
+			errs = append(errs, err)
+		}
+		return true
+	})
+	if ignore || h.option.ignored(errs) {
+		return nil
+	}
+	_ = h.Handler.Handle(ctx, errorTrackingRecord(record))
 	return nil
 }
 
 func (h *ErrorTracking) WithAttrs(attrs []slog.Attr) slog.Handler {
-	if !h.ignore {
-		for _, attr := range attrs {
-			if attr.Equal(IgnoreTracking) {
-				h.ignore = true
-			}
+	h2 := *h
+	h2.errs = slices.Clip(h.errs)
+	for _, a := range attrs {
+		if a.Equal(IgnoreTracking) {
+			h2.ignore = true
+		}
+		if err := attrError(a); err != nil {
+			h2.errs = append(h2.errs, err)
 		}
 	}
-	return newErrorTracking(h.Handler.WithAttrs(attrs), h.ignore)
+	attrs, _ = errorTrackingAttrs(attrs)
+	h2.Handler = h.Handler.WithAttrs(attrs)
+	return &h2
 }
 
 func (h *ErrorTracking) WithGroup(name string) slog.Handler {
-	return newErrorTracking(h.Handler.WithGroup(name), h.ignore)
+	h2 := *h
+	h2.Handler = h.Handler.WithGroup(name)
+	return &h2
 }
 
 func (h *ErrorTracking) Close() error {
@@ -58,3 +148,63 @@ func (h *ErrorTracking) Close() error {
 	}
 	return nil
 }
+
+// ignored はエラーのいずれかが除外の条件に一致するか、送信する型のいずれにも一致しなければtrueを返す
+func (o *errorTrackingOption) ignored(errs []error) bool {
+	if len(errs) == 0 {
+		return false
+	}
+	tracked := len(o.trackTypes) == 0
+	for _, err := range errs {
+		for _, target := range o.ignoreErrors {
+			if errors.Is(err, target) {
+				return true
+			}
+		}
+		for _, match := range o.ignoreTypes {
+			if match(err) {
+				return true
+			}
+		}
+		if len(o.ignoreCodes) > 0 {
+			var connectErr *connect.Error
+			if errors.As(err, &connectErr) && slices.Contains(o.ignoreCodes, connectErr.Code()) {
+				return true
+			}
+		}
+		if !tracked && slices.ContainsFunc(o.trackTypes, func(match func(error) bool) bool { return match(err) }) {
+			tracked = true
+		}
+	}
+	return !tracked
+}
+
+// attrError は属性の値がエラーかErrの属性であればエラーを返す
+func attrError(a slog.Attr) error {
+	if a.Value.Kind() != slog.KindAny && a.Value.Kind() != slog.KindLogValuer {
+		return nil
+	}
+	switch v := a.Value.Any().(type) {
+	case errorValue:
+		return v.err
+	case error:
+		return v
+	}
+	return nil
+}
+
+// errorTrackingRecord はErrの属性を含む場合だけ属性を変換したレコードを返す
+func errorTrackingRecord(record slog.Record) slog.Record {
+	attrs := make([]slog.Attr, 0, record.NumAttrs())
+	record.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	attrs, ok := errorTrackingAttrs(attrs)
+	if !ok {
+		return record
+	}
+	r := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	r.AddAttrs(attrs...)
+	return r
+}
@@ -2,9 +2,14 @@ package logging
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
 	"log/slog"
 	"testing"
 
+	"connectrpc.com/connect"
 	"github.com/stretchr/testify/require"
 )
 
@@ -31,3 +36,110 @@ func TestIgnoreErrorTracking(t *testing.T) {
 	log.With(slog.Any("aaa", "bbb")).With(IgnoreTracking).Error("aaa")
 	require.Equal(buf.String(), "")
 }
+
+func TestIgnoreErrorTrackingDoesNotPoisonParent(t *testing.T) {
+	require := require.New(t)
+	buf := bytes.Buffer{}
+	log := slog.New(NewErrorTracking(slog.NewTextHandler(&buf, nil)))
+
+	// 派生したロガーのIgnoreTrackingは元のロガーに影響しない
+	_ = log.With(IgnoreTracking)
+	log.Error("parent")
+	require.Contains(buf.String(), "msg=parent")
+}
+
+func TestIgnoreErrorTrackingPerRecord(t *testing.T) {
+	require := require.New(t)
+	buf := bytes.Buffer{}
+	log := slog.New(NewErrorTracking(slog.NewTextHandler(&buf, nil)))
+
+	log.Error("ignored", IgnoreTracking)
+	log.Error("tracked")
+	require.NotContains(buf.String(), "ignored")
+	require.Contains(buf.String(), "msg=tracked")
+}
+
+func TestErrorTrackingIgnoreErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []ErrorTrackingOption
+		attrs   []any
+		tracked bool
+	}{
+		{
+			name:    "エラーなし",
+			opts:    []ErrorTrackingOption{WithIgnoreErrors(context.Canceled)},
+			tracked: true,
+		},
+		{
+			name:    "errors.Isで一致",
+			opts:    []ErrorTrackingOption{WithIgnoreErrors(context.Canceled)},
+			attrs:   []any{slog.Any("error", fmt.Errorf("query: %w", context.Canceled))},
+			tracked: false,
+		},
+		{
+			name:    "Errの属性も判定する",
+			opts:    []ErrorTrackingOption{WithIgnoreErrors(context.DeadlineExceeded)},
+			attrs:   []any{Err(fmt.Errorf("query: %w", context.DeadlineExceeded))},
+			tracked: false,
+		},
+		{
+			name:    "一致しないエラー",
+			opts:    []ErrorTrackingOption{WithIgnoreErrors(context.Canceled)},
+			attrs:   []any{slog.Any("error", errors.New("boom"))},
+			tracked: true,
+		},
+		{
+			name:    "型で除外",
+			opts:    []ErrorTrackingOption{WithIgnoreErrorType[*fs.PathError]()},
+			attrs:   []any{slog.Any("error", fmt.Errorf("open: %w", &fs.PathError{Op: "open", Path: "a", Err: fs.ErrNotExist}))},
+			tracked: false,
+		},
+		{
+			name:    "送信する型に一致",
+			opts:    []ErrorTrackingOption{WithTrackErrorType[*fs.PathError]()},
+			attrs:   []any{slog.Any("error", &fs.PathError{Op: "open", Path: "a", Err: fs.ErrNotExist})},
+			tracked: true,
+		},
+		{
+			name:    "送信する型に一致しない",
+			opts:    []ErrorTrackingOption{WithTrackErrorType[*fs.PathError]()},
+			attrs:   []any{slog.Any("error", errors.New("boom"))},
+			tracked: false,
+		},
+		{
+			name:    "connectのコードで除外",
+			opts:    []ErrorTrackingOption{WithIgnoreConnectCodes(connect.CodeNotFound, connect.CodeInvalidArgument)},
+			attrs:   []any{slog.Any("error", fmt.Errorf("get user: %w", connect.NewError(connect.CodeNotFound, errors.New("not found"))))},
+			tracked: false,
+		},
+		{
+			name:    "connectのコードが一致しない",
+			opts:    []ErrorTrackingOption{WithIgnoreConnectCodes(connect.CodeNotFound)},
+			attrs:   []any{slog.Any("error", connect.NewError(connect.CodeInternal, errors.New("internal")))},
+			tracked: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := bytes.Buffer{}
+			log := slog.New(NewErrorTracking(slog.NewTextHandler(&buf, nil), tt.opts...))
+			log.Error("message", tt.attrs...)
+			require.Equal(t, tt.tracked, buf.Len() > 0, buf.String())
+		})
+	}
+}
+
+func TestErrorTrackingLoggerError(t *testing.T) {
+	require := require.New(t)
+	buf := bytes.Buffer{}
+	h := NewErrorTracking(slog.NewTextHandler(&buf, nil), WithIgnoreErrors(context.Canceled))
+	parent := slog.New(h)
+
+	// WithAttrsで指定したエラーも判定し、元のロガーには影響しない
+	child := parent.With(slog.Any("error", context.Canceled))
+	child.Error("child")
+	parent.Error("parent")
+	require.NotContains(buf.String(), "msg=child")
+	require.Contains(buf.String(), "msg=parent")
+}
@@ -0,0 +1,469 @@
+package logging
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	backupTimeFormat = "2006-01-02T15-04-05.000"
+	compressSuffix   = ".gz"
+)
+
+type FileConfig struct {
+	Filename       string        `yaml:"filename" env:"LOG_FILE"`
+	MaxSize        int64         `yaml:"maxSize"`
+	MaxBackups     int           `yaml:"maxBackups"`
+	MaxAge         time.Duration `yaml:"maxAge"`
+	RotateInterval time.Duration `yaml:"rotateInterval"`
+	Compress       bool          `yaml:"compress"`
+	ReopenOnSIGHUP bool          `yaml:"reopenOnSIGHUP"`
+}
+
+func (c *FileConfig) options() []FileOption {
+	opts := []FileOption{
+		WithMaxSize(c.MaxSize),
+		WithMaxBackups(c.MaxBackups),
+		WithMaxAge(c.MaxAge),
+		WithRotateInterval(c.RotateInterval),
+		WithCompress(c.Compress),
+	}
+	if c.ReopenOnSIGHUP {
+		opts = append(opts, WithReopenSignal(syscall.SIGHUP))
+	}
+	return opts
+}
+
+type FileOption interface {
+	apply(opt *fileOption)
+}
+
+type fileOptionFn func(opt *fileOption)
+
+func (fn fileOptionFn) apply(opt *fileOption) {
+	fn(opt)
+}
+
+type fileOption struct {
+	maxSize        int64
+	maxBackups     int
+	maxAge         time.Duration
+	rotateInterval time.Duration
+	compress       bool
+	signals        []os.Signal
+}
+
+// WithMaxSize はローテーションするファイルサイズ(byte)を指定する。0の場合はサイズでローテーションしない
+func WithMaxSize(size int64) FileOption {
+	return fileOptionFn(func(opt *fileOption) {
+		opt.maxSize = size
+	})
+}
+
+// WithMaxBackups は保持するバックアップ数を指定する。0の場合は全て保持する
+func WithMaxBackups(n int) FileOption {
+	return fileOptionFn(func(opt *fileOption) {
+		opt.maxBackups = n
+	})
+}
+
+// WithMaxAge はバックアップの保持期間を指定する。0の場合は期間で削除しない
+func WithMaxAge(age time.Duration) FileOption {
+	return fileOptionFn(func(opt *fileOption) {
+		opt.maxAge = age
+	})
+}
+
+// WithRotateInterval は一定時間毎にローテーションする。0の場合は時間でローテーションしない
+func WithRotateInterval(interval time.Duration) FileOption {
+	return fileOptionFn(func(opt *fileOption) {
+		opt.rotateInterval = interval
+	})
+}
+
+func WithCompress(compress bool) FileOption {
+	return fileOptionFn(func(opt *fileOption) {
+		opt.compress = compress
+	})
+}
+
+// WithReopenSignal はシグナルを受信したときにファイルを開き直す
+// logrotateなど外部でファイルを移動する場合に使う
+func WithReopenSignal(sigs ...os.Signal) FileOption {
+	return fileOptionFn(func(opt *fileOption) {
+		opt.signals = append(opt.signals, sigs...)
+	})
+}
+
+// WithFile はログの出力先をローテーションするファイルにする
+// ファイルは最初の書き込み時に開かれる
+// 出力先はハンドラーを作成する度に作り、NewのCloseか作成したハンドラーのCloseで閉じる
+func WithFile(filename string, opts ...FileOption) Option {
+	return optionFn(func(opt *option) {
+		w := newFileWriter(filename, opts...)
+		opt.writer = w
+		opt.closers = append(slices.Clip(opt.closers), w.Close)
+	})
+}
+
+type FileWriter struct {
+	filename string
+	option   fileOption
+	now      func() time.Time
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	closed   bool
+
+	millCh chan time.Time
+	millWg sync.WaitGroup
+	sigCh  chan os.Signal
+}
+
+var (
+	_ io.WriteCloser = (*FileWriter)(nil)
+)
+
+// NewFileWriter はサイズと時間でローテーションするファイルを開く
+func NewFileWriter(filename string, opts ...FileOption) (*FileWriter, error) {
+	w := newFileWriter(filename, opts...)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.openExistingOrNew(0); err != nil {
+		_ = w.close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func newFileWriter(filename string, opts ...FileOption) *FileWriter {
+	var o fileOption
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+	w := &FileWriter{
+		filename: filename,
+		option:   o,
+		now:      time.Now,
+		millCh:   make(chan time.Time, 1),
+	}
+	w.millWg.Add(1)
+	go w.millRun()
+	if len(o.signals) > 0 {
+		w.sigCh = make(chan os.Signal, 1)
+		signal.Notify(w.sigCh, o.signals...)
+		go func(ch <-chan os.Signal) {
+			for range ch {
+				_ = w.Reopen()
+			}
+		}(w.sigCh)
+	}
+	return w
+}
+
+func (w *FileWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	if w.file == nil {
+		if err := w.openExistingOrNew(len(p)); err != nil {
+			return 0, err
+		}
+	}
+	if w.shouldRotate(len(p)) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Rotate は現在のファイルをバックアップして新しいファイルを開く
+func (w *FileWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	return w.rotate()
+}
+
+// Reopen は現在のファイルを閉じ、次の書き込みで同じ名前のファイルを開き直す
+func (w *FileWriter) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closeFile()
+}
+
+func (w *FileWriter) Close() error {
+	w.mu.Lock()
+	err := w.close()
+	w.mu.Unlock()
+	w.millWg.Wait()
+	return err
+}
+
+func (w *FileWriter) close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.sigCh != nil {
+		signal.Stop(w.sigCh)
+		close(w.sigCh)
+	}
+	close(w.millCh)
+	return w.closeFile()
+}
+
+func (w *FileWriter) closeFile() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	w.size = 0
+	return err
+}
+
+func (w *FileWriter) shouldRotate(n int) bool {
+	if w.option.maxSize > 0 && w.size > 0 && w.size+int64(n) > w.option.maxSize {
+		return true
+	}
+	if w.option.rotateInterval > 0 && !w.now().Before(w.openedAt.Truncate(w.option.rotateInterval).Add(w.option.rotateInterval)) {
+		return true
+	}
+	return false
+}
+
+func (w *FileWriter) openExistingOrNew(n int) error {
+	info, err := os.Stat(w.filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return w.openNew()
+	}
+	if err != nil {
+		return err
+	}
+	if w.option.maxSize > 0 && info.Size()+int64(n) > w.option.maxSize {
+		return w.rotate()
+	}
+	file, err := os.OpenFile(w.filename, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return w.openNew()
+	}
+	w.file = file
+	w.size = info.Size()
+	w.openedAt = info.ModTime()
+	return nil
+}
+
+func (w *FileWriter) openNew() error {
+	if err := os.MkdirAll(filepath.Dir(w.filename), 0o755); err != nil {
+		return err
+	}
+	now := w.now()
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(w.filename); err == nil {
+		mode = info.Mode()
+		if err := os.Rename(w.filename, w.backupName(now)); err != nil {
+			return err
+		}
+	}
+	file, err := os.OpenFile(w.filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	w.file = file
+	w.size = 0
+	w.openedAt = now
+	return nil
+}
+
+func (w *FileWriter) rotate() error {
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+	if err := w.openNew(); err != nil {
+		return err
+	}
+	// 未処理の通知があれば最新の時刻に置き換える
+	select {
+	case w.millCh <- w.openedAt:
+	default:
+		select {
+		case <-w.millCh:
+		default:
+		}
+		w.millCh <- w.openedAt
+	}
+	return nil
+}
+
+func (w *FileWriter) prefixAndExt() (string, string) {
+	name := filepath.Base(w.filename)
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "-", ext
+}
+
+// backupName は同じ時刻のバックアップがあれば "-1" のような連番を付けた名前を返す
+func (w *FileWriter) backupName(t time.Time) string {
+	prefix, ext := w.prefixAndExt()
+	base := filepath.Join(filepath.Dir(w.filename), prefix+t.UTC().Format(backupTimeFormat))
+	name := base + ext
+	for seq := 1; fileExists(name) || fileExists(name+compressSuffix); seq++ {
+		name = base + "-" + strconv.Itoa(seq) + ext
+	}
+	return name
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+type backupFile struct {
+	path      string
+	timestamp time.Time
+	seq       int
+}
+
+func (w *FileWriter) backups() ([]backupFile, error) {
+	entries, err := os.ReadDir(filepath.Dir(w.filename))
+	if err != nil {
+		return nil, err
+	}
+	prefix, ext := w.prefixAndExt()
+	var backups []backupFile
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		ts := strings.TrimPrefix(name, prefix)
+		ts = strings.TrimSuffix(ts, compressSuffix)
+		if !strings.HasSuffix(ts, ext) {
+			continue
+		}
+		ts = strings.TrimSuffix(ts, ext)
+		if len(ts) < len(backupTimeFormat) {
+			continue
+		}
+		t, err := time.Parse(backupTimeFormat, ts[:len(backupTimeFormat)])
+		if err != nil {
+			continue
+		}
+		seq := 0
+		if rest := ts[len(backupTimeFormat):]; rest != "" {
+			n, err := strconv.Atoi(strings.TrimPrefix(rest, "-"))
+			if err != nil || !strings.HasPrefix(rest, "-") || n <= 0 {
+				continue
+			}
+			seq = n
+		}
+		backups = append(backups, backupFile{
+			path:      filepath.Join(filepath.Dir(w.filename), name),
+			timestamp: t,
+			seq:       seq,
+		})
+	}
+	// 新しい順。同じ時刻は連番の大きいものが新しい
+	slices.SortFunc(backups, func(a, b backupFile) int {
+		if c := b.timestamp.Compare(a.timestamp); c != 0 {
+			return c
+		}
+		return b.seq - a.seq
+	})
+	return backups, nil
+}
+
+func (w *FileWriter) millRun() {
+	defer w.millWg.Done()
+	for now := range w.millCh {
+		_ = w.mill(now)
+	}
+}
+
+// mill は古いバックアップを削除し、残ったバックアップを圧縮する
+func (w *FileWriter) mill(now time.Time) error {
+	if w.option.maxBackups == 0 && w.option.maxAge == 0 && !w.option.compress {
+		return nil
+	}
+	backups, err := w.backups()
+	if err != nil {
+		return err
+	}
+	var (
+		remaining []backupFile
+		errs      error
+	)
+	cutoff := now.Add(-w.option.maxAge)
+	for i, b := range backups {
+		if (w.option.maxBackups > 0 && i >= w.option.maxBackups) ||
+			(w.option.maxAge > 0 && b.timestamp.Before(cutoff)) {
+			errs = errors.Join(errs, os.Remove(b.path))
+			continue
+		}
+		remaining = append(remaining, b)
+	}
+	if w.option.compress {
+		for _, b := range remaining {
+			if !strings.HasSuffix(b.path, compressSuffix) {
+				errs = errors.Join(errs, compressFile(b.path))
+			}
+		}
+	}
+	return errs
+}
+
+func compressFile(path string) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(path+compressSuffix, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(path + compressSuffix)
+		}
+	}()
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err = gz.Close(); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
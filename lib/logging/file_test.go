@@ -0,0 +1,280 @@
+package logging
+
+import (
+	"compress/gzip"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// テスト用に時刻を進められる時計
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func readGzipFile(t *testing.T, path string) string {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	b, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func backupNames(t *testing.T, w *FileWriter) []string {
+	t.Helper()
+	backups, err := w.backups()
+	require.NoError(t, err)
+	names := make([]string, 0, len(backups))
+	for _, b := range backups {
+		names = append(names, filepath.Base(b.path))
+	}
+	return names
+}
+
+func TestFileWriter(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "logs", "app.log")
+	w, err := NewFileWriter(filename)
+	require.NoError(t, err)
+
+	_, err = w.Write([]byte("line1\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.Equal(t, "line1\n", readFile(t, filename))
+
+	// Close後は書き込めない
+	_, err = w.Write([]byte("line2\n"))
+	require.ErrorIs(t, err, os.ErrClosed)
+
+	// 既存のファイルには追記する
+	w, err = NewFileWriter(filename)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("line2\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.Equal(t, "line1\nline2\n", readFile(t, filename))
+}
+
+func TestFileWriterMaxSize(t *testing.T) {
+	clock := newFakeClock()
+	filename := filepath.Join(t.TempDir(), "app.log")
+	w := newFileWriter(filename, WithMaxSize(10), WithMaxBackups(2))
+	w.now = clock.Now
+
+	for _, line := range []string{"1234567\n", "abcdefg\n", "ABCDEFG\n", "!@#$%^&\n"} {
+		clock.Add(time.Second)
+		_, err := w.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	require.Equal(t, "!@#$%^&\n", readFile(t, filename))
+	require.Equal(t, []string{
+		"app-2026-01-01T00-00-04.000.log",
+		"app-2026-01-01T00-00-03.000.log",
+	}, backupNames(t, w))
+	require.Equal(t, "ABCDEFG\n", readFile(t, filepath.Join(filepath.Dir(filename), "app-2026-01-01T00-00-04.000.log")))
+}
+
+func TestFileWriterRotateSameTime(t *testing.T) {
+	clock := newFakeClock()
+	filename := filepath.Join(t.TempDir(), "app.log")
+	w := newFileWriter(filename)
+	w.now = clock.Now
+
+	// 同じ時刻にローテーションしてもバックアップを上書きしない
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		_, err := w.Write([]byte(line))
+		require.NoError(t, err)
+		require.NoError(t, w.Rotate())
+	}
+	require.NoError(t, w.Close())
+
+	require.Equal(t, []string{
+		"app-2026-01-01T00-00-00.000-2.log",
+		"app-2026-01-01T00-00-00.000-1.log",
+		"app-2026-01-01T00-00-00.000.log",
+	}, backupNames(t, w))
+	dir := filepath.Dir(filename)
+	require.Equal(t, "first\n", readFile(t, filepath.Join(dir, "app-2026-01-01T00-00-00.000.log")))
+	require.Equal(t, "second\n", readFile(t, filepath.Join(dir, "app-2026-01-01T00-00-00.000-1.log")))
+	require.Equal(t, "third\n", readFile(t, filepath.Join(dir, "app-2026-01-01T00-00-00.000-2.log")))
+
+	// 連番の付いたバックアップも古いものから削除する
+	w = newFileWriter(filename, WithMaxBackups(2))
+	require.NoError(t, w.mill(clock.Now()))
+	require.NoError(t, w.Close())
+	require.Equal(t, []string{
+		"app-2026-01-01T00-00-00.000-2.log",
+		"app-2026-01-01T00-00-00.000-1.log",
+	}, backupNames(t, w))
+}
+
+func TestFileWriterRotateInterval(t *testing.T) {
+	clock := newFakeClock()
+	filename := filepath.Join(t.TempDir(), "app.log")
+	w := newFileWriter(filename, WithRotateInterval(time.Hour))
+	w.now = clock.Now
+
+	_, err := w.Write([]byte("first\n"))
+	require.NoError(t, err)
+	clock.Add(30 * time.Minute)
+	_, err = w.Write([]byte("second\n"))
+	require.NoError(t, err)
+	clock.Add(30 * time.Minute)
+	_, err = w.Write([]byte("third\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	require.Equal(t, "third\n", readFile(t, filename))
+	require.Equal(t, []string{"app-2026-01-01T01-00-00.000.log"}, backupNames(t, w))
+}
+
+func TestFileWriterCompressAndMaxAge(t *testing.T) {
+	clock := newFakeClock()
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	w := newFileWriter(filename, WithCompress(true), WithMaxAge(24*time.Hour))
+	w.now = clock.Now
+
+	_, err := w.Write([]byte("old\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Rotate())
+	clock.Add(48 * time.Hour)
+	_, err = w.Write([]byte("new\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Rotate())
+	require.NoError(t, w.Close())
+
+	// 保持期間を過ぎたバックアップは削除され、残りは圧縮される
+	require.Equal(t, []string{"app-2026-01-03T00-00-00.000.log.gz"}, backupNames(t, w))
+	require.Equal(t, "new\n", readGzipFile(t, filepath.Join(dir, "app-2026-01-03T00-00-00.000.log.gz")))
+	require.Empty(t, readFile(t, filename))
+}
+
+func TestFileWriterReopen(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	w, err := NewFileWriter(filename)
+	require.NoError(t, err)
+	defer w.Close()
+
+	_, err = w.Write([]byte("before\n"))
+	require.NoError(t, err)
+
+	// logrotateのように外部でファイルを移動する
+	moved := filepath.Join(dir, "app.log.1")
+	require.NoError(t, os.Rename(filename, moved))
+	require.NoError(t, w.Reopen())
+
+	_, err = w.Write([]byte("after\n"))
+	require.NoError(t, err)
+	require.Equal(t, "before\n", readFile(t, moved))
+	require.Equal(t, "after\n", readFile(t, filename))
+}
+
+func TestFileWriterReopenSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SIGHUP is not supported")
+	}
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "app.log")
+	w, err := NewFileWriter(filename, WithReopenSignal(syscall.SIGHUP))
+	require.NoError(t, err)
+	defer w.Close()
+
+	moved := filepath.Join(dir, "app.log.1")
+	require.NoError(t, os.Rename(filename, moved))
+	p, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	require.NoError(t, p.Signal(syscall.SIGHUP))
+	require.Eventually(t, func() bool {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return w.file == nil
+	}, time.Second, 10*time.Millisecond)
+
+	_, err = w.Write([]byte("after\n"))
+	require.NoError(t, err)
+	require.Equal(t, "after\n", readFile(t, filename))
+}
+
+func TestWithFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	withFile := WithFile(filename)
+	h := NewJSONHandler(withFile).(*leveledHandler)
+	w, ok := h.option.writer.(*FileWriter)
+	require.True(t, ok)
+	// オプションを適用する度に出力先を作成する
+	other := NewJSONHandler(withFile).(*leveledHandler)
+	require.NotSame(t, w, other.option.writer)
+	require.NoError(t, other.Close())
+
+	// 最初の書き込みでファイルが作られる
+	_, err := os.Stat(filename)
+	require.ErrorIs(t, err, os.ErrNotExist)
+	slog.New(h).Info("file message")
+	require.Contains(t, readFile(t, filename), "\"msg\":\"file message\"")
+
+	// ハンドラーのCloseで出力先を閉じる。WithAttrsの子ハンドラーも同じ出力先を閉じる
+	require.NoError(t, h.WithAttrs([]slog.Attr{slog.String("key", "value")}).(io.Closer).Close())
+	_, err = w.Write([]byte("after close\n"))
+	require.ErrorIs(t, err, os.ErrClosed)
+}
+
+func TestNewWithFileOption(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	h, err := New(Config{Handlers: []LoggingHandle{JsonHandler, TextHandler}}, WithFile(filename))
+	require.NoError(t, err)
+
+	log := slog.New(h)
+	log.Info("option file message")
+	require.NoError(t, h.Close())
+	// JSONとテキストのハンドラーが同じファイルに出力する
+	output := readFile(t, filename)
+	require.Contains(t, output, "\"msg\":\"option file message\"")
+	require.Contains(t, output, "msg=\"option file message\"")
+
+	// NewのCloseでファイルも閉じる
+	log.Info("after close")
+	require.NotContains(t, readFile(t, filename), "after close")
+}
+
+func TestNewWithFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+	h, err := New(Config{File: &FileConfig{Filename: filename, MaxSize: 1024}})
+	require.NoError(t, err)
+
+	slog.New(h).Info("config file message")
+	require.NoError(t, h.Close())
+	require.Contains(t, readFile(t, filename), "\"msg\":\"config file message\"")
+}
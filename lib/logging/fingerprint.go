@@ -0,0 +1,44 @@
+package logging
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// FingerprintKey はエラー追跡サービスでイベントをまとめるキーの属性名
+// slog-sentryと同じキーにしている
+const FingerprintKey = "fingerprint"
+
+// Fingerprint はSentryやRollbarで同じイベントとしてまとめるキーを指定する
+// 指定しなければ各サービスの既定の方法でまとめる
+//
+//	slog.Error("failed to fetch user", logging.Fingerprint("fetch-user", "timeout"))
+func Fingerprint(keys ...string) slog.Attr {
+	return slog.Any(FingerprintKey, keys)
+}
+
+// MessageNormalizer はメッセージからIDなどの可変部分を取り除く
+// 正規化したメッセージをフィンガープリントに使う
+type MessageNormalizer func(msg string) string
+
+var (
+	uuidPattern   = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+	quotedPattern = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`)
+	numberPattern = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+)
+
+// DefaultMessageNormalizer はUUID、引用符で囲まれた文字列、数値を置き換える
+func DefaultMessageNormalizer(msg string) string {
+	msg = uuidPattern.ReplaceAllString(msg, "<uuid>")
+	msg = quotedPattern.ReplaceAllString(msg, "<str>")
+	return numberPattern.ReplaceAllString(msg, "<num>")
+}
+
+// fingerprintHash はRollbarのfingerprint(40文字以内)に収まるようにハッシュにする
+func fingerprintHash(keys []string) string {
+	sum := sha1.Sum([]byte(strings.Join(keys, "\n")))
+	return hex.EncodeToString(sum[:])
+}
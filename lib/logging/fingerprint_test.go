@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprint(t *testing.T) {
+	attr := Fingerprint("fetch-user", "timeout")
+	require.Equal(t, FingerprintKey, attr.Key)
+	require.Equal(t, []string{"fetch-user", "timeout"}, attr.Value.Any())
+}
+
+func TestDefaultMessageNormalizer(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		want string
+	}{
+		{
+			name: "uuid",
+			msg:  "user 3F2504E0-4F89-11D3-9A0C-0305E82C3301 not found",
+			want: "user <uuid> not found",
+		},
+		{
+			name: "number",
+			msg:  "order 12345 failed after 1.5 seconds",
+			want: "order <num> failed after <num> seconds",
+		},
+		{
+			name: "quoted",
+			msg:  `unknown key "user-\"1\"" in 'config.yaml'`,
+			want: "unknown key <str> in <str>",
+		},
+		{
+			name: "word with digits",
+			msg:  "oauth2 token expired",
+			want: "oauth2 token expired",
+		},
+		{
+			name: "same failure",
+			msg:  "user 7c9e6679-7425-40de-944b-e07fc1f90ae7 not found",
+			want: "user <uuid> not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, DefaultMessageNormalizer(tt.msg))
+		})
+	}
+}
+
+func TestFingerprintHash(t *testing.T) {
+	// Rollbarのfingerprintの上限の40文字に収まる
+	hash := fingerprintHash([]string{"a", "b"})
+	require.Len(t, hash, 40)
+	require.Equal(t, hash, fingerprintHash([]string{"a", "b"}))
+	require.NotEqual(t, hash, fingerprintHash([]string{"ab"}))
+}
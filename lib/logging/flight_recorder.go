@@ -0,0 +1,420 @@
+package logging
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultFlightRecorderSize    = 100
+	defaultFlightRecorderTTL     = time.Minute
+	defaultFlightRecorderMaxKeys = 1000
+)
+
+type FlightRecorderOption interface {
+	apply(opt *flightRecorderOption)
+}
+
+type flightRecorderOptionFn func(opt *flightRecorderOption)
+
+func (fn flightRecorderOptionFn) apply(opt *flightRecorderOption) {
+	fn(opt)
+}
+
+type flightRecorderOption struct {
+	size    int
+	level   slog.Leveler
+	trigger slog.Leveler
+	keys    []string
+	ttl     time.Duration
+	maxKeys int
+}
+
+// WithFlightRecorderSize はキー毎に保持するレコードの数を指定する。デフォルトは100
+// 超えた場合は古いものから破棄する
+func WithFlightRecorderSize(n int) FlightRecorderOption {
+	return flightRecorderOptionFn(func(opt *flightRecorderOption) {
+		opt.size = n
+	})
+}
+
+// WithFlightRecorderLevel は保持するレコードの最小のレベルを指定する。デフォルトはDEBUG
+func WithFlightRecorderLevel(level slog.Leveler) FlightRecorderOption {
+	return flightRecorderOptionFn(func(opt *flightRecorderOption) {
+		opt.level = level
+	})
+}
+
+// WithFlightRecorderTrigger は保持したレコードを出力するレベルを指定する。デフォルトはERROR
+func WithFlightRecorderTrigger(level slog.Leveler) FlightRecorderOption {
+	return flightRecorderOptionFn(func(opt *flightRecorderOption) {
+		opt.trigger = level
+	})
+}
+
+// WithFlightRecorderKeys はAppendCtxで追加された属性のうち、レコードをまとめるキーを指定する
+// デフォルトは "request-id"。いずれもなければトレースIDでまとめる
+func WithFlightRecorderKeys(keys ...string) FlightRecorderOption {
+	return flightRecorderOptionFn(func(opt *flightRecorderOption) {
+		opt.keys = keys
+	})
+}
+
+// WithFlightRecorderTTL は最後のレコードからこの期間が過ぎたキーのレコードを破棄する。デフォルトは1分
+func WithFlightRecorderTTL(ttl time.Duration) FlightRecorderOption {
+	return flightRecorderOptionFn(func(opt *flightRecorderOption) {
+		opt.ttl = ttl
+	})
+}
+
+// WithFlightRecorderMaxKeys は保持するキーの数の上限を指定する。デフォルトは1000
+// 上限を超えると最も古く使われたキーのレコードを破棄する
+func WithFlightRecorderMaxKeys(n int) FlightRecorderOption {
+	return flightRecorderOptionFn(func(opt *flightRecorderOption) {
+		opt.maxKeys = n
+	})
+}
+
+type flightRecord struct {
+	// ctx はレコードを保持したときのコンテキスト。キャンセルは引き継がない
+	ctx     context.Context
+	record  slog.Record
+	handler slog.Handler
+}
+
+// flightBuffer はキー毎のリングバッファ
+type flightBuffer struct {
+	key     string
+	last    time.Time
+	records []flightRecord
+	next    int
+}
+
+func (b *flightBuffer) add(r flightRecord, size int) {
+	if len(b.records) < size {
+		b.records = append(b.records, r)
+		return
+	}
+	b.records[b.next] = r
+	b.next = (b.next + 1) % size
+}
+
+// drain は古い順にレコードを返す
+func (b *flightBuffer) drain() []flightRecord {
+	records := append(slices.Clone(b.records[b.next:]), b.records[:b.next]...)
+	b.records, b.next = nil, 0
+	return records
+}
+
+type flightRecorder struct {
+	option flightRecorderOption
+	now    func() time.Time
+
+	mu      sync.Mutex
+	buffers map[string]*list.Element
+	// lru は最近使われたものが先頭
+	lru *list.List
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type flightScopeKey struct{}
+
+// flightScope はリクエストのレコードを保持したフライトレコーダーとキーを記録する
+type flightScope struct {
+	mu      sync.Mutex
+	entries map[flightScopeEntry]struct{}
+}
+
+type flightScopeEntry struct {
+	recorder *flightRecorder
+	key      string
+}
+
+// WithFlightRecorderScope はリクエスト毎にDiscardFlightRecordsで破棄するレコードを記録するスコープをコンテキストに設定する
+// コンテキストに既にスコープがあればそのまま返す
+func WithFlightRecorderScope(ctx context.Context) context.Context {
+	if flightScopeFrom(ctx) != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, flightScopeKey{}, &flightScope{entries: map[flightScopeEntry]struct{}{}})
+}
+
+func flightScopeFrom(ctx context.Context) *flightScope {
+	if ctx == nil {
+		return nil
+	}
+	scope, _ := ctx.Value(flightScopeKey{}).(*flightScope)
+	return scope
+}
+
+// DiscardFlightRecords はWithFlightRecorderScopeのスコープで保持したレコードをフライトレコーダーから破棄する
+// リクエストが正常に終わったときに呼び出す。スコープがなければTTLで破棄されるまで保持する
+func DiscardFlightRecords(ctx context.Context) {
+	scope := flightScopeFrom(ctx)
+	if scope == nil {
+		return
+	}
+	scope.mu.Lock()
+	entries := scope.entries
+	scope.entries = map[flightScopeEntry]struct{}{}
+	scope.mu.Unlock()
+	for e := range entries {
+		e.recorder.discard(e.key)
+	}
+}
+
+func (s *flightScope) add(fr *flightRecorder, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[flightScopeEntry{recorder: fr, key: key}] = struct{}{}
+}
+
+// key はAppendCtxで追加された属性、なければトレースIDからキーを返す
+func (fr *flightRecorder) key(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	attrs := AttrsFromContext(ctx)
+	for _, key := range fr.option.keys {
+		// 後から追加された属性を優先する
+		for _, a := range slices.Backward(attrs) {
+			if a.Key == key {
+				return key + "=" + a.Value.Resolve().String(), true
+			}
+		}
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		return "trace_id=" + sc.TraceID().String(), true
+	}
+	return "", false
+}
+
+func (fr *flightRecorder) record(key string, r flightRecord) {
+	now := fr.now()
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	var buf *flightBuffer
+	if e, ok := fr.buffers[key]; ok {
+		buf = e.Value.(*flightBuffer)
+		fr.lru.MoveToFront(e)
+	} else {
+		buf = &flightBuffer{key: key}
+		fr.buffers[key] = fr.lru.PushFront(buf)
+		for fr.lru.Len() > fr.option.maxKeys {
+			fr.remove(fr.lru.Back())
+		}
+	}
+	buf.last = now
+	buf.add(r, fr.option.size)
+}
+
+// flush はキーで保持しているレコードを取り出す
+func (fr *flightRecorder) flush(key string) []flightRecord {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	e, ok := fr.buffers[key]
+	if !ok {
+		return nil
+	}
+	return fr.remove(e).drain()
+}
+
+func (fr *flightRecorder) discard(key string) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	if e, ok := fr.buffers[key]; ok {
+		fr.remove(e)
+	}
+}
+
+func (fr *flightRecorder) remove(e *list.Element) *flightBuffer {
+	buf := fr.lru.Remove(e).(*flightBuffer)
+	delete(fr.buffers, buf.key)
+	return buf
+}
+
+// expire は最後のレコードからTTLが過ぎたキーのレコードを破棄する
+func (fr *flightRecorder) expire() {
+	now := fr.now()
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	for e := fr.lru.Back(); e != nil; {
+		prev := e.Prev()
+		if now.Sub(e.Value.(*flightBuffer).last) < fr.option.ttl {
+			// 後ろほど古いので、これより前は期限内
+			break
+		}
+		fr.remove(e)
+		e = prev
+	}
+}
+
+func (fr *flightRecorder) run() {
+	defer close(fr.done)
+	ticker := time.NewTicker(max(fr.option.ttl/2, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			fr.expire()
+		case <-fr.stop:
+			return
+		}
+	}
+}
+
+func (fr *flightRecorder) close() {
+	fr.closeOnce.Do(func() {
+		close(fr.stop)
+		<-fr.done
+		fr.mu.Lock()
+		defer fr.mu.Unlock()
+		fr.buffers = map[string]*list.Element{}
+		fr.lru.Init()
+	})
+}
+
+type replayKey struct{}
+
+// isReplay はフライトレコーダーが保持したレコードを出力しているかを返す
+func isReplay(ctx context.Context) bool {
+	replay, _ := ctx.Value(replayKey{}).(bool)
+	return replay
+}
+
+// replayTarget はレベルだけでEnabledを判定するハンドラー
+// フライトレコーダーが保持したレコードはレベル未満でも出力する
+type replayTarget interface {
+	acceptReplay()
+}
+
+// replayEnabled はNewHandlerやNewRouterが子ハンドラーにレコードを渡すかを返す
+// 保持したレコードはreplayTargetの子ハンドラーだけに渡し、SentryやRollbarなどは自身のレベルに従う
+func replayEnabled(ctx context.Context, h slog.Handler, level slog.Level) bool {
+	if h.Enabled(ctx, level) {
+		return true
+	}
+	_, ok := h.(replayTarget)
+	return ok && isReplay(ctx)
+}
+
+// replayHandler はフライトレコーダーが保持したレコードを出力するときにコンテキストに印を付ける
+type replayHandler struct {
+	slog.Handler
+}
+
+func (h *replayHandler) Handle(ctx context.Context, record slog.Record) error {
+	return h.Handler.Handle(context.WithValue(ctx, replayKey{}, true), record)
+}
+
+type flightRecorderHandler struct {
+	slog.Handler
+	recorder *flightRecorder
+}
+
+var (
+	_ Handle = (*flightRecorderHandler)(nil)
+)
+
+// NewFlightRecorderHandler はハンドラーが出力しないレベルのレコードをコンテキストのキー毎に直近のものだけメモリに保持する
+// 同じキーでERRORのレコードを出力したときに保持したレコードを先に出力し、それ以外は破棄する
+// キーはAppendCtxで追加されたリクエストID、なければトレースIDを使う。キーがなければ保持しない
+// DiscardFlightRecordsはWithFlightRecorderScopeを設定したコンテキストで保持したレコードだけを破棄する
+//
+//	h := logging.NewFlightRecorderHandler(logging.NewJSONHandler(logging.WithLevel(slog.LevelInfo)))
+//	ctx = logging.AppendCtx(logging.WithFlightRecorderScope(ctx), slog.String("request-id", id))
+//	defer logging.DiscardFlightRecords(ctx)
+func NewFlightRecorderHandler(handler slog.Handler, opts ...FlightRecorderOption) Handle {
+	o := flightRecorderOption{
+		size:    defaultFlightRecorderSize,
+		level:   slog.LevelDebug,
+		trigger: slog.LevelError,
+		keys:    []string{"request-id"},
+		ttl:     defaultFlightRecorderTTL,
+		maxKeys: defaultFlightRecorderMaxKeys,
+	}
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+	fr := &flightRecorder{
+		option:  o,
+		now:     time.Now,
+		buffers: map[string]*list.Element{},
+		lru:     list.New(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go fr.run()
+	return &flightRecorderHandler{Handler: handler, recorder: fr}
+}
+
+func (h *flightRecorderHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if h.Handler.Enabled(ctx, level) {
+		return true
+	}
+	if level < h.recorder.option.level.Level() || h.recorder.option.size <= 0 {
+		return false
+	}
+	_, ok := h.recorder.key(ctx)
+	return ok
+}
+
+func (h *flightRecorderHandler) Handle(ctx context.Context, record slog.Record) error {
+	key, ok := h.recorder.key(ctx)
+	if !ok || isReplay(ctx) {
+		if !h.Handler.Enabled(ctx, record.Level) {
+			return nil
+		}
+		return h.Handler.Handle(ctx, record)
+	}
+	var errs []error
+	if record.Level >= h.recorder.option.trigger.Level() {
+		// 保持したレコードはそのときのWithAttrs/WithGroupのハンドラーとコンテキストで出力する
+		for _, r := range h.recorder.flush(key) {
+			errs = append(errs, r.handler.Handle(r.ctx, r.record))
+		}
+	}
+	if h.Handler.Enabled(ctx, record.Level) {
+		errs = append(errs, h.Handler.Handle(ctx, record))
+		return errors.Join(errs...)
+	}
+	if record.Level >= h.recorder.option.level.Level() && h.recorder.option.size > 0 {
+		if scope := flightScopeFrom(ctx); scope != nil {
+			scope.add(h.recorder, key)
+		}
+		h.recorder.record(key, flightRecord{
+			ctx:     context.WithoutCancel(ctx),
+			record:  record.Clone(),
+			handler: &replayHandler{Handler: h.Handler},
+		})
+	}
+	return errors.Join(errs...)
+}
+
+func (h *flightRecorderHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &flightRecorderHandler{Handler: h.Handler.WithAttrs(attrs), recorder: h.recorder}
+}
+
+func (h *flightRecorderHandler) WithGroup(name string) slog.Handler {
+	return &flightRecorderHandler{Handler: h.Handler.WithGroup(name), recorder: h.recorder}
+}
+
+func (h *flightRecorderHandler) Close() error {
+	h.recorder.close()
+	if v, ok := h.Handler.(io.Closer); ok {
+		return v.Close()
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTestFlightRecorderHandler(buf *bytes.Buffer, clock *fakeClock, opts ...FlightRecorderOption) *flightRecorderHandler {
+	h := NewFlightRecorderHandler(NewTextHandler(WithWriter(buf), WithLevel(slog.LevelInfo)), opts...).(*flightRecorderHandler)
+	h.recorder.now = clock.Now
+	return h
+}
+
+// onlyMessages はテキストハンドラーの出力からメッセージだけをカンマ区切りで返す
+func onlyMessages(s string) string {
+	var msgs []string
+	for _, line := range strings.Split(strings.TrimSpace(s), "\n") {
+		_, after, ok := strings.Cut(line, " msg=")
+		if !ok {
+			continue
+		}
+		if strings.HasPrefix(after, `"`) {
+			msg, _ := strconv.QuotedPrefix(after)
+			msg, _ = strconv.Unquote(msg)
+			msgs = append(msgs, msg)
+			continue
+		}
+		msg, _, _ := strings.Cut(after, " ")
+		msgs = append(msgs, msg)
+	}
+	return strings.Join(msgs, ",")
+}
+
+func TestFlightRecorderHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	h := newTestFlightRecorderHandler(buf, newFakeClock())
+	defer h.Close()
+	log := slog.New(h)
+
+	ctx1 := AppendCtx(context.Background(), slog.String("request-id", "r1"))
+	ctx2 := AppendCtx(WithFlightRecorderScope(context.Background()), slog.String("request-id", "r2"))
+	log.DebugContext(ctx1, "step 1")
+	log.DebugContext(ctx2, "other request")
+	log.InfoContext(ctx1, "started")
+	log.With(slog.String("user", "u1")).WithGroup("db").DebugContext(ctx1, "step 2", slog.String("table", "users"))
+	// INFO以上はそのまま出力し、DEBUGは保持する
+	require.Equal(t, "started", onlyMessages(buf.String()))
+
+	log.ErrorContext(ctx1, "failed")
+	// 同じキーのレコードを古い順にエラーの前に出力する
+	require.Equal(t, "started,step 1,step 2,failed", onlyMessages(buf.String()))
+	require.Contains(t, buf.String(), "msg=\"step 2\" user=u1 db.table=users")
+	require.NotContains(t, buf.String(), "other request")
+
+	// 出力したレコードは再び出力しない
+	buf.Reset()
+	log.ErrorContext(ctx1, "failed again")
+	require.Equal(t, "failed again", onlyMessages(buf.String()))
+
+	// 正常に終わったリクエストのレコードは破棄する
+	DiscardFlightRecords(ctx2)
+	buf.Reset()
+	log.ErrorContext(ctx2, "failed")
+	require.Equal(t, "failed", onlyMessages(buf.String()))
+}
+
+func TestFlightRecorderHandlerMultiHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler func(t *testing.T, buf *bytes.Buffer) slog.Handler
+	}{
+		{
+			name: "NewHandler",
+			handler: func(t *testing.T, buf *bytes.Buffer) slog.Handler {
+				return NewHandler(NewTextHandler(WithWriter(buf), WithLevel(slog.LevelInfo)))
+			},
+		},
+		{
+			name: "New",
+			handler: func(t *testing.T, buf *bytes.Buffer) slog.Handler {
+				restoreDefaultLevel(t)
+				h, err := New(Config{Level: NewLevel(slog.LevelInfo), Handlers: []LoggingHandle{TextHandler}}, WithWriter(buf))
+				require.NoError(t, err)
+				return h
+			},
+		},
+		{
+			name: "NewRouter",
+			handler: func(t *testing.T, buf *bytes.Buffer) slog.Handler {
+				return NewRouter(WithDefaultRoute(NewTextHandler(WithWriter(buf), WithLevel(slog.LevelInfo))))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			h := NewFlightRecorderHandler(tt.handler(t, buf))
+			defer h.Close()
+			log := slog.New(h)
+
+			ctx := AppendCtx(context.Background(), slog.String("request-id", "r1"))
+			log.DebugContext(ctx, "step")
+			require.Empty(t, buf.String())
+			// 子ハンドラーのレベル未満でも保持したレコードは出力する
+			log.ErrorContext(ctx, "failed")
+			require.Equal(t, "step,failed", onlyMessages(buf.String()))
+
+			// 保持していないレコードは子ハンドラーのレベルに従う
+			buf.Reset()
+			log.DebugContext(context.Background(), "without key")
+			require.Empty(t, buf.String())
+		})
+	}
+}
+
+func TestFlightRecorderHandlerReplayLevel(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tracker := &recordingHandler{}
+	h := NewFlightRecorderHandler(NewHandler(
+		NewTextHandler(WithWriter(buf), WithLevel(slog.LevelInfo)),
+		tracker,
+	))
+	defer h.Close()
+	log := slog.New(h)
+
+	ctx := AppendCtx(context.Background(), slog.String("request-id", "r1"))
+	log.DebugContext(ctx, "step")
+	log.ErrorContext(ctx, "failed")
+
+	// LevelForで判定しないハンドラーには保持したレコードを渡さない
+	require.Equal(t, "step,failed", onlyMessages(buf.String()))
+	require.Equal(t, []string{"failed"}, tracker.messages)
+}
+
+// recordingHandler はERROR以上のレコードのメッセージを記録する
+type recordingHandler struct {
+	messages []string
+}
+
+func (h *recordingHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= slog.LevelError
+}
+
+func (h *recordingHandler) Handle(_ context.Context, record slog.Record) error {
+	h.messages = append(h.messages, record.Message)
+	return nil
+}
+
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *recordingHandler) WithGroup(string) slog.Handler { return h }
+
+func TestFlightRecorderHandlerSize(t *testing.T) {
+	buf := &bytes.Buffer{}
+	h := newTestFlightRecorderHandler(buf, newFakeClock(), WithFlightRecorderSize(3))
+	defer h.Close()
+	log := slog.New(h)
+
+	ctx := AppendCtx(context.Background(), slog.String("request-id", "r1"))
+	for _, msg := range []string{"a", "b", "c", "d", "e"} {
+		log.DebugContext(ctx, msg)
+	}
+	log.ErrorContext(ctx, "failed")
+	// 直近の3件だけ出力する
+	require.Equal(t, "c,d,e,failed", onlyMessages(buf.String()))
+}
+
+func TestFlightRecorderHandlerLevels(t *testing.T) {
+	buf := &bytes.Buffer{}
+	h := newTestFlightRecorderHandler(buf, newFakeClock(),
+		WithFlightRecorderLevel(LevelTrace),
+		WithFlightRecorderTrigger(slog.LevelWarn),
+	)
+	defer h.Close()
+	log := slog.New(h)
+
+	ctx := AppendCtx(context.Background(), slog.String("request-id", "r1"))
+	require.True(t, h.Enabled(ctx, LevelTrace))
+	require.False(t, h.Enabled(ctx, LevelTrace-1))
+	// キーがなければハンドラーのレベルに従う
+	require.False(t, h.Enabled(context.Background(), slog.LevelDebug))
+
+	log.Log(ctx, LevelTrace, "trace")
+	log.DebugContext(context.Background(), "without key")
+	log.WarnContext(ctx, "warn")
+	require.Equal(t, "trace,warn", onlyMessages(buf.String()))
+}
+
+func TestFlightRecorderHandlerKeys(t *testing.T) {
+	buf := &bytes.Buffer{}
+	h := newTestFlightRecorderHandler(buf, newFakeClock(), WithFlightRecorderKeys("session"))
+	defer h.Close()
+	log := slog.New(h)
+
+	ctx := AppendCtx(context.Background(), slog.String("request-id", "r1"), slog.String("session", "s1"))
+	log.DebugContext(ctx, "session step")
+	log.ErrorContext(AppendCtx(context.Background(), slog.String("session", "s1")), "failed")
+	require.Equal(t, "session step,failed", onlyMessages(buf.String()))
+
+	// 属性がなければトレースIDでまとめる
+	buf.Reset()
+	traceCtx := newTestSpanContext(t, true)
+	log.DebugContext(traceCtx, "traced step")
+	log.ErrorContext(trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(traceCtx)), "failed")
+	require.Equal(t, "traced step,failed", onlyMessages(buf.String()))
+}
+
+func TestFlightRecorderHandlerExpire(t *testing.T) {
+	buf := &bytes.Buffer{}
+	clock := newFakeClock()
+	h := newTestFlightRecorderHandler(buf, clock, WithFlightRecorderTTL(time.Minute), WithFlightRecorderMaxKeys(2))
+	defer h.Close()
+	log := slog.New(h)
+
+	ctx := func(id string) context.Context {
+		return AppendCtx(context.Background(), slog.String("request-id", id))
+	}
+	log.DebugContext(ctx("r1"), "r1 step")
+	clock.Add(30 * time.Second)
+	log.DebugContext(ctx("r2"), "r2 step")
+	clock.Add(30 * time.Second)
+	// 最後のレコードからTTLが過ぎたキーだけ破棄する
+	h.recorder.expire()
+	log.ErrorContext(ctx("r1"), "r1 failed")
+	log.ErrorContext(ctx("r2"), "r2 failed")
+	require.Equal(t, "r1 failed,r2 step,r2 failed", onlyMessages(buf.String()))
+
+	// 上限を超えると最も古く使われたキーを破棄する
+	buf.Reset()
+	log.DebugContext(ctx("r3"), "r3 step")
+	log.DebugContext(ctx("r4"), "r4 step")
+	log.DebugContext(ctx("r5"), "r5 step")
+	log.ErrorContext(ctx("r3"), "r3 failed")
+	log.ErrorContext(ctx("r5"), "r5 failed")
+	require.Equal(t, "r3 failed,r5 step,r5 failed", onlyMessages(buf.String()))
+}
+
+func TestFlightRecorderHandlerClose(t *testing.T) {
+	buf := &bytes.Buffer{}
+	closed := false
+	h := NewFlightRecorderHandler(NewHandler(NewTextHandler(WithWriter(buf)), &mockCloseHandler{closeFn: func() error {
+		closed = true
+		return nil
+	}}))
+	log := slog.New(h)
+
+	ctx := AppendCtx(context.Background(), slog.String("request-id", "r1"))
+	log.DebugContext(ctx, "step")
+	require.NoError(t, h.Close())
+	require.True(t, closed)
+}
+
+func TestFlightRecorderHandlerScope(t *testing.T) {
+	buf1 := &bytes.Buffer{}
+	buf2 := &bytes.Buffer{}
+	h1 := newTestFlightRecorderHandler(buf1, newFakeClock())
+	defer h1.Close()
+	h2 := newTestFlightRecorderHandler(buf2, newFakeClock())
+	defer h2.Close()
+
+	ctx := AppendCtx(WithFlightRecorderScope(context.Background()), slog.String("request-id", "r1"))
+	// 同じキーでもスコープのないコンテキストで保持したレコードは破棄しない
+	other := AppendCtx(context.Background(), slog.String("request-id", "r1"))
+	slog.New(h1).DebugContext(ctx, "h1 step")
+	slog.New(h2).DebugContext(other, "h2 step")
+	require.Equal(t, WithFlightRecorderScope(ctx), ctx)
+
+	// スコープで保持したフライトレコーダーのレコードだけ破棄する
+	DiscardFlightRecords(ctx)
+	slog.New(h1).ErrorContext(ctx, "h1 failed")
+	slog.New(h2).ErrorContext(other, "h2 failed")
+	require.Equal(t, "h1 failed", onlyMessages(buf1.String()))
+	require.Equal(t, "h2 step,h2 failed", onlyMessages(buf2.String()))
+}
+
+type traceValueKey struct{}
+
+// ctxValueHandler はコンテキストの値を属性として出力する
+type ctxValueHandler struct {
+	slog.Handler
+}
+
+func (h *ctxValueHandler) Handle(ctx context.Context, record slog.Record) error {
+	if v, ok := ctx.Value(traceValueKey{}).(string); ok {
+		record.AddAttrs(slog.String("value", v))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func TestFlightRecorderHandlerRecordContext(t *testing.T) {
+	buf := &bytes.Buffer{}
+	h := NewFlightRecorderHandler(&ctxValueHandler{Handler: NewTextHandler(WithWriter(buf), WithLevel(slog.LevelInfo))})
+	defer h.Close()
+	log := slog.New(h)
+
+	base := AppendCtx(context.Background(), slog.String("request-id", "r1"))
+	ctx, cancel := context.WithCancel(context.WithValue(base, traceValueKey{}, "step"))
+	log.DebugContext(ctx, "step")
+	cancel()
+
+	// 保持したレコードはそのときのコンテキストで出力する
+	log.ErrorContext(context.WithValue(base, traceValueKey{}, "failed"), "failed")
+	require.Contains(t, buf.String(), "msg=step value=step")
+	require.Contains(t, buf.String(), "msg=failed value=failed")
+}
@@ -2,7 +2,6 @@ package logging
 
 import (
 	"log/slog"
-	"time"
 )
 
 func NewJSONHandler(opts ...Option) slog.Handler {
@@ -11,13 +10,5 @@ func NewJSONHandler(opts ...Option) slog.Handler {
 }
 
 func newJSONHandler(o *option) slog.Handler {
-	return slog.NewJSONHandler(o.writer, &slog.HandlerOptions{
-		Level: o.level,
-		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
-			if a.Key == "time" {
-				return slog.String(a.Key, time.Now().Format(time.RFC3339))
-			}
-			return a
-		},
-	})
+	return &leveledHandler{Handler: slog.NewJSONHandler(o.writer, o.handlerOptions()), level: o.level, option: o}
 }
@@ -0,0 +1,293 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// LevelController は実行中に変更できるログレベル
+// ロガー名毎にレベルを上書きすることもできる
+type LevelController struct {
+	level *slog.LevelVar
+
+	mu        sync.RWMutex
+	overrides map[string]slog.Level
+}
+
+var (
+	_ slog.Leveler = (*LevelController)(nil)
+	_ http.Handler = (*LevelController)(nil)
+)
+
+var (
+	defaultLevel = newEnvLevelController(envLogLevel())
+)
+
+// newEnvLevelController は環境変数LOG_LEVEL_OVERRIDESのロガー名毎の上書きを反映したLevelControllerを返す
+func newEnvLevelController(level slog.Level) *LevelController {
+	c := NewLevelController(level)
+	if spec, ok := os.LookupEnv("LOG_LEVEL_OVERRIDES"); ok {
+		_ = c.Apply(spec)
+	}
+	return c
+}
+
+// DefaultLevel はデフォルトのロガーとパッケージで作成するハンドラーが参照するレベルを返す
+func DefaultLevel() *LevelController {
+	return defaultLevel
+}
+
+func NewLevelController(level slog.Level) *LevelController {
+	v := &slog.LevelVar{}
+	v.Set(level)
+	return &LevelController{
+		level:     v,
+		overrides: map[string]slog.Level{},
+	}
+}
+
+func (c *LevelController) Level() slog.Level {
+	return c.level.Level()
+}
+
+func (c *LevelController) Set(level slog.Level) {
+	c.level.Set(level)
+}
+
+func (c *LevelController) SetOverride(name string, level slog.Level) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.overrides[name] = level
+}
+
+func (c *LevelController) DeleteOverride(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.overrides, name)
+}
+
+func (c *LevelController) Overrides() map[string]slog.Level {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return maps.Clone(c.overrides)
+}
+
+// Named はロガー名の上書きがあればそのレベルを、なければ全体のレベルを返すLevelerを返す
+func (c *LevelController) Named(name string) slog.Leveler {
+	return &namedLevel{controller: c, name: name}
+}
+
+// Apply は "info,interceptors=debug,db=warn" 形式でレベルを設定する
+// 名前のない要素は全体のレベルになる
+func (c *LevelController) Apply(spec string) error {
+	var (
+		level     *slog.Level
+		overrides = map[string]slog.Level{}
+	)
+	for item := range strings.SplitSeq(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			value = name
+		}
+		l, err := ParseLevel(value)
+		if err != nil {
+			return fmt.Errorf("logging: invalid level %q: %w", item, err)
+		}
+		if ok {
+			overrides[strings.TrimSpace(name)] = l
+		} else {
+			level = &l
+		}
+	}
+	if level != nil {
+		c.Set(*level)
+	}
+	for name, l := range overrides {
+		c.SetOverride(name, l)
+	}
+	return nil
+}
+
+type levelState struct {
+	Level     string            `json:"level,omitempty"`
+	Overrides map[string]string `json:"overrides,omitempty"`
+}
+
+func (c *LevelController) state() levelState {
+	overrides := c.Overrides()
+	s := levelState{
+		Level:     Level(c.Level()).String(),
+		Overrides: make(map[string]string, len(overrides)),
+	}
+	for name, l := range overrides {
+		s.Overrides[name] = Level(l).String()
+	}
+	return s
+}
+
+// ServeHTTP はGETで現在のレベルを返し、PUTでレベルを変更する
+// PUTのoverridesに空文字を指定したロガー名は上書きを削除する
+func (c *LevelController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req levelState
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := c.update(req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(c.state())
+}
+
+func (c *LevelController) update(req levelState) error {
+	var level slog.Level
+	if req.Level != "" {
+		l, err := ParseLevel(req.Level)
+		if err != nil {
+			return err
+		}
+		level = l
+	}
+	overrides := make(map[string]*slog.Level, len(req.Overrides))
+	for name, value := range req.Overrides {
+		if value == "" {
+			overrides[name] = nil
+			continue
+		}
+		l, err := ParseLevel(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		overrides[name] = &l
+	}
+	// 全て検証してから反映する
+	if req.Level != "" {
+		c.Set(level)
+	}
+	for name, l := range overrides {
+		if l == nil {
+			c.DeleteOverride(name)
+		} else {
+			c.SetOverride(name, *l)
+		}
+	}
+	return nil
+}
+
+// shift はレベルをdeltaだけ変更する。TRACEより詳細にもFATALより粗くもならない
+func (c *LevelController) shift(delta slog.Level) {
+	level := min(max(c.Level()+delta, LevelTrace), LevelFatal)
+	c.Set(level)
+}
+
+type namedLevel struct {
+	controller *LevelController
+	name       string
+}
+
+func (l *namedLevel) Level() slog.Level {
+	l.controller.mu.RLock()
+	level, ok := l.controller.overrides[l.name]
+	l.controller.mu.RUnlock()
+	if ok {
+		return level
+	}
+	return l.controller.Level()
+}
+
+type loggerNameKey struct{}
+
+// Named はLevelControllerのロガー名の上書きに従って出力するロガーを返す
+// パッケージで作成したハンドラーはLevelControllerのNamed(name)のレベルで判定する
+//
+//	logger := logging.Named(slog.Default(), "interceptors")
+func Named(logger *slog.Logger, name string) *slog.Logger {
+	return slog.New(&namedHandler{Handler: logger.Handler(), name: name})
+}
+
+// LevelFor はコンテキストにNamedのロガー名があれば上書きを反映したレベルを返す
+// パッケージ外のハンドラーもEnabledでこれを使うとロガー名の上書きに従う
+func LevelFor(ctx context.Context, leveler slog.Leveler) slog.Level {
+	if c, ok := leveler.(*LevelController); ok && ctx != nil {
+		if name, ok := ctx.Value(loggerNameKey{}).(string); ok {
+			return c.Named(name).Level()
+		}
+	}
+	return leveler.Level()
+}
+
+// namedHandler はロガー名をコンテキストで子ハンドラーに渡す
+type namedHandler struct {
+	slog.Handler
+	name string
+}
+
+func (h *namedHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.Handler.Enabled(h.withName(ctx), level)
+}
+
+func (h *namedHandler) Handle(ctx context.Context, record slog.Record) error {
+	return h.Handler.Handle(h.withName(ctx), record)
+}
+
+func (h *namedHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &namedHandler{Handler: h.Handler.WithAttrs(attrs), name: h.name}
+}
+
+func (h *namedHandler) WithGroup(name string) slog.Handler {
+	return &namedHandler{Handler: h.Handler.WithGroup(name), name: h.name}
+}
+
+func (h *namedHandler) withName(ctx context.Context) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, loggerNameKey{}, h.name)
+}
+
+// leveledHandler はslogのハンドラーをロガー名の上書きを反映したレベルで判定する
+// CloseでWithFileで作成した出力先を閉じる
+type leveledHandler struct {
+	slog.Handler
+	level  slog.Leveler
+	option *option
+}
+
+func (h *leveledHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= LevelFor(ctx, h.level)
+}
+
+func (h *leveledHandler) acceptReplay() {}
+
+func (h *leveledHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &leveledHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level, option: h.option}
+}
+
+func (h *leveledHandler) WithGroup(name string) slog.Handler {
+	return &leveledHandler{Handler: h.Handler.WithGroup(name), level: h.level, option: h.option}
+}
+
+func (h *leveledHandler) Close() error {
+	return h.option.close()
+}
@@ -0,0 +1,34 @@
+//go:build !windows
+
+package logging
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// WatchSignals はSIGUSR1でレベルを1段階詳細にし、SIGUSR2で1段階粗くする
+// 返却された関数で監視を止める
+func (c *LevelController) WatchSignals() (stop func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1, syscall.SIGUSR2)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for sig := range ch {
+			switch sig {
+			case syscall.SIGUSR1:
+				c.shift(slog.LevelDebug - slog.LevelInfo)
+			case syscall.SIGUSR2:
+				c.shift(slog.LevelInfo - slog.LevelDebug)
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(ch)
+		<-done
+	}
+}
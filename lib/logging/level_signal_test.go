@@ -0,0 +1,31 @@
+//go:build !windows
+
+package logging
+
+import (
+	"log/slog"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLevelControllerWatchSignals(t *testing.T) {
+	c := NewLevelController(slog.LevelInfo)
+	stop := c.WatchSignals()
+	defer stop()
+
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGUSR1))
+	require.Eventually(t, func() bool {
+		return c.Level() == slog.LevelDebug
+	}, time.Second, 10*time.Millisecond)
+
+	// 連続したシグナルはまとめられることがあるため1つずつ確認する
+	for _, expected := range []slog.Level{slog.LevelInfo, slog.LevelWarn} {
+		require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGUSR2))
+		require.Eventually(t, func() bool {
+			return c.Level() == expected
+		}, time.Second, 10*time.Millisecond)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package logging
+
+// WatchSignals はWindowsではSIGUSR1/SIGUSR2がないため何もしない
+func (c *LevelController) WatchSignals() (stop func()) {
+	return func() {}
+}
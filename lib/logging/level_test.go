@@ -0,0 +1,238 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLevelController(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := NewLevelController(slog.LevelInfo)
+	log := slog.New(NewTextHandler(WithWriter(buf), WithLevel(c)))
+
+	log.Debug("before")
+	c.Set(slog.LevelDebug)
+	log.Debug("after")
+
+	output := buf.String()
+	assert.NotContains(t, output, "msg=before")
+	assert.Contains(t, output, "msg=after")
+}
+
+func TestLevelControllerNamed(t *testing.T) {
+	c := NewLevelController(slog.LevelWarn)
+	named := c.Named("interceptors")
+	assert.Equal(t, slog.LevelWarn, named.Level())
+
+	c.SetOverride("interceptors", slog.LevelDebug)
+	assert.Equal(t, slog.LevelDebug, named.Level())
+	assert.Equal(t, slog.LevelWarn, c.Named("db").Level())
+
+	c.DeleteOverride("interceptors")
+	c.Set(slog.LevelError)
+	assert.Equal(t, slog.LevelError, named.Level())
+}
+
+func TestNamed(t *testing.T) {
+	c := NewLevelController(slog.LevelInfo)
+	c.SetOverride("interceptors", slog.LevelDebug)
+	c.SetOverride("db", slog.LevelError)
+	tests := []struct {
+		name    string
+		handler func(buf *bytes.Buffer) slog.Handler
+	}{
+		{
+			name: "text",
+			handler: func(buf *bytes.Buffer) slog.Handler {
+				return NewTextHandler(WithWriter(buf), WithLevel(c))
+			},
+		},
+		{
+			name: "json",
+			handler: func(buf *bytes.Buffer) slog.Handler {
+				return NewHandler(NewJSONHandler(WithWriter(buf), WithLevel(c)))
+			},
+		},
+		{
+			name: "console",
+			handler: func(buf *bytes.Buffer) slog.Handler {
+				return NewConsoleHandler(buf, WithConsoleLevel(c))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			log := slog.New(tt.handler(buf)).With(slog.String("service", "api"))
+
+			// ロガー名の上書きのレベルで判定する
+			Named(log, "interceptors").Debug("interceptors debug")
+			Named(log, "db").Warn("db warn")
+			Named(log, "db").WithGroup("g").Error("db error")
+			log.Debug("root debug")
+			Named(log, "unknown").Info("unknown info")
+
+			output := buf.String()
+			assert.Contains(t, output, "interceptors debug")
+			assert.NotContains(t, output, "db warn")
+			assert.Contains(t, output, "db error")
+			assert.NotContains(t, output, "root debug")
+			assert.Contains(t, output, "unknown info")
+		})
+	}
+}
+
+// restoreDefaultLevel はテスト後にDefaultLevelを元に戻す
+func restoreDefaultLevel(t *testing.T) {
+	t.Helper()
+	level := DefaultLevel().Level()
+	t.Cleanup(func() {
+		DefaultLevel().Set(level)
+	})
+}
+
+func TestNewWithoutLevelController(t *testing.T) {
+	restoreDefaultLevel(t)
+	DefaultLevel().Set(slog.LevelDebug)
+	buf := &bytes.Buffer{}
+	h, err := New(Config{Level: NewLevel(slog.LevelWarn)}, WithWriter(buf))
+	require.NoError(t, err)
+	defer h.Close()
+	// LevelControllerを指定しなければDefaultLevelは変更しない
+	assert.Equal(t, slog.LevelDebug, DefaultLevel().Level())
+
+	log := slog.New(h)
+	log.Info("info")
+	log.Warn("warn")
+	output := buf.String()
+	assert.NotContains(t, output, "\"msg\":\"info\"")
+	assert.Contains(t, output, "\"msg\":\"warn\"")
+}
+
+func TestNewWithDefaultLevel(t *testing.T) {
+	restoreDefaultLevel(t)
+	buf := &bytes.Buffer{}
+	h, err := New(Config{Level: NewLevel(slog.LevelWarn), LevelController: DefaultLevel()}, WithWriter(buf))
+	require.NoError(t, err)
+	defer h.Close()
+	// 指定したDefaultLevelはLevelに変更し、その後の変更も反映する
+	assert.Equal(t, slog.LevelWarn, DefaultLevel().Level())
+
+	log := slog.New(h)
+	log.Info("before")
+	DefaultLevel().Set(slog.LevelInfo)
+	log.Info("after")
+
+	output := buf.String()
+	assert.NotContains(t, output, "\"msg\":\"before\"")
+	assert.Contains(t, output, "\"msg\":\"after\"")
+}
+
+func TestLevelControllerApply(t *testing.T) {
+	c := NewLevelController(slog.LevelInfo)
+	require.NoError(t, c.Apply("warn, interceptors=debug,db=ERROR"))
+	assert.Equal(t, slog.LevelWarn, c.Level())
+	assert.Equal(t, map[string]slog.Level{
+		"interceptors": slog.LevelDebug,
+		"db":           slog.LevelError,
+	}, c.Overrides())
+
+	require.Error(t, c.Apply("interceptors=verbose"))
+	assert.Equal(t, slog.LevelDebug, c.Overrides()["interceptors"])
+}
+
+func TestLevelControllerShift(t *testing.T) {
+	c := NewLevelController(slog.LevelInfo)
+	c.shift(slog.LevelDebug - slog.LevelInfo)
+	assert.Equal(t, slog.LevelDebug, c.Level())
+	c.shift(slog.LevelDebug - slog.LevelInfo)
+	assert.Equal(t, LevelTrace, c.Level())
+	c.shift(slog.LevelDebug - slog.LevelInfo)
+	assert.Equal(t, LevelTrace, c.Level())
+	for range 6 {
+		c.shift(slog.LevelInfo - slog.LevelDebug)
+	}
+	assert.Equal(t, LevelFatal, c.Level())
+}
+
+func TestLevelControllerServeHTTP(t *testing.T) {
+	c := NewLevelController(slog.LevelInfo)
+	c.SetOverride("db", slog.LevelWarn)
+
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		status   int
+		expected string
+	}{
+		{
+			name:     "get",
+			method:   http.MethodGet,
+			status:   http.StatusOK,
+			expected: `{"level":"INFO","overrides":{"db":"WARN"}}`,
+		},
+		{
+			name:     "put",
+			method:   http.MethodPut,
+			body:     `{"level":"debug","overrides":{"interceptors":"DEBUG","db":""}}`,
+			status:   http.StatusOK,
+			expected: `{"level":"DEBUG","overrides":{"interceptors":"DEBUG"}}`,
+		},
+		{
+			name:   "invalid level",
+			method: http.MethodPut,
+			body:   `{"level":"error","overrides":{"db":"verbose"}}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "invalid json",
+			method: http.MethodPut,
+			body:   `{`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "method not allowed",
+			method: http.MethodPost,
+			status: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, "/log/level", strings.NewReader(tt.body))
+			c.ServeHTTP(rec, req)
+			require.Equal(t, tt.status, rec.Code)
+			if tt.expected != "" {
+				assert.JSONEq(t, tt.expected, rec.Body.String())
+			}
+		})
+	}
+	// 不正なリクエストは反映されない
+	assert.Equal(t, slog.LevelDebug, c.Level())
+}
+
+func TestNewWithLevelController(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := NewLevelController(slog.LevelError)
+	h, err := New(Config{Level: NewLevel(slog.LevelInfo), LevelController: c}, WithWriter(buf))
+	require.NoError(t, err)
+	defer h.Close()
+	assert.Equal(t, slog.LevelInfo, c.Level())
+
+	log := slog.New(h)
+	log.Debug("before")
+	c.Set(slog.LevelDebug)
+	log.Debug("after")
+
+	output := buf.String()
+	assert.NotContains(t, output, "\"msg\":\"before\"")
+	assert.Contains(t, output, "\"msg\":\"after\"")
+}
@@ -0,0 +1,179 @@
+package logging
+
+import (
+	"encoding"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// slogの標準レベルに加えて使うレベル
+const (
+	LevelTrace  = slog.Level(-8)
+	LevelNotice = slog.Level(2)
+	LevelFatal  = slog.Level(12)
+)
+
+// levelNames は名前付きのレベルを昇順に並べたもの
+var levelNames = []struct {
+	level slog.Level
+	name  string
+}{
+	{LevelTrace, "TRACE"},
+	{slog.LevelDebug, "DEBUG"},
+	{slog.LevelInfo, "INFO"},
+	{LevelNotice, "NOTICE"},
+	{slog.LevelWarn, "WARN"},
+	{slog.LevelError, "ERROR"},
+	{LevelFatal, "FATAL"},
+}
+
+// levelAliases はlevelNames以外に受け付ける名前
+var levelAliases = map[string]slog.Level{
+	"WARNING":  slog.LevelWarn,
+	"ERR":      slog.LevelError,
+	"CRITICAL": LevelFatal,
+}
+
+// Level は設定ファイルや環境変数から読み込むログレベル
+// TRACE、NOTICE、FATALの名前で出力し、不正な名前は読み込み時にエラーになる
+type Level slog.Level
+
+var (
+	_ slog.Leveler             = Level(0)
+	_ fmt.Stringer             = Level(0)
+	_ encoding.TextMarshaler   = Level(0)
+	_ encoding.TextUnmarshaler = (*Level)(nil)
+	_ yaml.Unmarshaler         = (*Level)(nil)
+)
+
+// ParseLevel は大文字小文字を区別せずにレベル名を解析する
+// TRACE、NOTICE、FATALと "info+2" のようなオフセットを受け付ける
+//
+//	logging.ParseLevel("trace")   // LevelTrace
+//	logging.ParseLevel("info+2")  // LevelNotice
+//	logging.ParseLevel("ERROR-1") // slog.LevelError - 1
+func ParseLevel(s string) (slog.Level, error) {
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	name, offset := upper, 0
+	if i := strings.IndexAny(upper, "+-"); i > 0 {
+		n, err := strconv.Atoi(upper[i:])
+		if err != nil {
+			return 0, fmt.Errorf("logging: invalid level %q: %w", s, err)
+		}
+		name, offset = upper[:i], n
+	}
+	level, ok := lookupLevel(name)
+	if !ok {
+		return 0, fmt.Errorf("logging: unknown level %q", s)
+	}
+	return level + slog.Level(offset), nil
+}
+
+func (l Level) Level() slog.Level {
+	return slog.Level(l)
+}
+
+// String は直近の下位の名前付きレベルからのオフセットで表す
+func (l Level) String() string {
+	level := slog.Level(l)
+	base := levelNames[0]
+	for _, n := range levelNames {
+		if n.level > level {
+			break
+		}
+		base = n
+	}
+	switch offset := int(level - base.level); {
+	case offset == 0:
+		return base.name
+	case offset > 0:
+		return base.name + "+" + strconv.Itoa(offset)
+	default:
+		return base.name + strconv.Itoa(offset)
+	}
+}
+
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *Level) UnmarshalText(data []byte) error {
+	level, err := ParseLevel(string(data))
+	if err != nil {
+		return err
+	}
+	*l = Level(level)
+	return nil
+}
+
+func (l *Level) UnmarshalYAML(value *yaml.Node) error {
+	return l.UnmarshalText([]byte(value.Value))
+}
+
+// NewLevel はConfigなどのLevelに指定するポインターを返す
+//
+//	logging.Config{Level: logging.NewLevel(slog.LevelDebug)}
+func NewLevel(level slog.Level) *Level {
+	l := Level(level)
+	return &l
+}
+
+// levelOr はnilのときにdefaultLevelを返す
+func levelOr(l *Level, defaultLevel slog.Level) slog.Level {
+	if l == nil {
+		return defaultLevel
+	}
+	return l.Level()
+}
+
+func lookupLevel(name string) (slog.Level, bool) {
+	for _, n := range levelNames {
+		if n.name == name {
+			return n.level, true
+		}
+	}
+	level, ok := levelAliases[name]
+	return level, ok
+}
+
+// parseLevelOr は空文字のときにdefaultLevelを返す。不正な値もdefaultLevelになる
+func parseLevelOr(s string, defaultLevel slog.Level) slog.Level {
+	if strings.TrimSpace(s) == "" {
+		return defaultLevel
+	}
+	level, err := ParseLevel(s)
+	if err != nil {
+		return defaultLevel
+	}
+	return level
+}
+
+// standardLevel はカスタムレベルを直近の下位のslogの標準レベルにする
+// slog-rollbarのように標準レベルしか変換できないハンドラーに渡すときに使う
+func standardLevel(level slog.Level) slog.Level {
+	switch {
+	case level < slog.LevelInfo:
+		return slog.LevelDebug
+	case level < slog.LevelWarn:
+		return slog.LevelInfo
+	case level < slog.LevelError:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
+
+// replaceLevelAttr はレベルをTRACEなどの名前で出力する
+func replaceLevelAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 || a.Key != slog.LevelKey {
+		return a
+	}
+	if level, ok := a.Value.Any().(slog.Level); ok {
+		a.Value = slog.StringValue(Level(level).String())
+	}
+	return a
+}
@@ -0,0 +1,138 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in   string
+		want slog.Level
+	}{
+		{in: "trace", want: LevelTrace},
+		{in: "DEBUG", want: slog.LevelDebug},
+		{in: "Info", want: slog.LevelInfo},
+		{in: "notice", want: LevelNotice},
+		{in: "warn", want: slog.LevelWarn},
+		{in: "warning", want: slog.LevelWarn},
+		{in: "err", want: slog.LevelError},
+		{in: "error", want: slog.LevelError},
+		{in: "fatal", want: LevelFatal},
+		{in: "critical", want: LevelFatal},
+		{in: " info+2 ", want: LevelNotice},
+		{in: "ERROR-1", want: slog.LevelError - 1},
+		{in: "debug+0", want: slog.LevelDebug},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseLevel(tt.in)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	// 不正な値はエラー
+	for _, in := range []string{"", "verbose", "info+", "info+x", "+2"} {
+		_, err := ParseLevel(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestLevelString(t *testing.T) {
+	tests := []struct {
+		level slog.Level
+		want  string
+	}{
+		{level: LevelTrace - 2, want: "TRACE-2"},
+		{level: LevelTrace, want: "TRACE"},
+		{level: LevelTrace + 2, want: "TRACE+2"},
+		{level: slog.LevelDebug, want: "DEBUG"},
+		{level: slog.LevelInfo + 1, want: "INFO+1"},
+		{level: LevelNotice, want: "NOTICE"},
+		{level: slog.LevelWarn, want: "WARN"},
+		{level: slog.LevelError, want: "ERROR"},
+		{level: LevelFatal, want: "FATAL"},
+		{level: LevelFatal + 3, want: "FATAL+3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, Level(tt.level).String())
+			// 出力した名前は解析して元に戻る
+			got, err := ParseLevel(tt.want)
+			require.NoError(t, err)
+			assert.Equal(t, tt.level, got)
+		})
+	}
+}
+
+func TestStandardLevel(t *testing.T) {
+	tests := []struct {
+		level slog.Level
+		want  slog.Level
+	}{
+		{level: LevelTrace, want: slog.LevelDebug},
+		{level: slog.LevelDebug, want: slog.LevelDebug},
+		{level: slog.LevelInfo, want: slog.LevelInfo},
+		{level: LevelNotice, want: slog.LevelInfo},
+		{level: slog.LevelWarn, want: slog.LevelWarn},
+		{level: slog.LevelError + 1, want: slog.LevelError},
+		{level: LevelFatal, want: slog.LevelError},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, standardLevel(tt.level), Level(tt.level).String())
+	}
+}
+
+func TestHandlerLevelName(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(NewJSONHandler(WithWriter(buf), WithLevel(LevelTrace)))
+	log.Log(t.Context(), LevelTrace, "trace")
+	assert.Equal(t, "TRACE", decodeJSONLine(t, buf)["level"])
+
+	buf.Reset()
+	log = slog.New(NewTextHandler(WithWriter(buf)))
+	log.Log(t.Context(), LevelNotice, "notice")
+	assert.Contains(t, buf.String(), "level=NOTICE")
+}
+
+func TestLevelUnmarshal(t *testing.T) {
+	var conf struct {
+		Level    Level `yaml:"level"`
+		Override Level `yaml:"override"`
+	}
+	require.NoError(t, yaml.Unmarshal([]byte("level: notice\noverride: info+1\n"), &conf))
+	assert.Equal(t, LevelNotice, conf.Level.Level())
+	assert.Equal(t, slog.LevelInfo+1, conf.Override.Level())
+	require.Error(t, yaml.Unmarshal([]byte("level: verbose\n"), &conf))
+
+	var l Level
+	require.NoError(t, l.UnmarshalText([]byte("fatal")))
+	assert.Equal(t, LevelFatal, l.Level())
+	text, err := l.MarshalText()
+	require.NoError(t, err)
+	assert.Equal(t, "FATAL", string(text))
+}
+
+func TestConfigLevel(t *testing.T) {
+	// SentryとRollbarは未指定のときにWARN
+	assert.Equal(t, slog.LevelWarn, (&SentryConfig{}).getLevel())
+	assert.Equal(t, slog.LevelWarn, (&RollbarConfig{}).getLevel())
+	assert.Equal(t, LevelNotice, (&SentryConfig{Level: NewLevel(LevelNotice)}).getLevel())
+
+	// 不正なレベルは設定の読み込みでエラー
+	var conf Config
+	require.Error(t, yaml.Unmarshal([]byte("level: verbose\n"), &conf))
+	require.Error(t, yaml.Unmarshal([]byte("sentry:\n  level: verbose\n"), &conf))
+	require.Error(t, yaml.Unmarshal([]byte("rollbar:\n  level: verbose\n"), &conf))
+
+	require.NoError(t, yaml.Unmarshal([]byte("level: trace\nsentry:\n  level: error\nrollbar:\n  level: fatal\n"), &conf))
+	assert.Equal(t, LevelTrace, conf.getLevel())
+	assert.Equal(t, slog.LevelError, conf.Sentry.getLevel())
+	assert.Equal(t, LevelFatal, conf.Rollbar.getLevel())
+}
@@ -0,0 +1,129 @@
+package logtest
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// UpdateGoldenEnv に1を設定するとAssertGoldenでファイルを更新する
+const UpdateGoldenEnv = "LOGTEST_UPDATE"
+
+type tHelper interface {
+	Helper()
+}
+
+// AssertLogged は全ての条件に一致するレコードがあることを検証する
+func (h *Handler) AssertLogged(t assert.TestingT, matchers ...Matcher) bool {
+	if th, ok := t.(tHelper); ok {
+		th.Helper()
+	}
+	if _, ok := h.Find(matchers...); ok {
+		return true
+	}
+	return assert.Fail(t, "no record matches "+describe(matchers), h.String())
+}
+
+// AssertNotLogged は全ての条件に一致するレコードがないことを検証する
+func (h *Handler) AssertNotLogged(t assert.TestingT, matchers ...Matcher) bool {
+	if th, ok := t.(tHelper); ok {
+		th.Helper()
+	}
+	if _, ok := h.Find(matchers...); !ok {
+		return true
+	}
+	return assert.Fail(t, "unexpected record matches "+describe(matchers), h.String())
+}
+
+// AssertCount は全ての条件に一致するレコードの数を検証する
+func (h *Handler) AssertCount(t assert.TestingT, n int, matchers ...Matcher) bool {
+	if th, ok := t.(tHelper); ok {
+		th.Helper()
+	}
+	if got := h.Count(matchers...); got != n {
+		return assert.Fail(t, fmt.Sprintf("expected %d records match %s, got %d", n, describe(matchers), got), h.String())
+	}
+	return true
+}
+
+// RequireLogged はAssertLoggedに失敗したらテストを終了する
+func (h *Handler) RequireLogged(t require.TestingT, matchers ...Matcher) Record {
+	if th, ok := t.(tHelper); ok {
+		th.Helper()
+	}
+	if !h.AssertLogged(t, matchers...) {
+		t.FailNow()
+	}
+	r, _ := h.Find(matchers...)
+	return r
+}
+
+// AssertGolden はレコードを時刻を除いたテキストにしてtestdata/<name>.goldenと比較する
+// 環境変数LOGTEST_UPDATEに1を設定するとファイルを更新する
+func (h *Handler) AssertGolden(t assert.TestingT, name string) bool {
+	if th, ok := t.(tHelper); ok {
+		th.Helper()
+	}
+	path := filepath.Join("testdata", name+".golden")
+	got := h.String()
+	if os.Getenv(UpdateGoldenEnv) == "1" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return assert.NoError(t, err)
+		}
+		return assert.NoError(t, os.WriteFile(path, []byte(got), 0o644))
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		return assert.Fail(t, fmt.Sprintf("read golden file: %v (run with %s=1 to create)", err, UpdateGoldenEnv))
+	}
+	return assert.Equal(t, string(want), got, path)
+}
+
+// String はキャプチャしたレコードを時刻を除いて1行ずつ出力する
+func (h *Handler) String() string {
+	var b strings.Builder
+	for _, r := range h.Records() {
+		b.WriteString(r.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// String はレベル、メッセージ、属性の順に時刻を除いて出力する
+func (r Record) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s msg=%q", r.Level, r.Message)
+	writeAttrs(&b, "", r.Attrs)
+	return b.String()
+}
+
+func writeAttrs(b *strings.Builder, prefix string, attrs []slog.Attr) {
+	for _, a := range attrs {
+		if a.Value.Kind() == slog.KindGroup {
+			writeAttrs(b, prefix+a.Key+".", a.Value.Group())
+			continue
+		}
+		fmt.Fprintf(b, " %s%s=", prefix, a.Key)
+		if a.Value.Kind() == slog.KindString {
+			fmt.Fprintf(b, "%q", a.Value.String())
+		} else {
+			b.WriteString(a.Value.String())
+		}
+	}
+}
+
+func describe(matchers []Matcher) string {
+	if len(matchers) == 0 {
+		return "any record"
+	}
+	descs := make([]string, len(matchers))
+	for i, m := range matchers {
+		descs[i] = m.String()
+	}
+	return strings.Join(descs, ", ")
+}
@@ -0,0 +1,274 @@
+package logtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/slogtest"
+	"time"
+
+	"github.com/n-creativesystem/go-packages/lib/logging"
+	"github.com/stretchr/testify/require"
+)
+
+// 外部サービスに送信するSentry、Rollbar、OTLP、Datadogのインテークは対象外
+// それ以外のパッケージのハンドラーは出力をパースするか、キャプチャするハンドラーをラップして検証する
+
+type conformanceCase struct {
+	name string
+	// new はハンドラーと出力されたレコードを返す関数を作成する
+	new func(t *testing.T) (slog.Handler, func() map[string]any)
+	// skip は仕様として満たさないslogtestのケース名
+	skip []string
+}
+
+// processGroupSkip はNewProcessHandlerが現在のグループにプロセスIDを追加するため、属性のないグループも出力するケース
+var processGroupSkip = []string{"empty-group-record", "nested-empty-group-record"}
+
+func (c conformanceCase) skipping(names ...string) conformanceCase {
+	c.skip = names
+	return c
+}
+
+func jsonCase(name string, newHandler func(buf *bytes.Buffer) slog.Handler) conformanceCase {
+	return conformanceCase{
+		name: name,
+		new: func(t *testing.T) (slog.Handler, func() map[string]any) {
+			buf := &bytes.Buffer{}
+			return newHandler(buf), func() map[string]any {
+				return parseJSONLine(t, stripANSI(buf.String()))
+			}
+		},
+	}
+}
+
+func textCase(name string, newHandler func(buf *bytes.Buffer) slog.Handler, parse func(t *testing.T, line string) map[string]any) conformanceCase {
+	return conformanceCase{
+		name: name,
+		new: func(t *testing.T) (slog.Handler, func() map[string]any) {
+			buf := &bytes.Buffer{}
+			return newHandler(buf), func() map[string]any {
+				return parse(t, stripANSI(buf.String()))
+			}
+		},
+	}
+}
+
+// wrapCase はキャプチャするハンドラーをラップしたハンドラーを検証する
+func wrapCase(name string, wrap func(h slog.Handler) slog.Handler) conformanceCase {
+	return conformanceCase{
+		name: name,
+		new: func(t *testing.T) (slog.Handler, func() map[string]any) {
+			capture := New()
+			h := wrap(capture)
+			return h, func() map[string]any {
+				// 非同期のハンドラーはCloseで出力を待つ
+				if c, ok := h.(interface{ Close() error }); ok {
+					require.NoError(t, c.Close())
+				}
+				records := capture.Records()
+				require.Len(t, records, 1)
+				return records[0].Map()
+			}
+		},
+	}
+}
+
+func TestConformance(t *testing.T) {
+	cases := []conformanceCase{
+		{
+			name: "logtest",
+			new: func(t *testing.T) (slog.Handler, func() map[string]any) {
+				h := New()
+				return h, func() map[string]any {
+					records := h.Records()
+					require.Len(t, records, 1)
+					return records[0].Map()
+				}
+			},
+		},
+		jsonCase("JSONHandler", func(buf *bytes.Buffer) slog.Handler {
+			return logging.NewJSONHandler(logging.WithWriter(buf))
+		}),
+		jsonCase("ColorHandler", func(buf *bytes.Buffer) slog.Handler {
+			return logging.NewColorHandler(logging.WithWriter(buf))
+		}),
+		jsonCase("New", func(buf *bytes.Buffer) slog.Handler {
+			h, err := logging.New(logging.Config{Level: logging.NewLevel(slog.LevelInfo)}, logging.WithWriter(buf))
+			if err != nil {
+				panic(err)
+			}
+			return h
+		}).skipping(processGroupSkip...),
+		textCase("TextHandler", func(buf *bytes.Buffer) slog.Handler {
+			return logging.NewTextHandler(logging.WithWriter(buf))
+		}, parseTextLine),
+		textCase("ConsoleHandler", func(buf *bytes.Buffer) slog.Handler {
+			return logging.NewConsoleHandler(buf,
+				logging.WithConsoleColor(false),
+				logging.WithConsoleSource(false),
+				logging.WithConsoleTimeFormat(time.RFC3339Nano),
+			)
+		}, parseConsoleLine),
+		wrapCase("ContextHandler", func(h slog.Handler) slog.Handler {
+			return logging.NewContextHandler(h)
+		}),
+		wrapCase("ProcessHandler", logging.NewProcessHandler).skipping(processGroupSkip...),
+		wrapCase("AsyncHandler", func(h slog.Handler) slog.Handler {
+			return logging.NewAsyncHandler(h)
+		}),
+		wrapCase("MultiHandler", func(h slog.Handler) slog.Handler {
+			return logging.NewHandler(h)
+		}),
+		wrapCase("ErrorTracking", func(h slog.Handler) slog.Handler {
+			return logging.NewErrorTracking(h)
+		}),
+		wrapCase("RedactHandler", func(h slog.Handler) slog.Handler {
+			return logging.NewRedactHandler(h)
+		}),
+		wrapCase("SamplingHandler", func(h slog.Handler) slog.Handler {
+			return logging.NewSamplingHandler(h)
+		}),
+		wrapCase("DedupHandler", func(h slog.Handler) slog.Handler {
+			// 同じメッセージのレコードを抑制しないように期間を0にする
+			return logging.NewDedupHandler(h, logging.WithDedupWindow(0))
+		}),
+		wrapCase("FlightRecorderHandler", func(h slog.Handler) slog.Handler {
+			return logging.NewFlightRecorderHandler(h)
+		}),
+		wrapCase("Router", func(h slog.Handler) slog.Handler {
+			return logging.NewRouter(
+				logging.WithRoute(logging.RouteAttr("component", "audit"), New()),
+				logging.WithDefaultRoute(h),
+			)
+		}),
+		wrapCase("DatadogHandler", func(h slog.Handler) slog.Handler {
+			return logging.NewDatadogHandler(logging.DDArgs{ServiceName: "test"}, h)
+		}),
+		wrapCase("OTelHandler", func(h slog.Handler) slog.Handler {
+			return logging.NewOTelHandler(h)
+		}),
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var result func() map[string]any
+			slogtest.Run(t, func(t *testing.T) slog.Handler {
+				if slices.Contains(tc.skip, path.Base(t.Name())) {
+					t.Skip("not supported by " + tc.name)
+				}
+				var h slog.Handler
+				h, result = tc.new(t)
+				return h
+			}, func(t *testing.T) map[string]any {
+				return result()
+			})
+		})
+	}
+}
+
+var ansiPattern = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+func stripANSI(s string) string {
+	return ansiPattern.ReplaceAllString(s, "")
+}
+
+func parseJSONLine(t *testing.T, s string) map[string]any {
+	t.Helper()
+	var m map[string]any
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimSpace(s)), &m), s)
+	return m
+}
+
+// parseTextLine は "key=value" の並びをグループのキーで入れ子にする
+func parseTextLine(t *testing.T, s string) map[string]any {
+	t.Helper()
+	m := map[string]any{}
+	for _, field := range splitFields(t, strings.TrimSpace(s)) {
+		key, value, ok := strings.Cut(field, "=")
+		require.True(t, ok, field)
+		setNested(m, key, unquote(value))
+	}
+	return m
+}
+
+// parseConsoleLine は "時刻 レベル メッセージ key=value..." を解析する。時刻がなければ省略される
+func parseConsoleLine(t *testing.T, s string) map[string]any {
+	t.Helper()
+	fields := splitFields(t, strings.TrimSpace(s))
+	m := map[string]any{}
+	if len(fields) > 0 {
+		if ts, err := time.Parse(time.RFC3339Nano, fields[0]); err == nil {
+			m[slog.TimeKey] = ts
+			fields = fields[1:]
+		}
+	}
+	require.GreaterOrEqual(t, len(fields), 2, s)
+	m[slog.LevelKey] = fields[0]
+	m[slog.MessageKey] = unquote(fields[1])
+	for _, field := range fields[2:] {
+		key, value, ok := strings.Cut(field, "=")
+		require.True(t, ok, field)
+		setNested(m, key, unquote(value))
+	}
+	return m
+}
+
+// splitFields は引用符の中の空白を区切りにしないで分割する
+func splitFields(t *testing.T, s string) []string {
+	t.Helper()
+	var (
+		fields []string
+		b      strings.Builder
+		quoted bool
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && quoted && i+1 < len(s):
+			b.WriteByte(c)
+			i++
+			b.WriteByte(s[i])
+		case c == '"':
+			quoted = !quoted
+			b.WriteByte(c)
+		case c == ' ' && !quoted:
+			if b.Len() > 0 {
+				fields = append(fields, b.String())
+				b.Reset()
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	require.False(t, quoted, s)
+	if b.Len() > 0 {
+		fields = append(fields, b.String())
+	}
+	return fields
+}
+
+func unquote(s string) string {
+	if v, err := strconv.Unquote(s); err == nil {
+		return v
+	}
+	return s
+}
+
+func setNested(m map[string]any, key, value string) {
+	names := strings.Split(key, ".")
+	for _, name := range names[:len(names)-1] {
+		g, ok := m[name].(map[string]any)
+		if !ok {
+			g = map[string]any{}
+			m[name] = g
+		}
+		m = g
+	}
+	m[names[len(names)-1]] = value
+}
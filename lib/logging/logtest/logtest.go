@@ -0,0 +1,254 @@
+package logtest
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/n-creativesystem/go-packages/lib/logging"
+)
+
+// Record はキャプチャしたレコード
+// 属性はLogValuerを解決し、空の属性とグループを除いて、キーのないグループを展開したもの
+type Record struct {
+	Time    time.Time
+	Level   slog.Level
+	Message string
+	PC      uintptr
+	Attrs   []slog.Attr
+}
+
+// Value は "group.key" 形式のキーで属性の値を返す
+func (r Record) Value(key string) (slog.Value, bool) {
+	attrs := r.Attrs
+	for {
+		name, rest, nested := strings.Cut(key, ".")
+		i := slices.IndexFunc(attrs, func(a slog.Attr) bool {
+			return a.Key == name
+		})
+		if i < 0 {
+			// キーに "." を含む属性もある
+			i = slices.IndexFunc(attrs, func(a slog.Attr) bool {
+				return a.Key == key
+			})
+			if i < 0 {
+				return slog.Value{}, false
+			}
+			return attrs[i].Value, true
+		}
+		if !nested {
+			return attrs[i].Value, true
+		}
+		if attrs[i].Value.Kind() != slog.KindGroup {
+			return slog.Value{}, false
+		}
+		attrs, key = attrs[i].Value.Group(), rest
+	}
+}
+
+// Flatten はグループのキーを "." で連結して属性の値を返す
+func (r Record) Flatten() map[string]any {
+	m := map[string]any{}
+	flatten(m, "", r.Attrs)
+	return m
+}
+
+func flatten(m map[string]any, prefix string, attrs []slog.Attr) {
+	for _, a := range attrs {
+		if a.Value.Kind() == slog.KindGroup {
+			flatten(m, prefix+a.Key+".", a.Value.Group())
+			continue
+		}
+		m[prefix+a.Key] = a.Value.Any()
+	}
+}
+
+// Map はslogtest.TestHandlerの形式で時刻、レベル、メッセージとグループを入れ子にした属性を返す
+func (r Record) Map() map[string]any {
+	m := map[string]any{
+		slog.LevelKey:   r.Level,
+		slog.MessageKey: r.Message,
+	}
+	if !r.Time.IsZero() {
+		m[slog.TimeKey] = r.Time
+	}
+	nest(m, r.Attrs)
+	return m
+}
+
+func nest(m map[string]any, attrs []slog.Attr) {
+	for _, a := range attrs {
+		if a.Value.Kind() == slog.KindGroup {
+			g := map[string]any{}
+			nest(g, a.Value.Group())
+			m[a.Key] = g
+			continue
+		}
+		m[a.Key] = a.Value.Any()
+	}
+}
+
+type Option interface {
+	apply(opt *option)
+}
+
+type optionFn func(opt *option)
+
+func (fn optionFn) apply(opt *option) {
+	fn(opt)
+}
+
+type option struct {
+	level slog.Leveler
+}
+
+// WithLevel はキャプチャするレベルを指定する。デフォルトは全てのレベル
+// logging.LevelControllerを指定するとlogging.Namedのロガー名の上書きにも従う
+func WithLevel(level slog.Leveler) Option {
+	return optionFn(func(opt *option) {
+		opt.level = level
+	})
+}
+
+type store struct {
+	mu      sync.Mutex
+	records []Record
+	closed  bool
+}
+
+type groupOrAttrs struct {
+	group string
+	attrs []slog.Attr
+}
+
+// Handler はレコードをメモリに保持するハンドラー
+// WithAttrsとWithGroupで作成したハンドラーも同じレコードを共有する
+type Handler struct {
+	level slog.Leveler
+	store *store
+	goas  []groupOrAttrs
+}
+
+// New はテストで出力されたレコードをキャプチャするハンドラーを作成する
+//
+//	h := logtest.New()
+//	slog.SetDefault(h.Logger())
+//	...
+//	h.AssertLogged(t, logtest.AtLevel(slog.LevelError), logtest.HasAttr("user", "u1"))
+func New(opts ...Option) *Handler {
+	o := &option{level: slog.Level(-1 << 10)}
+	for _, opt := range opts {
+		opt.apply(o)
+	}
+	return &Handler{level: o.level, store: &store{}}
+}
+
+// Logger はこのハンドラーに出力するロガーを返す
+func (h *Handler) Logger() *slog.Logger {
+	return slog.New(h)
+}
+
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= logging.LevelFor(ctx, h.level)
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	attrs = resolve(attrs)
+	for _, goa := range slices.Backward(h.goas) {
+		if goa.group == "" {
+			attrs = append(slices.Clip(goa.attrs), attrs...)
+			continue
+		}
+		if len(attrs) == 0 {
+			continue
+		}
+		attrs = []slog.Attr{{Key: goa.group, Value: slog.GroupValue(attrs...)}}
+	}
+	h.store.mu.Lock()
+	defer h.store.mu.Unlock()
+	h.store.records = append(h.store.records, Record{
+		Time:    r.Time,
+		Level:   r.Level,
+		Message: r.Message,
+		PC:      r.PC,
+		Attrs:   attrs,
+	})
+	return nil
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	attrs = resolve(attrs)
+	if len(attrs) == 0 {
+		return h
+	}
+	return &Handler{level: h.level, store: h.store, goas: append(slices.Clip(h.goas), groupOrAttrs{attrs: attrs})}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &Handler{level: h.level, store: h.store, goas: append(slices.Clip(h.goas), groupOrAttrs{group: name})}
+}
+
+// Close はラップしたハンドラーから閉じられたことを記録する
+func (h *Handler) Close() error {
+	h.store.mu.Lock()
+	defer h.store.mu.Unlock()
+	h.store.closed = true
+	return nil
+}
+
+// Closed はCloseが呼ばれたかを返す
+func (h *Handler) Closed() bool {
+	h.store.mu.Lock()
+	defer h.store.mu.Unlock()
+	return h.store.closed
+}
+
+// Records はキャプチャしたレコードを出力順に返す
+func (h *Handler) Records() []Record {
+	h.store.mu.Lock()
+	defer h.store.mu.Unlock()
+	return slices.Clone(h.store.records)
+}
+
+// Reset はキャプチャしたレコードを破棄する
+func (h *Handler) Reset() {
+	h.store.mu.Lock()
+	defer h.store.mu.Unlock()
+	h.store.records = nil
+}
+
+// resolve はLogValuerを解決し、空の属性とグループを除いてキーのないグループを展開する
+func resolve(attrs []slog.Attr) []slog.Attr {
+	results := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		a.Value = a.Value.Resolve()
+		if a.Equal(slog.Attr{}) {
+			continue
+		}
+		if a.Value.Kind() != slog.KindGroup {
+			results = append(results, a)
+			continue
+		}
+		group := resolve(a.Value.Group())
+		if len(group) == 0 {
+			continue
+		}
+		if a.Key == "" {
+			results = append(results, group...)
+			continue
+		}
+		results = append(results, slog.Attr{Key: a.Key, Value: slog.GroupValue(group...)})
+	}
+	return results
+}
@@ -0,0 +1,187 @@
+package logtest
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/n-creativesystem/go-packages/lib/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeT struct {
+	errors []string
+	failed bool
+}
+
+func (t *fakeT) Errorf(format string, args ...any) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (t *fakeT) FailNow() {
+	t.failed = true
+}
+
+type lazyValue struct{}
+
+func (lazyValue) LogValue() slog.Value {
+	return slog.StringValue("resolved")
+}
+
+func TestHandlerCapture(t *testing.T) {
+	h := New()
+	log := h.Logger().With(slog.String("service", "api")).WithGroup("req")
+
+	log.Info("request", slog.Int("status", 200), slog.Any("lazy", lazyValue{}), slog.Group("empty"), slog.Attr{})
+	log.WithGroup("unused").Warn("no attrs")
+
+	records := h.Records()
+	require.Len(t, records, 2)
+	r := records[0]
+	assert.Equal(t, slog.LevelInfo, r.Level)
+	assert.Equal(t, "request", r.Message)
+	assert.False(t, r.Time.IsZero())
+	// グループは入れ子のまま保持し、LogValuerは解決する
+	assert.Equal(t, map[string]any{
+		"service":    "api",
+		"req.status": int64(200),
+		"req.lazy":   "resolved",
+	}, r.Flatten())
+	v, ok := r.Value("req.status")
+	require.True(t, ok)
+	assert.Equal(t, int64(200), v.Int64())
+	_, ok = r.Value("req.empty")
+	assert.False(t, ok)
+
+	// 属性のないグループは出力しない
+	assert.Equal(t, map[string]any{"service": "api"}, records[1].Flatten())
+
+	h.Reset()
+	assert.Empty(t, h.Records())
+}
+
+func TestHandlerLevel(t *testing.T) {
+	h := New(WithLevel(slog.LevelWarn))
+	h.Logger().Info("info")
+	h.Logger().Error("error")
+	require.Len(t, h.Records(), 1)
+	assert.Equal(t, "error", h.Records()[0].Message)
+}
+
+func TestHandlerNamedLevel(t *testing.T) {
+	c := logging.NewLevelController(slog.LevelInfo)
+	c.SetOverride("db", slog.LevelDebug)
+	h := New(WithLevel(c))
+	h.Logger().Debug("root")
+	logging.Named(h.Logger(), "db").Debug("db")
+	require.Len(t, h.Records(), 1)
+	assert.Equal(t, "db", h.Records()[0].Message)
+}
+
+func TestHandlerClose(t *testing.T) {
+	h := New()
+	assert.False(t, h.Closed())
+	require.NoError(t, h.WithGroup("g").(*Handler).Close())
+	assert.True(t, h.Closed())
+}
+
+func TestQuery(t *testing.T) {
+	h := New()
+	log := h.Logger()
+	log.Info("user created", slog.String("user", "u1"))
+	log.Error("user update failed", slog.String("user", "u1"), slog.Any("error", errors.New("boom")))
+	log.Error("user update failed", slog.String("user", "u2"), slog.Group("http", slog.Int("status", 500)))
+
+	assert.Equal(t, 2, h.Count(AtLevel(slog.LevelError)))
+	assert.Equal(t, 3, h.Count(MinLevel(slog.LevelInfo)))
+	assert.Equal(t, 2, h.Count(Message("user update failed")))
+	assert.Equal(t, 3, h.Count(MessageMatches(`^user (created|update)`)))
+	assert.Equal(t, 2, h.Count(HasAttr("user", "u1")))
+	assert.Equal(t, 1, h.Count(HasAttr("http.status", 500)))
+	assert.Equal(t, 1, h.Count(HasKey("error")))
+	assert.Equal(t, 1, h.Count(Func("error message", func(r Record) bool {
+		v, ok := r.Value("error")
+		return ok && v.Any().(error).Error() == "boom"
+	})))
+
+	r, ok := h.Find(AtLevel(slog.LevelError), HasAttr("user", "u2"))
+	require.True(t, ok)
+	assert.Equal(t, "user update failed", r.Message)
+	_, ok = h.Find(HasAttr("user", "u3"))
+	assert.False(t, ok)
+	assert.Len(t, h.Filter(HasAttr("user", "u1")), 2)
+}
+
+func TestAssertions(t *testing.T) {
+	h := New()
+	h.Logger().Warn("disk almost full", slog.Int("percent", 91))
+
+	h.AssertLogged(t, AtLevel(slog.LevelWarn), HasAttr("percent", 91))
+	h.AssertNotLogged(t, AtLevel(slog.LevelError))
+	h.AssertCount(t, 1, MessageMatches("disk"))
+	r := h.RequireLogged(t, Message("disk almost full"))
+	assert.Equal(t, slog.LevelWarn, r.Level)
+
+	// 失敗したときは条件とキャプチャしたレコードを出力する
+	ft := &fakeT{}
+	assert.False(t, h.AssertLogged(ft, AtLevel(slog.LevelError), Message("boom")))
+	require.Len(t, ft.errors, 1)
+	assert.Contains(t, ft.errors[0], `no record matches level=ERROR, msg="boom"`)
+	assert.Contains(t, ft.errors[0], `WARN msg="disk almost full" percent=91`)
+
+	ft = &fakeT{}
+	assert.False(t, h.AssertNotLogged(ft, AtLevel(slog.LevelWarn)))
+	assert.False(t, h.AssertCount(ft, 2))
+	assert.Len(t, ft.errors, 2)
+
+	ft = &fakeT{}
+	h.RequireLogged(ft, AtLevel(slog.LevelError))
+	assert.True(t, ft.failed)
+}
+
+func TestRecordString(t *testing.T) {
+	r := Record{
+		Time:    time.Now(),
+		Level:   slog.LevelInfo,
+		Message: "hello world",
+		Attrs: []slog.Attr{
+			slog.String("name", "a b"),
+			slog.Group("g", slog.Int("n", 1), slog.Bool("ok", true)),
+		},
+	}
+	// 時刻は出力しない
+	assert.Equal(t, `INFO msg="hello world" name="a b" g.n=1 g.ok=true`, r.String())
+}
+
+func TestAssertGolden(t *testing.T) {
+	h := New()
+	log := h.Logger().With(slog.String("service", "api"))
+	log.Info("server started", slog.Int("port", 8080))
+	log.WithGroup("db").Error("query failed", slog.String("table", "users"), slog.Duration("elapsed", 1500*time.Millisecond))
+
+	h.AssertGolden(t, "golden")
+
+	// ファイルがなければ失敗する
+	ft := &fakeT{}
+	assert.False(t, h.AssertGolden(ft, "missing"))
+	require.Len(t, ft.errors, 1)
+	assert.Contains(t, ft.errors[0], UpdateGoldenEnv+"=1")
+}
+
+func TestAssertGoldenUpdate(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv(UpdateGoldenEnv, "1")
+
+	h := New()
+	h.Logger().Info("created")
+	require.True(t, h.AssertGolden(t, "new"))
+
+	// 更新したファイルと比較できる
+	t.Setenv(UpdateGoldenEnv, "")
+	require.True(t, h.AssertGolden(t, "new"))
+	h.Logger().Info("changed")
+	assert.False(t, h.AssertGolden(&fakeT{}, "new"))
+}
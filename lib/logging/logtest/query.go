@@ -0,0 +1,123 @@
+package logtest
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+)
+
+// Matcher はレコードが条件に一致するかを判定する
+type Matcher interface {
+	Match(r Record) bool
+	String() string
+}
+
+type matcher struct {
+	match func(r Record) bool
+	desc  string
+}
+
+func (m matcher) Match(r Record) bool {
+	return m.match(r)
+}
+
+func (m matcher) String() string {
+	return m.desc
+}
+
+// AtLevel はレベルが一致するレコードに一致する
+func AtLevel(level slog.Level) Matcher {
+	return matcher{
+		match: func(r Record) bool { return r.Level == level },
+		desc:  "level=" + level.String(),
+	}
+}
+
+// MinLevel はレベル以上のレコードに一致する
+func MinLevel(level slog.Level) Matcher {
+	return matcher{
+		match: func(r Record) bool { return r.Level >= level },
+		desc:  "level>=" + level.String(),
+	}
+}
+
+// Message はメッセージが一致するレコードに一致する
+func Message(msg string) Matcher {
+	return matcher{
+		match: func(r Record) bool { return r.Message == msg },
+		desc:  fmt.Sprintf("msg=%q", msg),
+	}
+}
+
+// MessageMatches はメッセージが正規表現に一致するレコードに一致する
+func MessageMatches(pattern string) Matcher {
+	re := regexp.MustCompile(pattern)
+	return matcher{
+		match: func(r Record) bool { return re.MatchString(r.Message) },
+		desc:  fmt.Sprintf("msg=~/%s/", pattern),
+	}
+}
+
+// HasKey は "group.key" 形式のキーの属性を持つレコードに一致する
+func HasKey(key string) Matcher {
+	return matcher{
+		match: func(r Record) bool {
+			_, ok := r.Value(key)
+			return ok
+		},
+		desc: "has " + key,
+	}
+}
+
+// HasAttr は "group.key" 形式のキーの属性の値が一致するレコードに一致する
+// 値はslog.AnyValueで比較するため、intとint64のような違いは区別しない
+func HasAttr(key string, value any) Matcher {
+	want := slog.AnyValue(value).Resolve()
+	return matcher{
+		match: func(r Record) bool {
+			got, ok := r.Value(key)
+			return ok && got.Equal(want)
+		},
+		desc: fmt.Sprintf("%s=%v", key, value),
+	}
+}
+
+// Func は任意の条件で一致する
+func Func(desc string, fn func(r Record) bool) Matcher {
+	return matcher{match: fn, desc: desc}
+}
+
+func matchAll(r Record, matchers []Matcher) bool {
+	for _, m := range matchers {
+		if !m.Match(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter は全ての条件に一致するレコードを返す
+func (h *Handler) Filter(matchers ...Matcher) []Record {
+	var results []Record
+	for _, r := range h.Records() {
+		if matchAll(r, matchers) {
+			results = append(results, r)
+		}
+	}
+	return results
+}
+
+// Find は全ての条件に一致する最初のレコードを返す
+func (h *Handler) Find(matchers ...Matcher) (Record, bool) {
+	for _, r := range h.Records() {
+		if matchAll(r, matchers) {
+			return r, true
+		}
+	}
+	return Record{}, false
+}
+
+// Count は全ての条件に一致するレコードの数を返す
+func (h *Handler) Count(matchers ...Matcher) int {
+	return len(h.Filter(matchers...))
+}
@@ -38,11 +38,15 @@ func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
 	return slices.Contains(flags, true)
 }
 
+func (h *handler) acceptReplay() {}
+
+// Handle は子ハンドラー毎にレコードを複製して渡す
+// 子ハンドラーがAddAttrsでレコードを変更しても他の子ハンドラーには影響しない
 func (h *handler) Handle(ctx context.Context, record slog.Record) error {
 	var err error
 	h.handler(func(h slog.Handler) {
-		if h.Enabled(ctx, record.Level) {
-			if e := h.Handle(ctx, record); e != nil {
+		if replayEnabled(ctx, h, record.Level) {
+			if e := h.Handle(ctx, record.Clone()); e != nil {
 				err = errors.Join(err, e)
 			}
 		}
@@ -5,9 +5,14 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestMultiHandler(t *testing.T) {
@@ -186,3 +191,85 @@ type mockCloseableHandler struct {
 func (m *mockCloseableHandler) Close() error {
 	return m.closeFn()
 }
+
+func TestMultiHandlerCloneRecord(t *testing.T) {
+	recorder1 := &contextRecordHandler{mockHandler: mockHandler{enabled: true}}
+	recorder2 := &contextRecordHandler{mockHandler: mockHandler{enabled: true}}
+	ddArgs := DDArgs{ServiceName: "test-service"}
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{15: 0x01},
+		SpanID:  trace.SpanID{7: 0x01},
+	}))
+
+	// 子ハンドラーが追加した属性は他の子ハンドラーに漏れない
+	h := NewHandler(NewDatadogHandler(ddArgs, recorder1), recorder2)
+	r := slog.NewRecord(time.Now(), slog.LevelInfo, "message", 0)
+	r.AddAttrs(slog.String("key", "value"))
+	require.NoError(t, h.Handle(ctx, r))
+
+	require.Len(t, recorder1.attrs[0], 6)
+	require.Equal(t, [][]slog.Attr{{slog.String("key", "value")}}, recorder2.attrs)
+}
+
+func TestMultiHandlerRace(t *testing.T) {
+	ddArgs := DDArgs{
+		ServiceName: "test-service",
+		Environment: "test",
+		Version:     "1.0.0",
+	}
+	buf1 := &syncBuffer{}
+	buf2 := &syncBuffer{}
+	async1 := NewAsyncHandler(NewProcessHandler(NewJSONHandler(WithWriter(buf1))), WithOverflow(OverflowBlock))
+	async2 := NewAsyncHandler(NewDatadogHandler(ddArgs, NewTextHandler(WithWriter(buf2))), WithOverflow(OverflowBlock), WithWorkers(4))
+	h := NewHandler(
+		NewDatadogHandler(ddArgs, NewHandler(async1, async2)),
+		NewProcessHandler(async1),
+	)
+	logger := slog.New(h).With(slog.String("component", "test"))
+
+	tp := sdktrace.NewTracerProvider()
+	defer func() {
+		_ = tp.Shutdown(context.Background())
+	}()
+	ctx, span := tp.Tracer("test-tracer").Start(context.Background(), "test-span")
+	defer span.End()
+
+	const goroutines, records = 8, 50
+	var wg sync.WaitGroup
+	for g := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range records {
+				// 6個以上の属性でレコードの共有領域を使わせる
+				logger.InfoContext(ctx, "race message",
+					slog.Int("goroutine", g), slog.Int("index", i),
+					slog.String("a", "a"), slog.String("b", "b"),
+					slog.String("c", "c"), slog.String("d", "d"),
+				)
+			}
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, h.Close())
+
+	require.Equal(t, 2*goroutines*records, strings.Count(buf1.String(), "race message"))
+	require.Equal(t, goroutines*records, strings.Count(buf2.String(), "race message"))
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
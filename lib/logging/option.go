@@ -1,8 +1,10 @@
 package logging
 
 import (
+	"errors"
 	"io"
 	"log/slog"
+	"maps"
 	"os"
 	"time"
 )
@@ -19,29 +21,32 @@ func (fn optionFn) apply(opt *option) {
 
 type ReplaceAttr func(groups []string, a slog.Attr) slog.Attr
 
+// WithTimeFormatで指定できるレイアウト以外の形式
+const (
+	// TimeFormatUnix はUNIX時間の秒を数値で出力する
+	TimeFormatUnix = "unix"
+	// TimeFormatUnixMilli はUNIX時間のミリ秒を数値で出力する
+	TimeFormatUnixMilli = "unixmilli"
+)
+
 type option struct {
 	writer      io.Writer
 	level       slog.Leveler
 	handler     slog.Handler
 	replaceAttr ReplaceAttr
-}
-
-func defaultReplaceAttr(groups []string, a slog.Attr) slog.Attr {
-	if a.Key == "time" {
-		return slog.String(a.Key, time.Now().Format(time.RFC3339))
-	}
-	return a
+	addSource   bool
+	timeFormat  string
+	location    *time.Location
+	keys        map[string]string
+	// closers はWithFileで作成した出力先を閉じる関数
+	closers []func() error
 }
 
 var (
 	defaultOption = &option{
-		writer: os.Stdout,
-		level:  slog.LevelInfo,
-		handler: slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-			Level:       slog.LevelInfo,
-			ReplaceAttr: defaultReplaceAttr,
-		}),
-		replaceAttr: defaultReplaceAttr,
+		writer:     os.Stdout,
+		level:      defaultLevel,
+		timeFormat: time.RFC3339,
 	}
 )
 
@@ -53,6 +58,66 @@ func defaultOptions(opts ...Option) *option {
 	return &o
 }
 
+// close はWithFileで作成した出力先を閉じる
+func (o *option) close() error {
+	var err error
+	for _, fn := range o.closers {
+		err = errors.Join(err, fn())
+	}
+	return err
+}
+
+// handlerOptions はJSONとテキストのハンドラーに渡すオプションを返す
+func (o *option) handlerOptions() *slog.HandlerOptions {
+	return &slog.HandlerOptions{
+		Level:       o.level,
+		AddSource:   o.addSource,
+		ReplaceAttr: o.replace,
+	}
+}
+
+// replace は時刻とレベルを変換してから利用者のReplaceAttrを呼び、最後にキーを変更する
+func (o *option) replace(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) == 0 {
+		switch a.Key {
+		case slog.TimeKey:
+			a = o.formatTime(a)
+		case slog.LevelKey:
+			a = replaceLevelAttr(groups, a)
+		}
+	}
+	if o.replaceAttr != nil {
+		a = o.replaceAttr(groups, a)
+	}
+	if len(groups) == 0 {
+		if key, ok := o.keys[a.Key]; ok {
+			a.Key = key
+		}
+	}
+	return a
+}
+
+// formatTime はレコードの時刻をタイムゾーンと形式に合わせて変換する
+func (o *option) formatTime(a slog.Attr) slog.Attr {
+	if a.Value.Kind() != slog.KindTime {
+		return a
+	}
+	t := a.Value.Time()
+	if o.location != nil {
+		t = t.In(o.location)
+	}
+	switch o.timeFormat {
+	case TimeFormatUnix:
+		return slog.Int64(a.Key, t.Unix())
+	case TimeFormatUnixMilli:
+		return slog.Int64(a.Key, t.UnixMilli())
+	case "":
+		return slog.Time(a.Key, t)
+	default:
+		return slog.String(a.Key, t.Format(o.timeFormat))
+	}
+}
+
 func WithWriter(writer io.Writer) Option {
 	return optionFn(func(opt *option) {
 		opt.writer = writer
@@ -65,14 +130,56 @@ func WithLevel(level slog.Leveler) Option {
 	})
 }
 
+// WithHandler はNewで組み立てるハンドラーに指定したハンドラーを追加する
 func WithHandler(handler slog.Handler) Option {
 	return optionFn(func(opt *option) {
 		opt.handler = handler
 	})
 }
 
+// WithReplaceAttr は時刻とレベルの変換の後に呼ぶReplaceAttrを指定する
+// キーの変更はこの関数の後に行うため、関数には変更前のキーが渡る
 func WithReplaceAttr(attrFn ReplaceAttr) Option {
 	return optionFn(func(opt *option) {
 		opt.replaceAttr = attrFn
 	})
 }
+
+// WithAddSource は呼び出し元のファイルと行番号を出力する
+func WithAddSource() Option {
+	return optionFn(func(opt *option) {
+		opt.addSource = true
+	})
+}
+
+// WithTimeFormat は時刻の形式を指定する。デフォルトはtime.RFC3339
+// time.RFC3339Nanoなどのレイアウト、TimeFormatUnix、TimeFormatUnixMilliを指定できる
+func WithTimeFormat(layout string) Option {
+	return optionFn(func(opt *option) {
+		opt.timeFormat = layout
+	})
+}
+
+// WithTimeZone は時刻を指定したタイムゾーンで出力する
+func WithTimeZone(loc *time.Location) Option {
+	return optionFn(func(opt *option) {
+		opt.location = loc
+	})
+}
+
+// WithKeys はトップレベルの属性のキーを変更する
+//
+//	logging.WithKeys(map[string]string{
+//		slog.MessageKey: "message",
+//		slog.LevelKey:   "severity",
+//	})
+func WithKeys(keys map[string]string) Option {
+	return optionFn(func(opt *option) {
+		if opt.keys == nil {
+			opt.keys = make(map[string]string, len(keys))
+		} else {
+			opt.keys = maps.Clone(opt.keys)
+		}
+		maps.Copy(opt.keys, keys)
+	})
+}
@@ -5,8 +5,10 @@ import (
 	"log/slog"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestWithOptions(t *testing.T) {
@@ -49,26 +51,96 @@ func TestWithHandler(t *testing.T) {
 func TestDefaultOption(t *testing.T) {
 	// デフォルトオプションの確認
 	assert.Equal(t, os.Stdout, defaultOption.writer)
-	assert.Equal(t, slog.LevelInfo, defaultOption.level)
-	assert.NotNil(t, defaultOption.handler)
-	assert.NotNil(t, defaultOption.replaceAttr)
-
-	// デフォルトのreplaceAttr関数のテスト
-	timeAttr := slog.String("time", "original")
-	modifiedAttr := defaultOption.replaceAttr([]string{}, timeAttr)
-	assert.Equal(t, "time", modifiedAttr.Key)
-	assert.NotEqual(t, "original", modifiedAttr.Value.String())
+	assert.Equal(t, defaultLevel, defaultOption.level)
+	assert.Equal(t, slog.LevelInfo, defaultOption.level.Level())
+	assert.Nil(t, defaultOption.handler)
+	assert.Nil(t, defaultOption.replaceAttr)
+	assert.Equal(t, time.RFC3339, defaultOption.timeFormat)
 }
 
-func TestDefaultReplaceAttr(t *testing.T) {
-	// 時間フィールドの置換
-	timeAttr := slog.String("time", "original")
-	modifiedTimeAttr := defaultReplaceAttr([]string{}, timeAttr)
-	assert.Equal(t, "time", modifiedTimeAttr.Key)
-	assert.NotEqual(t, "original", modifiedTimeAttr.Value.String())
+func TestDefaultReplace(t *testing.T) {
+	// 時刻はレコードの時刻をRFC3339で出力する
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	a := defaultOption.replace(nil, slog.Time(slog.TimeKey, ts))
+	assert.Equal(t, slog.TimeKey, a.Key)
+	assert.Equal(t, "2024-01-02T03:04:05Z", a.Value.String())
+
+	// グループ内のtimeは変換しない
+	a = defaultOption.replace([]string{"g"}, slog.Time(slog.TimeKey, ts))
+	assert.Equal(t, slog.KindTime, a.Value.Kind())
 
 	// 他のフィールドはそのまま
 	otherAttr := slog.String("other", "value")
-	modifiedOtherAttr := defaultReplaceAttr([]string{}, otherAttr)
-	assert.Equal(t, otherAttr, modifiedOtherAttr)
+	assert.Equal(t, otherAttr, defaultOption.replace(nil, otherAttr))
+}
+
+func TestTimeFormat(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 6000000, time.UTC)
+	jst := time.FixedZone("JST", 9*60*60)
+	tests := []struct {
+		name string
+		opts []Option
+		want any
+	}{
+		{name: "RFC3339Nano", opts: []Option{WithTimeFormat(time.RFC3339Nano)}, want: "2024-01-02T03:04:05.006Z"},
+		{name: "unix", opts: []Option{WithTimeFormat(TimeFormatUnix)}, want: float64(ts.Unix())},
+		{name: "unixmilli", opts: []Option{WithTimeFormat(TimeFormatUnixMilli)}, want: float64(ts.UnixMilli())},
+		{name: "custom", opts: []Option{WithTimeFormat("2006/01/02 15:04")}, want: "2024/01/02 03:04"},
+		{name: "timezone", opts: []Option{WithTimeZone(jst)}, want: "2024-01-02T12:04:05+09:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			h := NewJSONHandler(append(tt.opts, WithWriter(buf))...)
+			r := slog.NewRecord(ts, slog.LevelInfo, "message", 0)
+			require.NoError(t, h.Handle(t.Context(), r))
+			assert.Equal(t, tt.want, decodeJSONLine(t, buf)["time"])
+		})
+	}
+}
+
+func TestReplaceAttrChain(t *testing.T) {
+	buf := &bytes.Buffer{}
+	var seen []string
+	log := slog.New(NewJSONHandler(
+		WithWriter(buf),
+		WithKeys(map[string]string{slog.MessageKey: "message", slog.LevelKey: "severity"}),
+		WithReplaceAttr(func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 {
+				seen = append(seen, a.Key)
+			}
+			// 利用者の関数にはレベルの名前を変換した後の値が渡る
+			if a.Key == slog.LevelKey {
+				assert.Equal(t, "NOTICE", a.Value.String())
+			}
+			if a.Key == "secret" {
+				return slog.String(a.Key, "***")
+			}
+			return a
+		}),
+	))
+
+	log.Log(t.Context(), LevelNotice, "hello", slog.String("secret", "value"))
+
+	m := decodeJSONLine(t, buf)
+	assert.Equal(t, "hello", m["message"])
+	assert.Equal(t, "NOTICE", m["severity"])
+	assert.Equal(t, "***", m["secret"])
+	assert.NotContains(t, m, "msg")
+	assert.NotContains(t, m, "level")
+	// キーの変更前に利用者の関数を呼ぶ
+	assert.Contains(t, seen, slog.MessageKey)
+}
+
+func TestAddSource(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(NewTextHandler(WithWriter(buf), WithAddSource(), WithKeys(map[string]string{slog.SourceKey: "caller"})))
+	log.Info("message")
+	assert.Contains(t, buf.String(), "caller=")
+	assert.Contains(t, buf.String(), "option_test.go:")
+
+	// 指定しなければ出力しない
+	buf.Reset()
+	slog.New(NewTextHandler(WithWriter(buf))).Info("message")
+	assert.NotContains(t, buf.String(), "option_test.go")
 }
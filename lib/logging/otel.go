@@ -0,0 +1,228 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceFormat はトレースIDの出力形式
+type TraceFormat int
+
+const (
+	// TraceFormatW3C はW3C Trace Contextの16進数で出力する
+	TraceFormatW3C TraceFormat = iota
+	// TraceFormatGCP はCloud Loggingがトレースと関連付ける形式で出力する
+	// Cloud LoggingはプロジェクトIDのないトレースIDを関連付けないため、WithGCPProjectIDがなければトレースIDは出力しない
+	TraceFormatGCP
+	// TraceFormatXRay はAWS X-RayのトレースID形式で出力する
+	TraceFormatXRay
+)
+
+type OTelOption interface {
+	apply(opt *otelOption)
+}
+
+type otelOptionFn func(opt *otelOption)
+
+func (fn otelOptionFn) apply(opt *otelOption) {
+	fn(opt)
+}
+
+type otelKeys struct {
+	traceID    string
+	spanID     string
+	traceFlags string
+}
+
+type otelOption struct {
+	format       TraceFormat
+	keys         *otelKeys
+	projectID    string
+	eventEnabled bool
+	eventLevel   slog.Level
+}
+
+func (o *otelOption) traceKeys() otelKeys {
+	if o.keys != nil {
+		return *o.keys
+	}
+	switch o.format {
+	case TraceFormatGCP:
+		return otelKeys{
+			traceID:    "logging.googleapis.com/trace",
+			spanID:     "logging.googleapis.com/spanId",
+			traceFlags: "logging.googleapis.com/trace_sampled",
+		}
+	case TraceFormatXRay:
+		return otelKeys{
+			traceID:    "xray_trace_id",
+			spanID:     "xray_segment_id",
+			traceFlags: "xray_sampled",
+		}
+	default:
+		return otelKeys{
+			traceID:    "trace_id",
+			spanID:     "span_id",
+			traceFlags: "trace_flags",
+		}
+	}
+}
+
+func WithTraceFormat(format TraceFormat) OTelOption {
+	return otelOptionFn(func(opt *otelOption) {
+		opt.format = format
+	})
+}
+
+// WithGCPProjectID はTraceFormatGCPで出力する "projects/{id}/traces/{trace_id}" のプロジェクトIDを指定する
+func WithGCPProjectID(projectID string) OTelOption {
+	return otelOptionFn(func(opt *otelOption) {
+		opt.format = TraceFormatGCP
+		opt.projectID = projectID
+	})
+}
+
+// WithTraceKeys は出力するキー名を指定する。空文字のキーは出力しない
+func WithTraceKeys(traceID, spanID, traceFlags string) OTelOption {
+	return otelOptionFn(func(opt *otelOption) {
+		opt.keys = &otelKeys{
+			traceID:    traceID,
+			spanID:     spanID,
+			traceFlags: traceFlags,
+		}
+	})
+}
+
+// WithSpanEvent は指定したレベル以上のレコードをスパンのイベントとしても記録する
+func WithSpanEvent(level slog.Level) OTelOption {
+	return otelOptionFn(func(opt *otelOption) {
+		opt.eventEnabled = true
+		opt.eventLevel = level
+	})
+}
+
+type otelHandler struct {
+	topLevelHandler
+	option *otelOption
+	groups []string
+}
+
+var (
+	_ Handle = (*otelHandler)(nil)
+)
+
+// NewOTelHandler はコンテキストのスパンからトレースIDとスパンIDをレコードに付与する
+// スパンコンテキストが不正な場合は何も付与しない
+func NewOTelHandler(handler slog.Handler, opts ...OTelOption) Handle {
+	o := &otelOption{}
+	for _, opt := range opts {
+		opt.apply(o)
+	}
+	return &otelHandler{topLevelHandler: topLevelHandler{Handler: handler}, option: o}
+}
+
+func (h *otelHandler) Handle(ctx context.Context, record slog.Record) error {
+	span := trace.SpanFromContext(ctx)
+	sc := span.SpanContext()
+	if !sc.IsValid() {
+		return h.handle(ctx, record, nil)
+	}
+	if h.option.eventEnabled && record.Level >= h.option.eventLevel && span.IsRecording() {
+		span.AddEvent(record.Message, trace.WithTimestamp(record.Time), trace.WithAttributes(h.eventAttributes(record)...))
+	}
+
+	keys := h.option.traceKeys()
+	attrs := make([]slog.Attr, 0, 3)
+	if traceID, ok := h.formatTraceID(sc); ok && keys.traceID != "" {
+		attrs = append(attrs, slog.String(keys.traceID, traceID))
+	}
+	if keys.spanID != "" {
+		attrs = append(attrs, slog.String(keys.spanID, sc.SpanID().String()))
+	}
+	if keys.traceFlags != "" {
+		switch h.option.format {
+		case TraceFormatW3C:
+			attrs = append(attrs, slog.String(keys.traceFlags, sc.TraceFlags().String()))
+		default:
+			attrs = append(attrs, slog.Bool(keys.traceFlags, sc.IsSampled()))
+		}
+	}
+	// グループの中ではなくトップレベルに出力する
+	return h.handle(ctx, record, attrs)
+}
+
+// formatTraceID は出力形式に合わせたトレースIDを返す。出力しない場合はfalseを返す
+func (h *otelHandler) formatTraceID(sc trace.SpanContext) (string, bool) {
+	traceID := sc.TraceID().String()
+	switch h.option.format {
+	case TraceFormatGCP:
+		if h.option.projectID == "" {
+			return "", false
+		}
+		return fmt.Sprintf("projects/%s/traces/%s", h.option.projectID, traceID), true
+	case TraceFormatXRay:
+		return fmt.Sprintf("1-%s-%s", traceID[:8], traceID[8:]), true
+	}
+	return traceID, true
+}
+
+func (h *otelHandler) eventAttributes(record slog.Record) []attribute.KeyValue {
+	prefix := strings.Join(h.groups, ".")
+	attrs := []attribute.KeyValue{attribute.String("log.severity", record.Level.String())}
+	record.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, otelAttributes(prefix, a)...)
+		return true
+	})
+	return attrs
+}
+
+func (h *otelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &otelHandler{topLevelHandler: h.withAttrs(attrs), option: h.option, groups: h.groups}
+}
+
+func (h *otelHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &otelHandler{topLevelHandler: h.withGroup(name), option: h.option, groups: append(slices.Clip(h.groups), name)}
+}
+
+// otelAttributes はslogの属性をOpenTelemetryの属性に変換する。グループは "." で連結したキーに展開する
+func otelAttributes(prefix string, a slog.Attr) []attribute.KeyValue {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return nil
+	}
+	key := a.Key
+	if prefix != "" {
+		key = prefix + "." + key
+	}
+	v := a.Value
+	switch v.Kind() {
+	case slog.KindGroup:
+		if a.Key == "" {
+			key = prefix
+		}
+		var results []attribute.KeyValue
+		for _, ga := range v.Group() {
+			results = append(results, otelAttributes(key, ga)...)
+		}
+		return results
+	case slog.KindBool:
+		return []attribute.KeyValue{attribute.Bool(key, v.Bool())}
+	case slog.KindInt64:
+		return []attribute.KeyValue{attribute.Int64(key, v.Int64())}
+	case slog.KindUint64:
+		return []attribute.KeyValue{attribute.Int64(key, int64(v.Uint64()))}
+	case slog.KindFloat64:
+		return []attribute.KeyValue{attribute.Float64(key, v.Float64())}
+	default:
+		return []attribute.KeyValue{attribute.String(key, v.String())}
+	}
+}
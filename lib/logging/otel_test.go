@@ -0,0 +1,165 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTestSpanContext(t *testing.T, sampled bool) context.Context {
+	t.Helper()
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	require.NoError(t, err)
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	require.NoError(t, err)
+	cfg := trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}
+	if sampled {
+		cfg.TraceFlags = trace.FlagsSampled
+	}
+	return trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(cfg))
+}
+
+func TestOTelHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(NewOTelHandler(NewJSONHandler(WithWriter(buf))))
+	log.InfoContext(newTestSpanContext(t, true), "w3c")
+
+	m := decodeJSONLine(t, buf)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", m["trace_id"])
+	require.Equal(t, "00f067aa0ba902b7", m["span_id"])
+	require.Equal(t, "01", m["trace_flags"])
+}
+
+func TestOTelHandlerInvalidSpanContext(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(NewOTelHandler(NewJSONHandler(WithWriter(buf))))
+	log.InfoContext(context.Background(), "no span", slog.String("key", "value"))
+
+	// スパンコンテキストが不正な場合は付与しない
+	m := decodeJSONLine(t, buf)
+	require.Equal(t, "value", m["key"])
+	require.NotContains(t, m, "trace_id")
+	require.NotContains(t, m, "span_id")
+	require.NotContains(t, m, "trace_flags")
+}
+
+func TestOTelHandlerFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []OTelOption
+		want map[string]any
+	}{
+		{
+			name: "gcp",
+			opts: []OTelOption{WithTraceFormat(TraceFormatGCP)},
+			// プロジェクトIDがなければトレースIDは関連付けられないため出力しない
+			want: map[string]any{
+				"logging.googleapis.com/trace":         nil,
+				"logging.googleapis.com/spanId":        "00f067aa0ba902b7",
+				"logging.googleapis.com/trace_sampled": true,
+			},
+		},
+		{
+			name: "gcp with project id",
+			opts: []OTelOption{WithGCPProjectID("my-project")},
+			want: map[string]any{
+				"logging.googleapis.com/trace":         "projects/my-project/traces/4bf92f3577b34da6a3ce929d0e0e4736",
+				"logging.googleapis.com/spanId":        "00f067aa0ba902b7",
+				"logging.googleapis.com/trace_sampled": true,
+			},
+		},
+		{
+			name: "xray",
+			opts: []OTelOption{WithTraceFormat(TraceFormatXRay)},
+			want: map[string]any{
+				"xray_trace_id":   "1-4bf92f35-77b34da6a3ce929d0e0e4736",
+				"xray_segment_id": "00f067aa0ba902b7",
+				"xray_sampled":    true,
+			},
+		},
+		{
+			name: "custom keys",
+			opts: []OTelOption{WithTraceKeys("traceId", "spanId", "")},
+			want: map[string]any{
+				"traceId": "4bf92f3577b34da6a3ce929d0e0e4736",
+				"spanId":  "00f067aa0ba902b7",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			log := slog.New(NewOTelHandler(NewJSONHandler(WithWriter(buf)), tt.opts...))
+			log.InfoContext(newTestSpanContext(t, true), tt.name)
+
+			m := decodeJSONLine(t, buf)
+			for k, v := range tt.want {
+				require.Equal(t, v, m[k], k)
+			}
+			require.NotContains(t, m, "trace_flags")
+		})
+	}
+}
+
+func TestOTelHandlerWithGroup(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(NewOTelHandler(NewJSONHandler(WithWriter(buf)), WithGCPProjectID("my-project"))).
+		WithGroup("req").
+		With(slog.String("method", "GET"))
+	log.InfoContext(newTestSpanContext(t, false), "grouped")
+
+	// トレースIDはグループの外に出力する
+	m := decodeJSONLine(t, buf)
+	require.Equal(t, "projects/my-project/traces/4bf92f3577b34da6a3ce929d0e0e4736", m["logging.googleapis.com/trace"])
+	require.Equal(t, false, m["logging.googleapis.com/trace_sampled"])
+	require.Equal(t, map[string]any{"method": "GET"}, m["req"])
+}
+
+func TestOTelHandlerSpanEvent(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, span := tp.Tracer("test").Start(context.Background(), "operation")
+
+	buf := &bytes.Buffer{}
+	log := slog.New(NewOTelHandler(NewJSONHandler(WithWriter(buf)), WithSpanEvent(slog.LevelWarn))).WithGroup("db")
+	log.InfoContext(ctx, "info message")
+	log.WarnContext(ctx, "warn message", slog.String("table", "users"), slog.Int("rows", 3))
+	span.End()
+
+	// 指定したレベル以上のレコードだけイベントとして記録する
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	events := spans[0].Events()
+	require.Len(t, events, 1)
+	require.Equal(t, "warn message", events[0].Name)
+	require.ElementsMatch(t, []attribute.KeyValue{
+		attribute.String("log.severity", "WARN"),
+		attribute.String("db.table", "users"),
+		attribute.Int64("db.rows", 3),
+	}, events[0].Attributes)
+
+	require.Contains(t, buf.String(), span.SpanContext().TraceID().String())
+}
+
+func TestOTelAttributes(t *testing.T) {
+	attrs := otelAttributes("", slog.Group("http",
+		slog.Bool("ok", true),
+		slog.Float64("ratio", 0.5),
+		slog.Uint64("size", 10),
+		slog.Group("", slog.String("inline", "v")),
+	))
+	require.Equal(t, []attribute.KeyValue{
+		attribute.Bool("http.ok", true),
+		attribute.Float64("http.ratio", 0.5),
+		attribute.Int64("http.size", 10),
+		attribute.String("http.inline", "v"),
+	}, attrs)
+	require.Nil(t, otelAttributes("", slog.Attr{}))
+}
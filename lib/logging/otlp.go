@@ -0,0 +1,293 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+)
+
+const (
+	otlpScopeName       = "github.com/n-creativesystem/go-packages/lib/logging"
+	otlpShutdownTimeout = 5 * time.Second
+)
+
+type OTLPConfig struct {
+	// Endpoint は "host:port" で指定する。空の場合はOTEL_EXPORTER_OTLP_ENDPOINTを使う
+	Endpoint string            `yaml:"endpoint" env:"LOG_OTLP_ENDPOINT"`
+	Insecure bool              `yaml:"insecure" env:"LOG_OTLP_INSECURE"`
+	Headers  map[string]string `yaml:"headers"`
+}
+
+func (c *OTLPConfig) options() []OTLPOption {
+	if c == nil {
+		return nil
+	}
+	var opts []OTLPOption
+	if c.Endpoint != "" {
+		opts = append(opts, WithOTLPEndpoint(c.Endpoint))
+	}
+	if c.Insecure {
+		opts = append(opts, WithOTLPInsecure())
+	}
+	if len(c.Headers) > 0 {
+		opts = append(opts, WithOTLPHeaders(c.Headers))
+	}
+	return opts
+}
+
+type OTLPOption interface {
+	apply(opt *otlpOption)
+}
+
+type otlpOptionFn func(opt *otlpOption)
+
+func (fn otlpOptionFn) apply(opt *otlpOption) {
+	fn(opt)
+}
+
+type otlpOption struct {
+	level        slog.Leveler
+	grpcOptions  []otlploggrpc.Option
+	batchOptions []sdklog.BatchProcessorOption
+	exporter     sdklog.Exporter
+	serviceName  string
+	version      string
+	environment  string
+}
+
+func WithOTLPLevel(level slog.Leveler) OTLPOption {
+	return otlpOptionFn(func(opt *otlpOption) {
+		opt.level = level
+	})
+}
+
+func WithOTLPEndpoint(endpoint string) OTLPOption {
+	return otlpOptionFn(func(opt *otlpOption) {
+		opt.grpcOptions = append(opt.grpcOptions, otlploggrpc.WithEndpoint(endpoint))
+	})
+}
+
+func WithOTLPInsecure() OTLPOption {
+	return otlpOptionFn(func(opt *otlpOption) {
+		opt.grpcOptions = append(opt.grpcOptions, otlploggrpc.WithInsecure())
+	})
+}
+
+func WithOTLPHeaders(headers map[string]string) OTLPOption {
+	return otlpOptionFn(func(opt *otlpOption) {
+		opt.grpcOptions = append(opt.grpcOptions, otlploggrpc.WithHeaders(headers))
+	})
+}
+
+// WithOTLPGRPCOption はエクスポーターのオプションを追加する
+func WithOTLPGRPCOption(opts ...otlploggrpc.Option) OTLPOption {
+	return otlpOptionFn(func(opt *otlpOption) {
+		opt.grpcOptions = append(opt.grpcOptions, opts...)
+	})
+}
+
+func WithOTLPBatchOption(opts ...sdklog.BatchProcessorOption) OTLPOption {
+	return otlpOptionFn(func(opt *otlpOption) {
+		opt.batchOptions = append(opt.batchOptions, opts...)
+	})
+}
+
+// WithOTLPExporter はOTLP gRPCの代わりに指定したエクスポーターを使う
+func WithOTLPExporter(exporter sdklog.Exporter) OTLPOption {
+	return otlpOptionFn(func(opt *otlpOption) {
+		opt.exporter = exporter
+	})
+}
+
+// WithOTLPResource はtraceパッケージのTracerProviderと同じリソース属性を設定する
+func WithOTLPResource(serviceName, version, environment string) OTLPOption {
+	return otlpOptionFn(func(opt *otlpOption) {
+		opt.serviceName = serviceName
+		opt.version = version
+		opt.environment = environment
+	})
+}
+
+type otlpHandler struct {
+	provider *sdklog.LoggerProvider
+	logger   otellog.Logger
+	level    slog.Leveler
+	goas     []groupOrAttrs
+}
+
+var (
+	_ Handle = (*otlpHandler)(nil)
+)
+
+// NewOTLPHandler はslogのレコードをOpenTelemetryのログに変換してOTLPで送信する
+// コンテキストにスパンがあればトレースIDとスパンIDを関連付ける
+func NewOTLPHandler(ctx context.Context, opts ...OTLPOption) (Handle, error) {
+	o := &otlpOption{level: defaultLevel}
+	for _, opt := range opts {
+		opt.apply(o)
+	}
+	exporter := o.exporter
+	if exporter == nil {
+		var err error
+		exporter, err = otlploggrpc.New(ctx, o.grpcOptions...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	provider := sdklog.NewLoggerProvider(
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(exporter, o.batchOptions...)),
+		sdklog.WithResource(newOTLPResource(o.serviceName, o.version, o.environment)),
+	)
+	return &otlpHandler{
+		provider: provider,
+		logger:   provider.Logger(otlpScopeName),
+		level:    o.level,
+	}, nil
+}
+
+// newOTLPResource はtrace.newResourceと同じ属性を返す
+func newOTLPResource(serviceName, version, environment string) *resource.Resource {
+	return resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceNameKey.String(serviceName),
+		semconv.ServiceVersionKey.String(version),
+		semconv.DeploymentEnvironmentKey.String(environment),
+		attribute.String("environment", environment),
+		attribute.String("env", environment),
+	)
+}
+
+func (h *otlpHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= LevelFor(ctx, h.level)
+}
+
+func (h *otlpHandler) acceptReplay() {}
+
+func (h *otlpHandler) Handle(ctx context.Context, record slog.Record) error {
+	var r otellog.Record
+	r.SetTimestamp(record.Time)
+	r.SetObservedTimestamp(time.Now())
+	r.SetBody(otellog.StringValue(record.Message))
+	r.SetSeverity(otlpSeverity(record.Level))
+	r.SetSeverityText(record.Level.String())
+
+	attrs := make([]slog.Attr, 0, record.NumAttrs())
+	record.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	// グループの内側から順に組み立てる
+	for i := len(h.goas) - 1; i >= 0; i-- {
+		goa := h.goas[i]
+		if goa.group == "" {
+			attrs = append(slices.Clip(goa.attrs), attrs...)
+		} else {
+			attrs = []slog.Attr{slog.Group(goa.group, toInterface(attrs)...)}
+		}
+	}
+	r.AddAttributes(otlpKeyValues(attrs)...)
+
+	h.logger.Emit(ctx, r)
+	return nil
+}
+
+func (h *otlpHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return &otlpHandler{
+		provider: h.provider,
+		logger:   h.logger,
+		level:    h.level,
+		goas:     append(slices.Clip(h.goas), groupOrAttrs{attrs: attrs}),
+	}
+}
+
+func (h *otlpHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &otlpHandler{
+		provider: h.provider,
+		logger:   h.logger,
+		level:    h.level,
+		goas:     append(slices.Clip(h.goas), groupOrAttrs{group: name}),
+	}
+}
+
+// Close はバッファに残っているログを送信してエクスポーターを終了する
+func (h *otlpHandler) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), otlpShutdownTimeout)
+	defer cancel()
+	return h.provider.Shutdown(ctx)
+}
+
+// otlpSeverity はslogのレベルをOpenTelemetryのSeverityNumberに変換する
+// INFO(0)がSeverityInfo(9)になるようにずらし、範囲外は端に丸める
+func otlpSeverity(level slog.Level) otellog.Severity {
+	s := otellog.Severity(int(level) + int(otellog.SeverityInfo))
+	return min(max(s, otellog.SeverityTrace1), otellog.SeverityFatal4)
+}
+
+func otlpKeyValues(attrs []slog.Attr) []otellog.KeyValue {
+	results := make([]otellog.KeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		a.Value = a.Value.Resolve()
+		if a.Equal(slog.Attr{}) {
+			continue
+		}
+		if a.Value.Kind() == slog.KindGroup {
+			group := otlpKeyValues(a.Value.Group())
+			switch {
+			case len(group) == 0:
+				// slogと同じく属性のないグループは出力しない
+			case a.Key == "":
+				// 空のキーのグループは親に展開する
+				results = append(results, group...)
+			default:
+				results = append(results, otellog.Map(a.Key, group...))
+			}
+			continue
+		}
+		results = append(results, otellog.KeyValue{Key: a.Key, Value: otlpValue(a.Value)})
+	}
+	return results
+}
+
+func otlpValue(v slog.Value) otellog.Value {
+	switch v.Kind() {
+	case slog.KindBool:
+		return otellog.BoolValue(v.Bool())
+	case slog.KindInt64:
+		return otellog.Int64Value(v.Int64())
+	case slog.KindUint64:
+		return otellog.Int64Value(int64(v.Uint64()))
+	case slog.KindFloat64:
+		return otellog.Float64Value(v.Float64())
+	case slog.KindDuration:
+		return otellog.Int64Value(int64(v.Duration()))
+	case slog.KindTime:
+		return otellog.StringValue(v.Time().Format(time.RFC3339Nano))
+	case slog.KindAny:
+		switch val := v.Any().(type) {
+		case error:
+			return otellog.StringValue(val.Error())
+		case []byte:
+			return otellog.BytesValue(val)
+		case fmt.Stringer:
+			return otellog.StringValue(val.String())
+		}
+		return otellog.StringValue(v.String())
+	default:
+		return otellog.StringValue(v.String())
+	}
+}
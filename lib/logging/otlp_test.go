@@ -0,0 +1,261 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	"google.golang.org/grpc"
+)
+
+type recordExporter struct {
+	mu      sync.Mutex
+	records []sdklog.Record
+}
+
+var (
+	_ sdklog.Exporter = (*recordExporter)(nil)
+)
+
+func (e *recordExporter) Export(_ context.Context, records []sdklog.Record) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, r := range records {
+		e.records = append(e.records, r.Clone())
+	}
+	return nil
+}
+
+func (e *recordExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+func (e *recordExporter) ForceFlush(context.Context) error {
+	return nil
+}
+
+func (e *recordExporter) Records() []sdklog.Record {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return slices.Clone(e.records)
+}
+
+func recordAttributes(r sdklog.Record) map[string]otellog.Value {
+	results := map[string]otellog.Value{}
+	r.WalkAttributes(func(kv otellog.KeyValue) bool {
+		results[kv.Key] = kv.Value
+		return true
+	})
+	return results
+}
+
+func TestOTLPHandler(t *testing.T) {
+	exporter := &recordExporter{}
+	h, err := NewOTLPHandler(context.Background(),
+		WithOTLPExporter(exporter),
+		WithOTLPLevel(slog.LevelInfo),
+		WithOTLPResource("test-service", "1.0.0", "test"),
+	)
+	require.NoError(t, err)
+
+	log := slog.New(h).With(slog.String("service", "api")).WithGroup("db")
+	log.Debug("debug message")
+	log.WarnContext(newTestSpanContext(t, true), "warn message", slog.String("table", "users"), slog.Int("rows", 3))
+	require.NoError(t, h.Close())
+
+	// レベル未満のレコードは送信しない
+	records := exporter.Records()
+	require.Len(t, records, 1)
+	r := records[0]
+	require.Equal(t, "warn message", r.Body().AsString())
+	require.Equal(t, otellog.SeverityWarn, r.Severity())
+	require.Equal(t, "WARN", r.SeverityText())
+
+	// コンテキストのスパンと関連付ける
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", r.TraceID().String())
+	require.Equal(t, "00f067aa0ba902b7", r.SpanID().String())
+
+	// グループはマップに変換する
+	attrs := recordAttributes(r)
+	require.Equal(t, "api", attrs["service"].AsString())
+	require.Equal(t, otellog.MapValue(
+		otellog.String("table", "users"),
+		otellog.Int64("rows", 3),
+	), attrs["db"])
+
+	// traceパッケージと同じリソース属性を設定する
+	res := r.Resource()
+	serviceName, _ := res.Set().Value("service.name")
+	require.Equal(t, "test-service", serviceName.AsString())
+	env, _ := res.Set().Value(attribute.Key("env"))
+	require.Equal(t, "test", env.AsString())
+}
+
+func TestOTLPHandlerEmptyGroup(t *testing.T) {
+	exporter := &recordExporter{}
+	h, err := NewOTLPHandler(context.Background(), WithOTLPExporter(exporter))
+	require.NoError(t, err)
+
+	// 属性のないグループは出力しない
+	slog.New(h).With(slog.String("service", "api")).WithGroup("db").WithGroup("query").Info("no attrs", slog.Group("empty"))
+	require.NoError(t, h.Close())
+
+	records := exporter.Records()
+	require.Len(t, records, 1)
+	attrs := recordAttributes(records[0])
+	require.Len(t, attrs, 1)
+	require.Equal(t, "api", attrs["service"].AsString())
+}
+
+func TestOTLPSeverity(t *testing.T) {
+	tests := []struct {
+		level slog.Level
+		want  otellog.Severity
+	}{
+		{level: slog.LevelDebug, want: otellog.SeverityDebug},
+		{level: slog.LevelInfo, want: otellog.SeverityInfo},
+		{level: slog.LevelInfo + 2, want: otellog.SeverityInfo3},
+		{level: slog.LevelWarn, want: otellog.SeverityWarn},
+		{level: slog.LevelError, want: otellog.SeverityError},
+		{level: slog.Level(-100), want: otellog.SeverityTrace1},
+		{level: slog.Level(100), want: otellog.SeverityFatal4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			require.Equal(t, tt.want, otlpSeverity(tt.level))
+		})
+	}
+}
+
+func TestOTLPKeyValues(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	errTest := errors.New("test error")
+	kvs := otlpKeyValues([]slog.Attr{
+		slog.Bool("ok", true),
+		slog.Uint64("size", 10),
+		slog.Float64("ratio", 0.5),
+		slog.Duration("elapsed", time.Second),
+		slog.Time("at", now),
+		slog.Any("err", errTest),
+		slog.Any("raw", []byte("abc")),
+		slog.Group("", slog.String("inline", "v")),
+		{},
+		// 属性のないグループは出力しない
+		slog.Group("empty"),
+		slog.Group("nested", slog.Group("empty"), slog.Attr{}),
+		slog.Group("req", slog.String("method", "GET"), slog.Group("empty")),
+	})
+	require.Equal(t, []otellog.KeyValue{
+		otellog.Bool("ok", true),
+		otellog.Int64("size", 10),
+		otellog.Float64("ratio", 0.5),
+		otellog.Int64("elapsed", int64(time.Second)),
+		otellog.String("at", "2024-01-02T03:04:05Z"),
+		otellog.String("err", errTest.Error()),
+		otellog.Bytes("raw", []byte("abc")),
+		otellog.String("inline", "v"),
+		otellog.Map("req", otellog.String("method", "GET")),
+	}, kvs)
+}
+
+type logsCollector struct {
+	collogspb.UnimplementedLogsServiceServer
+
+	mu       sync.Mutex
+	requests []*collogspb.ExportLogsServiceRequest
+}
+
+func (c *logsCollector) Export(_ context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, req)
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+func (c *logsCollector) Requests() []*collogspb.ExportLogsServiceRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.requests)
+}
+
+func startLogsCollector(t *testing.T) (*logsCollector, string) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	collector := &logsCollector{}
+	srv := grpc.NewServer()
+	collogspb.RegisterLogsServiceServer(srv, collector)
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	t.Cleanup(srv.Stop)
+	return collector, lis.Addr().String()
+}
+
+func TestOTLPHandlerCollector(t *testing.T) {
+	collector, addr := startLogsCollector(t)
+
+	h, err := NewOTLPHandler(context.Background(),
+		WithOTLPEndpoint(addr),
+		WithOTLPInsecure(),
+		WithOTLPResource("collector-service", "", ""),
+	)
+	require.NoError(t, err)
+	slog.New(h).Info("to collector", slog.String("key", "value"))
+
+	// Closeでバッファに残っているログを送信する
+	require.NoError(t, h.Close())
+
+	requests := collector.Requests()
+	require.Len(t, requests, 1)
+	resourceLogs := requests[0].GetResourceLogs()
+	require.Len(t, resourceLogs, 1)
+
+	var serviceName string
+	for _, kv := range resourceLogs[0].GetResource().GetAttributes() {
+		if kv.GetKey() == "service.name" {
+			serviceName = kv.GetValue().GetStringValue()
+		}
+	}
+	require.Equal(t, "collector-service", serviceName)
+
+	scopeLogs := resourceLogs[0].GetScopeLogs()
+	require.Len(t, scopeLogs, 1)
+	require.Equal(t, otlpScopeName, scopeLogs[0].GetScope().GetName())
+	logRecords := scopeLogs[0].GetLogRecords()
+	require.Len(t, logRecords, 1)
+	require.Equal(t, "to collector", logRecords[0].GetBody().GetStringValue())
+	require.Equal(t, "INFO", logRecords[0].GetSeverityText())
+	require.Equal(t, "key", logRecords[0].GetAttributes()[0].GetKey())
+}
+
+func TestNewOTLP(t *testing.T) {
+	collector, addr := startLogsCollector(t)
+
+	cfg := Config{
+		Level:    NewLevel(slog.LevelInfo),
+		Handlers: []LoggingHandle{OTLPHandler},
+		Service:  "config-service",
+		OTLP:     &OTLPConfig{Endpoint: addr, Insecure: true},
+	}
+	h, err := New(cfg)
+	require.NoError(t, err)
+	slog.New(h).Info("from config")
+	require.NoError(t, h.Close())
+
+	requests := collector.Requests()
+	require.Len(t, requests, 1)
+	logRecords := requests[0].GetResourceLogs()[0].GetScopeLogs()[0].GetLogRecords()
+	require.Len(t, logRecords, 1)
+	require.Equal(t, "from config", logRecords[0].GetBody().GetStringValue())
+}
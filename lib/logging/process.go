@@ -25,6 +25,7 @@ func (h *processHandler) Handle(ctx context.Context, r slog.Record) error {
 	if ppid != 0 {
 		attrs = append(attrs, slog.Int("ppid", ppid))
 	}
+	r = r.Clone()
 	r.AddAttrs(attrs...)
 	return h.Handler.Handle(ctx, r)
 }
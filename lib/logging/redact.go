@@ -0,0 +1,392 @@
+package logging
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// MaskStyle はマスクの方法
+type MaskStyle int
+
+const (
+	// MaskFull は値全体を固定の文字列に置き換える
+	MaskFull MaskStyle = iota
+	// MaskPartial は末尾4文字を残して置き換える
+	MaskPartial
+	// MaskHash は値のハッシュに置き換える。値は分からないが同じ値かどうかは比較できる
+	MaskHash
+)
+
+const (
+	redactMask       = "********"
+	redactTagKey     = "log"
+	redactTagValue   = "redact"
+	partialKeepChars = 4
+
+	// redactMaxDepth はグループ、構造体、スライス、マップを辿る深さの上限。循環する値も止める
+	redactMaxDepth = 16
+	// redactDepthExceeded は上限より深い値の代わりに出力する
+	redactDepthExceeded = "[depth exceeded]"
+)
+
+var (
+	CardNumberPattern = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+
+	DefaultRedactRules = []RedactRule{
+		{
+			Keys:  []string{"password", "passwd", "secret", "token", "authorization", "cookie", "api_key", "apikey"},
+			Style: MaskFull,
+		},
+		{
+			Values: []*regexp.Regexp{CardNumberPattern},
+			Style:  MaskPartial,
+		},
+	}
+)
+
+// RedactRule はマスクする属性の定義
+// Keysは属性のキーに大文字小文字を区別せず部分一致した場合に値全体をマスクする
+// Valuesは文字列の値の中で一致した部分をマスクする
+type RedactRule struct {
+	Keys   []string
+	Values []*regexp.Regexp
+	Style  MaskStyle
+}
+
+func (r RedactRule) matchKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, k := range r.Keys {
+		if strings.Contains(key, strings.ToLower(k)) {
+			return true
+		}
+	}
+	return false
+}
+
+func mask(value string, style MaskStyle) string {
+	switch style {
+	case MaskPartial:
+		runes := []rune(value)
+		if len(runes) <= partialKeepChars*2 {
+			return redactMask
+		}
+		return strings.Repeat("*", len(runes)-partialKeepChars) + string(runes[len(runes)-partialKeepChars:])
+	case MaskHash:
+		sum := sha256.Sum256([]byte(value))
+		return "sha256:" + hex.EncodeToString(sum[:8])
+	default:
+		return redactMask
+	}
+}
+
+type redactor struct {
+	rules []RedactRule
+	// 構造体の型毎にマスクするフィールドを持つかどうか
+	types sync.Map
+}
+
+func (r *redactor) matchKey(key string) (MaskStyle, bool) {
+	for _, rule := range r.rules {
+		if rule.matchKey(key) {
+			return rule.Style, true
+		}
+	}
+	return MaskFull, false
+}
+
+func (r *redactor) attr(a slog.Attr, depth int) slog.Attr {
+	if style, ok := r.matchKey(a.Key); ok {
+		return slog.String(a.Key, mask(a.Value.Resolve().String(), style))
+	}
+	return slog.Attr{Key: a.Key, Value: r.value(a.Value, depth)}
+}
+
+func (r *redactor) attrs(attrs []slog.Attr, depth int) []slog.Attr {
+	results := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		results[i] = r.attr(a, depth)
+	}
+	return results
+}
+
+func (r *redactor) value(v slog.Value, depth int) slog.Value {
+	v = v.Resolve()
+	switch v.Kind() {
+	case slog.KindGroup:
+		if depth >= redactMaxDepth {
+			return slog.StringValue(redactDepthExceeded)
+		}
+		return slog.GroupValue(r.attrs(v.Group(), depth+1)...)
+	case slog.KindString:
+		return slog.StringValue(r.maskValues(v.String()))
+	case slog.KindAny:
+		rv := indirect(reflect.ValueOf(v.Any()))
+		if !rv.IsValid() || keepFormat(rv) || !r.needsRedact(rv.Type()) {
+			return v
+		}
+		if depth >= redactMaxDepth {
+			return slog.StringValue(redactDepthExceeded)
+		}
+		switch rv.Kind() {
+		case reflect.Struct:
+			return r.structValue(rv, depth)
+		case reflect.Map:
+			return r.mapValue(rv, depth)
+		case reflect.Slice, reflect.Array:
+			return slog.AnyValue(r.plain(rv, depth))
+		}
+	}
+	return v
+}
+
+// maskValues は文字列の中でルールに一致した部分をマスクする
+func (r *redactor) maskValues(s string) string {
+	for _, rule := range r.rules {
+		for _, re := range rule.Values {
+			s = re.ReplaceAllStringFunc(s, func(m string) string {
+				return mask(m, rule.Style)
+			})
+		}
+	}
+	return s
+}
+
+// indirect はポインターとインターフェースを辿った値を返す
+func indirect(rv reflect.Value) reflect.Value {
+	for (rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface) && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	return rv
+}
+
+var (
+	errorType         = reflect.TypeFor[error]()
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+)
+
+// keepFormat はエラーと独自のJSON形式を持つ値を変換せずにそのまま出力するかを返す
+func keepFormat(rv reflect.Value) bool {
+	if !rv.CanInterface() {
+		return false
+	}
+	t := rv.Type()
+	if t.Implements(errorType) || t.Implements(jsonMarshalerType) {
+		return true
+	}
+	return rv.CanAddr() && (reflect.PointerTo(t).Implements(errorType) || reflect.PointerTo(t).Implements(jsonMarshalerType))
+}
+
+// fieldName はjsonタグがあればその名前を返す
+func fieldName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() {
+		return "", false
+	}
+	if tag, ok := field.Tag.Lookup("json"); ok {
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			return "", false
+		}
+		if name != "" {
+			return name, true
+		}
+	}
+	return field.Name, true
+}
+
+// structValue はマスクするフィールドを持つ構造体をグループに変換する
+func (r *redactor) structValue(rv reflect.Value, depth int) slog.Value {
+	t := rv.Type()
+	attrs := make([]slog.Attr, 0, t.NumField())
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, ok := fieldName(field)
+		if !ok {
+			continue
+		}
+		fv := rv.Field(i)
+		if field.Tag.Get(redactTagKey) == redactTagValue {
+			attrs = append(attrs, slog.String(name, mask(fmt.Sprint(fv.Interface()), MaskFull)))
+			continue
+		}
+		attrs = append(attrs, r.attr(slog.Any(name, fv.Interface()), depth+1))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// mapValue はマップをキーの順に並べたグループに変換する
+func (r *redactor) mapValue(rv reflect.Value, depth int) slog.Value {
+	attrs := make([]slog.Attr, 0, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		attrs = append(attrs, r.attr(slog.Any(fmt.Sprint(iter.Key().Interface()), iter.Value().Interface()), depth+1))
+	}
+	slices.SortFunc(attrs, func(a, b slog.Attr) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return slog.GroupValue(attrs...)
+}
+
+// plain はスライスの要素をマスクした値に変換する
+// 配列の形のまま出力できるよう、構造体とマップはmap[string]any、スライスは[]anyにする
+func (r *redactor) plain(rv reflect.Value, depth int) any {
+	rv = indirect(rv)
+	if !rv.IsValid() {
+		return nil
+	}
+	if rv.Kind() == reflect.String {
+		return r.maskValues(rv.String())
+	}
+	if keepFormat(rv) || !r.needsRedact(rv.Type()) {
+		return rv.Interface()
+	}
+	if depth >= redactMaxDepth {
+		return redactDepthExceeded
+	}
+	switch rv.Kind() {
+	case reflect.Struct:
+		t := rv.Type()
+		m := make(map[string]any, t.NumField())
+		for i := range t.NumField() {
+			field := t.Field(i)
+			name, ok := fieldName(field)
+			if !ok {
+				continue
+			}
+			m[name] = r.plainEntry(name, rv.Field(i), field.Tag.Get(redactTagKey) == redactTagValue, depth)
+		}
+		return m
+	case reflect.Map:
+		m := make(map[string]any, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			name := fmt.Sprint(iter.Key().Interface())
+			m[name] = r.plainEntry(name, iter.Value(), false, depth)
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		s := make([]any, rv.Len())
+		for i := range rv.Len() {
+			s[i] = r.plain(rv.Index(i), depth+1)
+		}
+		return s
+	}
+	return rv.Interface()
+}
+
+// plainEntry は構造体のフィールドとマップの値をキーとタグに従ってマスクする
+func (r *redactor) plainEntry(name string, rv reflect.Value, tagged bool, depth int) any {
+	if tagged {
+		return mask(fmt.Sprint(rv.Interface()), MaskFull)
+	}
+	if style, ok := r.matchKey(name); ok {
+		return mask(fmt.Sprint(indirect(rv).Interface()), style)
+	}
+	return r.plain(rv, depth+1)
+}
+
+// needsRedact は値がredactタグを持つ構造体か、ルールに一致するキーを持ちうるかどうかを返す
+// 一致しない値はそのまま次のハンドラーに渡す
+func (r *redactor) needsRedact(t reflect.Type) bool {
+	if v, ok := r.types.Load(t); ok {
+		return v.(bool)
+	}
+	found := r.walkType(t, map[reflect.Type]bool{})
+	r.types.Store(t, found)
+	return found
+}
+
+func (r *redactor) walkType(t reflect.Type, visited map[reflect.Type]bool) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if visited[t] {
+		return false
+	}
+	visited[t] = true
+	switch t.Kind() {
+	case reflect.Interface:
+		// 実際の値は実行時に判定する
+		return true
+	case reflect.Slice, reflect.Array:
+		return r.walkType(t.Elem(), visited)
+	case reflect.Map:
+		// キーがルールに一致するかは実行時に判定する
+		return t.Key().Kind() == reflect.String || r.walkType(t.Elem(), visited)
+	case reflect.Struct:
+		for i := range t.NumField() {
+			field := t.Field(i)
+			name, ok := fieldName(field)
+			if !ok {
+				continue
+			}
+			if field.Tag.Get(redactTagKey) == redactTagValue || r.walkType(field.Type, visited) {
+				return true
+			}
+			if _, ok := r.matchKey(name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type redactHandler struct {
+	slog.Handler
+	redactor *redactor
+}
+
+var (
+	_ Handle = (*redactHandler)(nil)
+)
+
+// NewRedactHandler は機密情報をマスクしてから次のハンドラーに渡す
+// rulesを省略した場合はDefaultRedactRulesを使う
+func NewRedactHandler(handler slog.Handler, rules ...RedactRule) Handle {
+	if len(rules) == 0 {
+		rules = DefaultRedactRules
+	}
+	return &redactHandler{
+		Handler:  handler,
+		redactor: &redactor{rules: rules},
+	}
+}
+
+func (h *redactHandler) Handle(ctx context.Context, record slog.Record) error {
+	r := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(a slog.Attr) bool {
+		r.AddAttrs(h.redactor.attr(a, 0))
+		return true
+	})
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &redactHandler{
+		Handler:  h.Handler.WithAttrs(h.redactor.attrs(attrs, 0)),
+		redactor: h.redactor,
+	}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{
+		Handler:  h.Handler.WithGroup(name),
+		redactor: h.redactor,
+	}
+}
+
+func (h *redactHandler) Close() error {
+	if v, ok := h.Handler.(io.Closer); ok {
+		return v.Close()
+	}
+	return nil
+}
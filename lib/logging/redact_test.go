@@ -0,0 +1,189 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type redactUser struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	Email    string `json:"email" log:"redact"`
+	internal string
+}
+
+type redactRequest struct {
+	ID   int
+	User *redactUser `json:"user"`
+}
+
+func decodeJSONLine(t *testing.T, buf *bytes.Buffer) map[string]any {
+	t.Helper()
+	var m map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &m))
+	return m
+}
+
+func TestMask(t *testing.T) {
+	require.Equal(t, "********", mask("secret", MaskFull))
+	require.Equal(t, "************1111", mask("4111111111111111", MaskPartial))
+	require.Equal(t, "********", mask("short", MaskPartial))
+	require.Equal(t, mask("value", MaskHash), mask("value", MaskHash))
+	require.NotEqual(t, mask("value1", MaskHash), mask("value2", MaskHash))
+	require.Regexp(t, `^sha256:[0-9a-f]{16}$`, mask("value", MaskHash))
+}
+
+func TestRedactHandlerKeys(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(NewRedactHandler(NewJSONHandler(WithWriter(buf))))
+	log.Info("login",
+		slog.String("user", "alice"),
+		slog.String("Password", "p@ss"),
+		slog.String("Authorization", "Bearer abc"),
+		slog.Group("request", slog.String("access_token", "xyz")),
+	)
+
+	m := decodeJSONLine(t, buf)
+	require.Equal(t, "alice", m["user"])
+	require.Equal(t, "********", m["Password"])
+	require.Equal(t, "********", m["Authorization"])
+	require.Equal(t, map[string]any{"access_token": "********"}, m["request"])
+}
+
+func TestRedactHandlerValues(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(NewRedactHandler(NewJSONHandler(WithWriter(buf))))
+	log.Info("payment", slog.String("note", "card 4111 1111 1111 1111 used"))
+
+	m := decodeJSONLine(t, buf)
+	require.Equal(t, "card ***************1111 used", m["note"])
+}
+
+func TestRedactHandlerStructTag(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(NewRedactHandler(NewJSONHandler(WithWriter(buf))))
+	log.Info("request", slog.Any("req", redactRequest{
+		ID: 1,
+		User: &redactUser{
+			Name:     "alice",
+			Password: "p@ss",
+			Email:    "alice@example.com",
+			internal: "internal",
+		},
+	}))
+
+	m := decodeJSONLine(t, buf)
+	require.Equal(t, map[string]any{
+		"ID": float64(1),
+		"user": map[string]any{
+			"name":     "alice",
+			"password": "********",
+			"email":    "********",
+		},
+	}, m["req"])
+}
+
+type redactNode struct {
+	Name     string
+	Password string
+	Next     *redactNode
+}
+
+func TestRedactHandlerSliceAndMap(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(NewRedactHandler(NewJSONHandler(WithWriter(buf))))
+	log.Info("request",
+		slog.Any("users", []redactUser{{Name: "alice", Password: "p1"}, {Name: "bob", Password: "p2"}}),
+		slog.Any("ptrs", []*redactUser{{Name: "carol", Password: "p3"}, nil}),
+		slog.Any("params", map[string]any{
+			"password": "p4",
+			"user":     redactUser{Name: "dave", Password: "p5"},
+			"tags":     []any{"a", map[string]string{"token": "t1"}},
+		}),
+		slog.Any("ids", []int{1, 2}),
+	)
+
+	m := decodeJSONLine(t, buf)
+	// スライスは配列のまま要素をマスクする
+	require.Equal(t, []any{
+		map[string]any{"name": "alice", "password": "********", "email": "********"},
+		map[string]any{"name": "bob", "password": "********", "email": "********"},
+	}, m["users"])
+	require.Equal(t, []any{
+		map[string]any{"name": "carol", "password": "********", "email": "********"},
+		nil,
+	}, m["ptrs"])
+	// マップはキーでマスクし、値の構造体やスライスも辿る
+	require.Equal(t, map[string]any{
+		"password": "********",
+		"user":     map[string]any{"name": "dave", "password": "********", "email": "********"},
+		"tags":     []any{"a", map[string]any{"token": "********"}},
+	}, m["params"])
+	require.Equal(t, []any{float64(1), float64(2)}, m["ids"])
+	require.NotRegexp(t, `"p\d"`, buf.String())
+}
+
+func TestRedactHandlerDepth(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(NewRedactHandler(NewJSONHandler(WithWriter(buf))))
+
+	// 循環する値も深さの上限で止める
+	node := &redactNode{Name: "n1", Password: "p1"}
+	node.Next = node
+	cyclic := map[string]any{"password": "p2"}
+	cyclic["self"] = cyclic
+	list := []any{nil}
+	list[0] = list
+	log.Info("cycle", slog.Any("node", node), slog.Any("map", cyclic), slog.Any("list", list))
+
+	m := decodeJSONLine(t, buf)
+	depth := 0
+	for v := m["node"]; ; depth++ {
+		g, ok := v.(map[string]any)
+		if !ok {
+			require.Equal(t, redactDepthExceeded, v)
+			break
+		}
+		require.Equal(t, "********", g["Password"])
+		v = g["Next"]
+	}
+	require.Equal(t, redactMaxDepth, depth)
+	require.Contains(t, buf.String(), `"self":"`+redactDepthExceeded+`"`)
+	require.Contains(t, buf.String(), `["`+redactDepthExceeded+`"]`)
+	require.NotContains(t, buf.String(), "p1")
+	require.NotContains(t, buf.String(), "p2")
+}
+
+func TestRedactHandlerWithAttrsAndGroup(t *testing.T) {
+	buf := &bytes.Buffer{}
+	rule := RedactRule{
+		Keys:   []string{"session"},
+		Values: []*regexp.Regexp{regexp.MustCompile(`id-\d+`)},
+		Style:  MaskHash,
+	}
+	h := NewRedactHandler(NewJSONHandler(WithWriter(buf)), rule)
+	log := slog.New(h).With(slog.String("session", "abc")).WithGroup("group")
+	log.Info("message", slog.String("detail", "user id-123"), slog.String("password", "visible"))
+
+	m := decodeJSONLine(t, buf)
+	require.Equal(t, mask("abc", MaskHash), m["session"])
+	require.Equal(t, map[string]any{
+		"detail":   "user " + mask("id-123", MaskHash),
+		"password": "visible",
+	}, m["group"])
+}
+
+func TestRedactHandlerClose(t *testing.T) {
+	closed := false
+	h := NewRedactHandler(&mockCloseHandler{closeFn: func() error {
+		closed = true
+		return nil
+	}})
+	require.NoError(t, h.Close())
+	require.True(t, closed)
+}
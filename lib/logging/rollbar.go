@@ -1,9 +1,9 @@
 package logging
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
-	"strings"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/rollbar/rollbar-go"
@@ -11,9 +11,14 @@ import (
 )
 
 type RollbarConfig struct {
-	Level string `yaml:"level" default:"warn"`
-	Token string `yaml:"token"`
-	Env   string `yaml:"env"`
+	// Level は送信するレベル。nilのときはWARN
+	Level      *Level `yaml:"level" default:"warn"`
+	Token      string `yaml:"token"`
+	Env        string `yaml:"env"`
+	ServerRoot string `yaml:"serverRoot"`
+	// NormalizeMessage を有効にするとFingerprintがないアイテムを正規化したタイトルでまとめる
+	NormalizeMessage  bool              `yaml:"normalizeMessage"`
+	MessageNormalizer MessageNormalizer `yaml:"-"`
 
 	client *rollbar.Client
 	Client *http.Client
@@ -33,35 +38,74 @@ func (c *RollbarConfig) Init(env, version, serverRoot string) {
 	if c.Client != nil {
 		client.SetHTTPClient(c.Client)
 	}
+	client.SetTransform(rollbarFingerprint(c.normalizer()))
 	c.client = client
 }
 
+func (c *RollbarConfig) normalizer() MessageNormalizer {
+	if c.MessageNormalizer != nil {
+		return c.MessageNormalizer
+	}
+	if c.NormalizeMessage {
+		return DefaultMessageNormalizer
+	}
+	return nil
+}
+
+// rollbarFingerprint はFingerprintの属性をRollbarのfingerprintに変換する
+// slog-rollbarは属性をcustomに出力するため、customから取り出す
+func rollbarFingerprint(normalize MessageNormalizer) func(data map[string]any) {
+	return func(data map[string]any) {
+		if custom, ok := data["custom"].(map[string]any); ok {
+			if keys, ok := custom[FingerprintKey].([]string); ok && len(keys) > 0 {
+				delete(custom, FingerprintKey)
+				data["fingerprint"] = fingerprintHash(keys)
+				return
+			}
+		}
+		if normalize != nil {
+			if title, ok := data["title"].(string); ok {
+				data["fingerprint"] = fingerprintHash([]string{normalize(title)})
+			}
+		}
+	}
+}
+
 func (c *RollbarConfig) Close() {
 	if c.client != nil {
 		_ = c.client.Close()
 	}
 }
 
+// getLevel は未指定のときにタグと同じWARNを返す
 func (c *RollbarConfig) getLevel() slog.Level {
-	switch strings.ToLower(c.Level) {
-	case "debug":
-		return slog.LevelDebug
-	case "info":
-		return slog.LevelInfo
-	case "warn", "warning":
-		return slog.LevelWarn
-	case "err", "error":
-		return slog.LevelError
-	default:
-		return slog.LevelInfo
-	}
+	return levelOr(c.Level, slog.LevelWarn)
 }
 
-func NewRollbarHandler(conf *RollbarConfig) Handle {
+// NewRollbarHandler はoptsで送信しないエラーの条件を指定できる
+func NewRollbarHandler(conf *RollbarConfig, opts ...ErrorTrackingOption) Handle {
 	option := slogrollbar.Option{
 		Level:     conf.getLevel(),
 		Client:    conf.client,
 		AddSource: true,
 	}
-	return NewErrorTracking(NewAsyncHandler(option.NewRollbarHandler()))
+	return NewErrorTracking(NewAsyncHandler(rollbarLevelHandler{option.NewRollbarHandler()}), opts...)
+}
+
+// rollbarLevelHandler はslog-rollbarが変換できないTRACEやFATALなどのレベルを標準レベルにする
+type rollbarLevelHandler struct {
+	slog.Handler
+}
+
+func (h rollbarLevelHandler) Handle(ctx context.Context, record slog.Record) error {
+	record.Level = standardLevel(record.Level)
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h rollbarLevelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return rollbarLevelHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h rollbarLevelHandler) WithGroup(name string) slog.Handler {
+	return rollbarLevelHandler{h.Handler.WithGroup(name)}
 }
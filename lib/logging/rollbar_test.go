@@ -1,13 +1,16 @@
 package logging
 
 import (
+	"encoding/json"
 	"io"
 	"log/slog"
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type mockTransport struct {
@@ -40,7 +43,7 @@ func TestRollbar(t *testing.T) {
 	client := *http.DefaultClient
 	client.Transport = newMockTransport(transport)
 	conf := RollbarConfig{
-		Level:  "error",
+		Level:  NewLevel(slog.LevelError),
 		Token:  "DUMMY",
 		Client: &client,
 	}
@@ -51,3 +54,94 @@ func TestRollbar(t *testing.T) {
 	slog.SetDefault(log)
 	slog.Error("This is test")
 }
+
+func TestRollbarFingerprint(t *testing.T) {
+	bodies := make(chan map[string]any, 2)
+	transport := func(req *http.Request) (*http.Response, error) {
+		var body map[string]any
+		_ = json.NewDecoder(req.Body).Decode(&body)
+		bodies <- body
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("")),
+		}, nil
+	}
+	client := *http.DefaultClient
+	client.Transport = newMockTransport(transport)
+	conf := RollbarConfig{
+		Level:            NewLevel(slog.LevelError),
+		Token:            "DUMMY",
+		NormalizeMessage: true,
+		Client:           &client,
+	}
+	conf.Init("local", "v1", "test")
+	h := NewRollbarHandler(&conf)
+	log := slog.New(h)
+	log.Error("user 42 not found", Fingerprint("user-not-found"))
+	log.Error("order 12345 failed")
+	require.NoError(t, h.Close())
+	conf.Close()
+
+	data := func() map[string]any {
+		select {
+		case body := <-bodies:
+			return body["data"].(map[string]any)
+		case <-time.After(5 * time.Second):
+			t.Fatal("rollbar item was not sent")
+			return nil
+		}
+	}
+	// Fingerprintの属性はcustomから取り除いてfingerprintにする
+	first := data()
+	assert.Equal(t, fingerprintHash([]string{"user-not-found"}), first["fingerprint"])
+	assert.NotContains(t, first["custom"], FingerprintKey)
+
+	// 指定がなければ正規化したタイトルでまとめる
+	second := data()
+	assert.Equal(t, fingerprintHash([]string{"order <num> failed"}), second["fingerprint"])
+}
+
+func TestRollbarCustomLevels(t *testing.T) {
+	bodies := make(chan map[string]any, 3)
+	transport := func(req *http.Request) (*http.Response, error) {
+		var body map[string]any
+		_ = json.NewDecoder(req.Body).Decode(&body)
+		bodies <- body
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("")),
+		}, nil
+	}
+	client := *http.DefaultClient
+	client.Transport = newMockTransport(transport)
+	conf := RollbarConfig{
+		Level:  NewLevel(LevelTrace),
+		Token:  "DUMMY",
+		Client: &client,
+	}
+	conf.Init("local", "v1", "test")
+	h := NewRollbarHandler(&conf)
+	log := slog.New(h)
+	log.Log(t.Context(), LevelTrace, "trace")
+	log.Log(t.Context(), LevelNotice, "notice")
+	log.Log(t.Context(), LevelFatal, "fatal")
+	require.NoError(t, h.Close())
+	conf.Close()
+
+	// slog-rollbarの変換表にないレベルは直近の下位の標準レベルで送信する
+	levels := map[string]string{}
+	for range 3 {
+		select {
+		case body := <-bodies:
+			data := body["data"].(map[string]any)
+			levels[data["title"].(string)] = data["level"].(string)
+		case <-time.After(5 * time.Second):
+			t.Fatal("rollbar item was not sent")
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"trace":  "debug",
+		"notice": "info",
+		"fatal":  "error",
+	}, levels)
+}
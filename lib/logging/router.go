@@ -0,0 +1,421 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// RouteMode はレコードを振り分けるルートの選び方
+type RouteMode int
+
+const (
+	// RouteFirstMatch は最初に条件に一致したルートだけに出力する
+	RouteFirstMatch RouteMode = iota
+	// RouteAllMatch は条件に一致した全てのルートに出力する
+	RouteAllMatch
+)
+
+// routeRecord は条件の判定に使うレコードとWithGroup/WithAttrsの状態
+type routeRecord struct {
+	ctx    context.Context
+	record slog.Record
+	groups []string
+	// attrs はWithAttrsの属性。キーはグループを "." で連結したもの
+	attrs []slog.Attr
+}
+
+// value は "group.key" 形式のキーで属性の値を返す
+// レコード、WithAttrs、AppendCtxでコンテキストに追加された属性の順に探す
+func (r routeRecord) value(key string) (slog.Value, bool) {
+	var (
+		value slog.Value
+		found bool
+	)
+	prefix := groupPrefix(r.groups)
+	r.record.Attrs(func(a slog.Attr) bool {
+		value, found = findAttr(a, prefix, key)
+		return !found
+	})
+	if found {
+		return value, true
+	}
+	// 後から追加された属性を優先する
+	for _, a := range slices.Backward(r.attrs) {
+		if value, ok := findAttr(a, "", key); ok {
+			return value, true
+		}
+	}
+	for _, a := range slices.Backward(AttrsFromContext(r.ctx)) {
+		if value, ok := findAttr(a, "", key); ok {
+			return value, true
+		}
+	}
+	return slog.Value{}, false
+}
+
+func findAttr(a slog.Attr, prefix, key string) (slog.Value, bool) {
+	v := a.Value.Resolve()
+	name := prefix + a.Key
+	if v.Kind() != slog.KindGroup {
+		return v, a.Key != "" && name == key
+	}
+	if a.Key != "" {
+		if name == key {
+			return v, true
+		}
+		name += "."
+	}
+	if !strings.HasPrefix(key, name) {
+		return slog.Value{}, false
+	}
+	for _, ga := range v.Group() {
+		if value, ok := findAttr(ga, name, key); ok {
+			return value, true
+		}
+	}
+	return slog.Value{}, false
+}
+
+func groupPrefix(groups []string) string {
+	if len(groups) == 0 {
+		return ""
+	}
+	return strings.Join(groups, ".") + "."
+}
+
+// RouteCondition はレコードをルートに振り分ける条件
+type RouteCondition interface {
+	// enabled はレベルだけで条件に一致する可能性があるかを返す
+	enabled(level slog.Level) bool
+	match(r routeRecord) bool
+}
+
+type routeCondition struct {
+	enabledFn func(level slog.Level) bool
+	matchFn   func(r routeRecord) bool
+}
+
+func (c routeCondition) enabled(level slog.Level) bool {
+	if c.enabledFn == nil {
+		return true
+	}
+	return c.enabledFn(level)
+}
+
+func (c routeCondition) match(r routeRecord) bool {
+	return c.matchFn(r)
+}
+
+// RouteLevel はレベル以上のレコードに一致する
+func RouteLevel(level slog.Leveler) RouteCondition {
+	enabled := func(l slog.Level) bool {
+		return l >= level.Level()
+	}
+	return routeCondition{
+		enabledFn: enabled,
+		matchFn: func(r routeRecord) bool {
+			return enabled(r.record.Level)
+		},
+	}
+}
+
+// RouteAttr は "group.key" 形式のキーの属性の値が一致するレコードに一致する
+// レコードとWithAttrsの属性に加えて、AppendCtxでコンテキストに追加された属性も判定に使う
+func RouteAttr(key string, value any) RouteCondition {
+	want := slog.AnyValue(value).Resolve()
+	return routeCondition{
+		matchFn: func(r routeRecord) bool {
+			got, ok := r.value(key)
+			return ok && got.Equal(want)
+		},
+	}
+}
+
+// RouteHasKey は "group.key" 形式のキーの属性を持つレコードに一致する
+func RouteHasKey(key string) RouteCondition {
+	return routeCondition{
+		matchFn: func(r routeRecord) bool {
+			_, ok := r.value(key)
+			return ok
+		},
+	}
+}
+
+// RouteGroup はWithGroupでグループを指定したロガー、またはグループの属性を持つレコードに一致する
+func RouteGroup(name string) RouteCondition {
+	return routeCondition{
+		matchFn: func(r routeRecord) bool {
+			if slices.Contains(r.groups, name) {
+				return true
+			}
+			found := false
+			r.record.Attrs(func(a slog.Attr) bool {
+				found = a.Key == name && a.Value.Resolve().Kind() == slog.KindGroup
+				return !found
+			})
+			return found
+		},
+	}
+}
+
+// RouteFunc は任意の条件で一致する
+func RouteFunc(fn func(ctx context.Context, record slog.Record) bool) RouteCondition {
+	return routeCondition{
+		matchFn: func(r routeRecord) bool {
+			return fn(r.ctx, r.record)
+		},
+	}
+}
+
+// RouteAll は全ての条件に一致するレコードに一致する
+func RouteAll(conditions ...RouteCondition) RouteCondition {
+	return routeCondition{
+		enabledFn: func(level slog.Level) bool {
+			for _, c := range conditions {
+				if !c.enabled(level) {
+					return false
+				}
+			}
+			return true
+		},
+		matchFn: func(r routeRecord) bool {
+			for _, c := range conditions {
+				if !c.match(r) {
+					return false
+				}
+			}
+			return true
+		},
+	}
+}
+
+// RouteAny はいずれかの条件に一致するレコードに一致する
+func RouteAny(conditions ...RouteCondition) RouteCondition {
+	return routeCondition{
+		enabledFn: func(level slog.Level) bool {
+			for _, c := range conditions {
+				if c.enabled(level) {
+					return true
+				}
+			}
+			return false
+		},
+		matchFn: func(r routeRecord) bool {
+			for _, c := range conditions {
+				if c.match(r) {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+// RouteNot は条件に一致しないレコードに一致する
+func RouteNot(condition RouteCondition) RouteCondition {
+	return routeCondition{
+		matchFn: func(r routeRecord) bool {
+			return !condition.match(r)
+		},
+	}
+}
+
+type RouterOption interface {
+	apply(opt *routerOption)
+}
+
+type routerOptionFn func(opt *routerOption)
+
+func (fn routerOptionFn) apply(opt *routerOption) {
+	fn(opt)
+}
+
+type route struct {
+	condition RouteCondition
+	handlers  []slog.Handler
+}
+
+type routerOption struct {
+	mode     RouteMode
+	routes   []route
+	fallback []slog.Handler
+}
+
+// WithRoute は条件に一致したレコードを出力するハンドラーを追加する
+// ルートは追加した順に判定する
+func WithRoute(condition RouteCondition, handlers ...slog.Handler) RouterOption {
+	return routerOptionFn(func(opt *routerOption) {
+		opt.routes = append(opt.routes, route{condition: condition, handlers: handlers})
+	})
+}
+
+// WithDefaultRoute はどのルートにも一致しなかったレコードを出力するハンドラーを指定する
+// 指定しなければ一致しなかったレコードは出力しない
+func WithDefaultRoute(handlers ...slog.Handler) RouterOption {
+	return routerOptionFn(func(opt *routerOption) {
+		opt.fallback = handlers
+	})
+}
+
+// WithRouteMode はルートの選び方を指定する。デフォルトはRouteFirstMatch
+func WithRouteMode(mode RouteMode) RouterOption {
+	return routerOptionFn(func(opt *routerOption) {
+		opt.mode = mode
+	})
+}
+
+type router struct {
+	option routerOption
+	groups []string
+	attrs  []slog.Attr
+}
+
+var (
+	_ Handle = (*router)(nil)
+)
+
+// NewRouter は条件に一致したルートのハンドラーにレコードを出力する
+// 各ハンドラーのEnabledも満たす場合だけ出力する
+//
+//	h := logging.NewRouter(
+//		logging.WithRoute(logging.RouteLevel(slog.LevelError), sentry),
+//		logging.WithRoute(logging.RouteAttr("component", "audit"), audit),
+//		logging.WithRoute(logging.RouteGroup("db"), db),
+//		logging.WithDefaultRoute(stdout),
+//		logging.WithRouteMode(logging.RouteAllMatch),
+//	)
+func NewRouter(opts ...RouterOption) Handle {
+	o := routerOption{}
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+	return &router{option: o}
+}
+
+func (h *router) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, r := range h.option.routes {
+		if r.condition.enabled(level) && anyEnabled(ctx, r.handlers, level) {
+			return true
+		}
+	}
+	return anyEnabled(ctx, h.option.fallback, level)
+}
+
+func (h *router) acceptReplay() {}
+
+func anyEnabled(ctx context.Context, handlers []slog.Handler, level slog.Level) bool {
+	return slices.ContainsFunc(handlers, func(h slog.Handler) bool {
+		return h != nil && h.Enabled(ctx, level)
+	})
+}
+
+// Handle は一致したルートのハンドラー毎にレコードを複製して渡す
+func (h *router) Handle(ctx context.Context, record slog.Record) error {
+	r := routeRecord{ctx: ctx, record: record, groups: h.groups, attrs: h.attrs}
+	var (
+		errs    []error
+		matched bool
+	)
+	for _, rt := range h.option.routes {
+		if !rt.condition.enabled(record.Level) || !rt.condition.match(r) {
+			continue
+		}
+		matched = true
+		errs = append(errs, handleAll(ctx, rt.handlers, record))
+		if h.option.mode == RouteFirstMatch {
+			break
+		}
+	}
+	if !matched {
+		errs = append(errs, handleAll(ctx, h.option.fallback, record))
+	}
+	return errors.Join(errs...)
+}
+
+func handleAll(ctx context.Context, handlers []slog.Handler, record slog.Record) error {
+	var errs []error
+	for _, h := range handlers {
+		if h != nil && replayEnabled(ctx, h, record.Level) {
+			errs = append(errs, h.Handle(ctx, record.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h *router) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	prefix := groupPrefix(h.groups)
+	h2 := &router{
+		option: h.option.with(func(h slog.Handler) slog.Handler { return h.WithAttrs(attrs) }),
+		groups: h.groups,
+		attrs:  slices.Clip(h.attrs),
+	}
+	for _, a := range attrs {
+		a.Key = prefix + a.Key
+		h2.attrs = append(h2.attrs, a)
+	}
+	return h2
+}
+
+func (h *router) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &router{
+		option: h.option.with(func(h slog.Handler) slog.Handler { return h.WithGroup(name) }),
+		groups: append(slices.Clip(h.groups), name),
+		attrs:  h.attrs,
+	}
+}
+
+// with は全てのルートのハンドラーにfnを適用したものを返す
+func (o routerOption) with(fn func(h slog.Handler) slog.Handler) routerOption {
+	apply := func(handlers []slog.Handler) []slog.Handler {
+		results := make([]slog.Handler, len(handlers))
+		for i, h := range handlers {
+			if h != nil {
+				results[i] = fn(h)
+			}
+		}
+		return results
+	}
+	routes := make([]route, len(o.routes))
+	for i, r := range o.routes {
+		routes[i] = route{condition: r.condition, handlers: apply(r.handlers)}
+	}
+	return routerOption{mode: o.mode, routes: routes, fallback: apply(o.fallback)}
+}
+
+// Close は全てのルートのハンドラーを閉じる。同じハンドラーは1度だけ閉じる
+func (h *router) Close() error {
+	var errs []error
+	closed := map[io.Closer]struct{}{}
+	closeAll := func(handlers []slog.Handler) {
+		for _, handler := range handlers {
+			v, ok := handler.(io.Closer)
+			if !ok {
+				continue
+			}
+			// 比較できない型はマップのキーにできないため毎回閉じる
+			if reflect.TypeOf(v).Comparable() {
+				if _, ok := closed[v]; ok {
+					continue
+				}
+				closed[v] = struct{}{}
+			}
+			errs = append(errs, v.Close())
+		}
+	}
+	for _, r := range h.option.routes {
+		closeAll(r.handlers)
+	}
+	closeAll(h.option.fallback)
+	return errors.Join(errs...)
+}
@@ -0,0 +1,196 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter(t *testing.T) {
+	errBuf, auditBuf, dbBuf, defaultBuf := &bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{}
+	h := NewRouter(
+		WithRoute(RouteLevel(slog.LevelError), NewTextHandler(WithWriter(errBuf))),
+		WithRoute(RouteAttr("component", "audit"), NewTextHandler(WithWriter(auditBuf))),
+		WithRoute(RouteGroup("db"), NewTextHandler(WithWriter(dbBuf))),
+		WithDefaultRoute(NewTextHandler(WithWriter(defaultBuf))),
+	)
+	log := slog.New(h)
+
+	log.Info("hello")
+	log.Error("failed")
+	log.With(slog.String("component", "audit")).Info("login")
+	log.Info("logout", slog.String("component", "audit"))
+	log.WithGroup("db").Info("query", slog.String("table", "users"))
+	log.Info("connected", slog.Group("db", slog.String("host", "localhost")))
+	// 最初に一致したルートだけに出力する
+	log.With(slog.String("component", "audit")).Error("denied")
+
+	require.Equal(t, "failed,denied", onlyMessages(errBuf.String()))
+	require.Equal(t, "login,logout", onlyMessages(auditBuf.String()))
+	require.Equal(t, "query,connected", onlyMessages(dbBuf.String()))
+	require.Contains(t, dbBuf.String(), "db.table=users")
+	require.Equal(t, "hello", onlyMessages(defaultBuf.String()))
+}
+
+func TestRouterAllMatch(t *testing.T) {
+	errBuf, auditBuf, defaultBuf := &bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{}
+	h := NewRouter(
+		WithRouteMode(RouteAllMatch),
+		WithRoute(RouteLevel(slog.LevelError), NewTextHandler(WithWriter(errBuf))),
+		WithRoute(RouteAttr("component", "audit"), NewTextHandler(WithWriter(auditBuf))),
+		WithDefaultRoute(NewTextHandler(WithWriter(defaultBuf))),
+	)
+	log := slog.New(h).With(slog.String("component", "audit"))
+
+	log.Error("denied")
+	log.Info("login")
+	slog.New(h).Info("hello")
+	// 一致した全てのルートに出力し、一致しなければデフォルトに出力する
+	require.Equal(t, "denied", onlyMessages(errBuf.String()))
+	require.Equal(t, "denied,login", onlyMessages(auditBuf.String()))
+	require.Equal(t, "hello", onlyMessages(defaultBuf.String()))
+}
+
+func TestRouterConditions(t *testing.T) {
+	ctx := AppendCtx(context.Background(), slog.String("tenant", "t1"))
+	tests := []struct {
+		name      string
+		condition RouteCondition
+		log       func(log *slog.Logger)
+		want      bool
+	}{
+		{
+			name:      "グループの中の属性",
+			condition: RouteAttr("http.status", 500),
+			log: func(log *slog.Logger) {
+				log.WithGroup("http").Info("msg", slog.Int("status", 500))
+			},
+			want: true,
+		},
+		{
+			name:      "WithGroupの後のWithAttrsの属性",
+			condition: RouteAttr("http.status", 500),
+			log: func(log *slog.Logger) {
+				log.WithGroup("http").With(slog.Int("status", 500)).Info("msg")
+			},
+			want: true,
+		},
+		{
+			name:      "グループの外の同じ名前の属性には一致しない",
+			condition: RouteAttr("status", 500),
+			log: func(log *slog.Logger) {
+				log.WithGroup("http").Info("msg", slog.Int("status", 500))
+			},
+			want: false,
+		},
+		{
+			name:      "コンテキストの属性",
+			condition: RouteAttr("tenant", "t1"),
+			log: func(log *slog.Logger) {
+				log.InfoContext(ctx, "msg")
+			},
+			want: true,
+		},
+		{
+			name:      "キーの有無",
+			condition: RouteHasKey("error"),
+			log: func(log *slog.Logger) {
+				log.Info("msg", Err(errors.New("boom")))
+			},
+			want: true,
+		},
+		{
+			name:      "全ての条件",
+			condition: RouteAll(RouteLevel(slog.LevelWarn), RouteHasKey("user")),
+			log: func(log *slog.Logger) {
+				log.Info("msg", slog.String("user", "u1"))
+			},
+			want: false,
+		},
+		{
+			name:      "いずれかの条件",
+			condition: RouteAny(RouteLevel(slog.LevelWarn), RouteHasKey("user")),
+			log: func(log *slog.Logger) {
+				log.Info("msg", slog.String("user", "u1"))
+			},
+			want: true,
+		},
+		{
+			name:      "否定",
+			condition: RouteNot(RouteGroup("db")),
+			log: func(log *slog.Logger) {
+				log.WithGroup("db").Info("msg")
+			},
+			want: false,
+		},
+		{
+			name: "任意の条件",
+			condition: RouteFunc(func(ctx context.Context, r slog.Record) bool {
+				return r.Message == "msg"
+			}),
+			log: func(log *slog.Logger) {
+				log.Info("msg")
+			},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			log := slog.New(NewRouter(WithRoute(tt.condition, NewTextHandler(WithWriter(buf)))))
+			tt.log(log)
+			require.Equal(t, tt.want, buf.Len() > 0, buf.String())
+		})
+	}
+}
+
+func TestRouterEnabled(t *testing.T) {
+	ctx := context.Background()
+	h := NewRouter(
+		WithRoute(RouteLevel(slog.LevelError), &mockHandler{enabled: true}),
+		WithRoute(RouteHasKey("user"), &mockHandler{enabled: false}),
+	)
+	// レベルだけで一致しないルートは判定しない
+	require.True(t, h.Enabled(ctx, slog.LevelError))
+	require.False(t, h.Enabled(ctx, slog.LevelInfo))
+
+	h = NewRouter(
+		WithRoute(RouteHasKey("user"), &mockHandler{enabled: true}),
+	)
+	require.True(t, h.Enabled(ctx, slog.LevelInfo))
+
+	// ルートがなければ出力しない
+	require.False(t, NewRouter().Enabled(ctx, slog.LevelError))
+	require.NoError(t, slog.New(NewRouter()).Handler().Handle(ctx, newTestRecord(slog.LevelError, "msg")))
+}
+
+func TestRouterHandleError(t *testing.T) {
+	errA, errB := errors.New("a"), errors.New("b")
+	h := NewRouter(
+		WithRouteMode(RouteAllMatch),
+		WithRoute(RouteLevel(slog.LevelInfo), &mockHandler{enabled: true, handleErr: errA}),
+		WithRoute(RouteLevel(slog.LevelInfo), &mockHandler{enabled: true, handleErr: errB}),
+	)
+	err := h.Handle(context.Background(), newTestRecord(slog.LevelInfo, "msg"))
+	require.ErrorIs(t, err, errA)
+	require.ErrorIs(t, err, errB)
+}
+
+func TestRouterClose(t *testing.T) {
+	count := 0
+	shared := &mockCloseHandler{closeFn: func() error {
+		count++
+		return nil
+	}}
+	h := NewRouter(
+		WithRoute(RouteLevel(slog.LevelError), shared),
+		WithDefaultRoute(shared),
+	)
+	// 同じハンドラーは1度だけ閉じる
+	require.NoError(t, h.Close())
+	require.Equal(t, 1, count)
+}
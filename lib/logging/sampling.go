@@ -0,0 +1,243 @@
+package logging
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+type SamplingOption interface {
+	apply(opt *samplingOption)
+}
+
+type samplingOptionFn func(opt *samplingOption)
+
+func (fn samplingOptionFn) apply(opt *samplingOption) {
+	fn(opt)
+}
+
+type rateLimit struct {
+	rate  float64
+	burst int
+}
+
+// defaultSamplingTick は期間を区切る間隔のデフォルト
+const defaultSamplingTick = time.Second
+
+type samplingOption struct {
+	tick       time.Duration
+	first      uint64
+	thereafter uint64
+	rateLimits map[slog.Level]rateLimit
+}
+
+// WithSampling はtick毎に同じレベルとメッセージのレコードを最初のfirst件出力し、以降はthereafter件毎に1件出力する
+// thereafterが0の場合、first件を超えたレコードは次のtickまで出力しない
+// tickが0以下の場合はデフォルトの1秒を使う
+func WithSampling(tick time.Duration, first, thereafter uint64) SamplingOption {
+	return samplingOptionFn(func(opt *samplingOption) {
+		opt.tick = tick
+		opt.first = first
+		opt.thereafter = thereafter
+	})
+}
+
+// WithRateLimit はレベル毎に1秒あたりrate件、最大burst件までに出力を制限する
+func WithRateLimit(level slog.Level, rate float64, burst int) SamplingOption {
+	return samplingOptionFn(func(opt *samplingOption) {
+		opt.rateLimits[level] = rateLimit{rate: rate, burst: burst}
+	})
+}
+
+// WithSummaryInterval は抑制したレコードの件数を出力する間隔を指定する
+// WithSamplingを指定した場合はそのtickが使われる。0以下の場合はデフォルトの1秒を使う
+func WithSummaryInterval(interval time.Duration) SamplingOption {
+	return samplingOptionFn(func(opt *samplingOption) {
+		opt.tick = interval
+	})
+}
+
+type samplingKey struct {
+	level   slog.Level
+	message string
+}
+
+type samplingCounter struct {
+	count      uint64
+	suppressed uint64
+	handler    slog.Handler
+}
+
+type tokenBucket struct {
+	limit  rateLimit
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) take(now time.Time) bool {
+	if b.last.IsZero() {
+		b.tokens = float64(b.limit.burst)
+	} else {
+		b.tokens = min(float64(b.limit.burst), b.tokens+now.Sub(b.last).Seconds()*b.limit.rate)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+type sampler struct {
+	option samplingOption
+	now    func() time.Time
+
+	mu       sync.Mutex
+	counters map[samplingKey]*samplingCounter
+	buckets  map[slog.Level]*tokenBucket
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (s *sampler) allow(h slog.Handler, r slog.Record) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := samplingKey{level: r.Level, message: r.Message}
+	c, ok := s.counters[key]
+	if !ok {
+		c = &samplingCounter{}
+		s.counters[key] = c
+	}
+	c.count++
+
+	allowed := true
+	if s.option.first > 0 && c.count > s.option.first {
+		allowed = s.option.thereafter > 0 && (c.count-s.option.first)%s.option.thereafter == 0
+	}
+	if b, ok := s.buckets[r.Level]; ok && allowed {
+		allowed = b.take(s.now())
+	}
+	if !allowed {
+		c.suppressed++
+		c.handler = h
+	}
+	return allowed
+}
+
+func (s *sampler) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.option.tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// flush は期間を区切り、抑制したレコードの件数をメッセージ毎に1件のレコードとして出力する
+func (s *sampler) flush() {
+	s.mu.Lock()
+	counters := s.counters
+	s.counters = map[samplingKey]*samplingCounter{}
+	s.mu.Unlock()
+
+	keys := make([]samplingKey, 0, len(counters))
+	for key, c := range counters {
+		if c.suppressed > 0 {
+			keys = append(keys, key)
+		}
+	}
+	slices.SortFunc(keys, func(a, b samplingKey) int {
+		return cmp.Or(cmp.Compare(a.level, b.level), cmp.Compare(a.message, b.message))
+	})
+	now := s.now()
+	for _, key := range keys {
+		c := counters[key]
+		r := slog.NewRecord(now, key.level, fmt.Sprintf("suppressed %d similar records", c.suppressed), 0)
+		r.AddAttrs(
+			slog.String("sampled_msg", key.message),
+			slog.Uint64("suppressed", c.suppressed),
+		)
+		_ = c.handler.Handle(context.Background(), r)
+	}
+}
+
+func (s *sampler) close() {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.done
+		s.flush()
+	})
+}
+
+type samplingHandler struct {
+	slog.Handler
+	sampler *sampler
+}
+
+var (
+	_ Handle = (*samplingHandler)(nil)
+)
+
+// NewSamplingHandler はサンプリングとレート制限で出力するレコードを間引く
+// 間引いたレコードの件数は期間の終わりとClose時にまとめて出力する
+func NewSamplingHandler(handler slog.Handler, opts ...SamplingOption) Handle {
+	o := samplingOption{
+		tick:       defaultSamplingTick,
+		rateLimits: map[slog.Level]rateLimit{},
+	}
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+	// 期間を区切らないとメッセージ毎のカウンターが増え続けるため、0以下はデフォルトを使う
+	if o.tick <= 0 {
+		o.tick = defaultSamplingTick
+	}
+	s := &sampler{
+		option:   o,
+		now:      time.Now,
+		counters: map[samplingKey]*samplingCounter{},
+		buckets:  map[slog.Level]*tokenBucket{},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for level, limit := range o.rateLimits {
+		s.buckets[level] = &tokenBucket{limit: limit}
+	}
+	go s.run()
+	return &samplingHandler{Handler: handler, sampler: s}
+}
+
+func (h *samplingHandler) Handle(ctx context.Context, record slog.Record) error {
+	if !h.sampler.allow(h.Handler, record) {
+		return nil
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &samplingHandler{Handler: h.Handler.WithAttrs(attrs), sampler: h.sampler}
+}
+
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	return &samplingHandler{Handler: h.Handler.WithGroup(name), sampler: h.sampler}
+}
+
+func (h *samplingHandler) Close() error {
+	h.sampler.close()
+	if v, ok := h.Handler.(io.Closer); ok {
+		return v.Close()
+	}
+	return nil
+}
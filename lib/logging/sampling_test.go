@@ -0,0 +1,121 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func countLines(s, substr string) int {
+	n := 0
+	for _, line := range strings.Split(s, "\n") {
+		if strings.Contains(line, substr) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSamplingHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	h := NewSamplingHandler(NewTextHandler(WithWriter(buf)), WithSampling(time.Hour, 3, 10)).(*samplingHandler)
+	log := slog.New(h)
+
+	for range 25 {
+		log.Info("hot loop")
+	}
+	log.Info("other message")
+	// 最初の3件と、以降10件毎の1件が出力される
+	require.Equal(t, 5, countLines(buf.String(), " msg=\"hot loop\""))
+	require.Equal(t, 1, countLines(buf.String(), " msg=\"other message\""))
+
+	// 期間の終わりに抑制した件数が出力される
+	h.sampler.flush()
+	require.Contains(t, buf.String(), "msg=\"suppressed 20 similar records\" sampled_msg=\"hot loop\" suppressed=20")
+	require.NotContains(t, buf.String(), "sampled_msg=\"other message\"")
+
+	// 次の期間は再び最初の3件が出力される
+	buf.Reset()
+	for range 3 {
+		log.Info("hot loop")
+	}
+	require.Equal(t, 3, countLines(buf.String(), " msg=\"hot loop\""))
+	require.NoError(t, h.Close())
+	require.NotContains(t, buf.String(), "suppressed")
+}
+
+func TestSamplingHandlerRateLimit(t *testing.T) {
+	buf := &bytes.Buffer{}
+	clock := newFakeClock()
+	h := NewSamplingHandler(NewTextHandler(WithWriter(buf)), WithRateLimit(slog.LevelError, 1, 2), WithSummaryInterval(time.Hour)).(*samplingHandler)
+	h.sampler.now = clock.Now
+	log := slog.New(h)
+
+	for range 5 {
+		log.Error("error storm")
+	}
+	// レート制限のないレベルは制限されない
+	for range 5 {
+		log.Info("info message")
+	}
+	require.Equal(t, 2, countLines(buf.String(), " msg=\"error storm\""))
+	require.Equal(t, 5, countLines(buf.String(), " msg=\"info message\""))
+
+	// 1秒経過するとトークンが1つ補充される
+	clock.Add(time.Second)
+	log.Error("error storm")
+	log.Error("error storm")
+	require.Equal(t, 3, countLines(buf.String(), " msg=\"error storm\""))
+
+	// Close時に抑制した件数が出力される
+	require.NoError(t, h.Close())
+	require.Contains(t, buf.String(), "level=ERROR msg=\"suppressed 4 similar records\" sampled_msg=\"error storm\" suppressed=4")
+}
+
+func TestSamplingHandlerSummaryInterval(t *testing.T) {
+	buf := &syncBuffer{}
+	h := NewSamplingHandler(
+		NewTextHandler(WithWriter(buf)),
+		WithSampling(time.Hour, 1, 0),
+		WithSummaryInterval(10*time.Millisecond),
+	)
+	log := slog.New(h)
+	log.Warn("repeated")
+	log.Warn("repeated")
+
+	require.Eventually(t, func() bool {
+		return strings.Contains(buf.String(), "suppressed 1 similar records")
+	}, time.Second, 10*time.Millisecond)
+	require.NoError(t, h.Close())
+}
+
+func TestSamplingHandlerDefaultTick(t *testing.T) {
+	// 0以下の間隔はデフォルトを使い、カウンターを定期的にリセットする
+	for _, opt := range []SamplingOption{WithSampling(0, 1, 0), WithSummaryInterval(-time.Second)} {
+		h := NewSamplingHandler(NewTextHandler(WithWriter(&syncBuffer{})), opt).(*samplingHandler)
+		require.Equal(t, defaultSamplingTick, h.sampler.option.tick)
+		require.NoError(t, h.Close())
+	}
+}
+
+func TestSamplingHandlerWithErrorTracking(t *testing.T) {
+	buf1 := &bytes.Buffer{}
+	buf2 := &bytes.Buffer{}
+	tracking := NewErrorTracking(slog.NewTextHandler(buf2, &slog.HandlerOptions{}))
+	h := NewSamplingHandler(NewHandler(NewTextHandler(WithWriter(buf1)), tracking), WithSampling(time.Hour, 1, 0))
+	log := slog.New(h).With(slog.String("component", "test"))
+	for range 3 {
+		log.ErrorContext(context.Background(), "tracked error")
+	}
+	require.NoError(t, h.Close())
+
+	for _, output := range []string{buf1.String(), buf2.String()} {
+		require.Equal(t, 1, countLines(output, " msg=\"tracked error\""))
+		require.Contains(t, output, "component=test sampled_msg=\"tracked error\" suppressed=2")
+	}
+}
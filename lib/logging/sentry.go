@@ -1,22 +1,38 @@
 package logging
 
 import (
+	"context"
+	"io"
 	"log/slog"
-	"strings"
+	"time"
 
 	"github.com/getsentry/sentry-go"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	slogsentry "github.com/samber/slog-sentry/v2"
 )
 
+const (
+	defaultSentryFlushTimeout = 2 * time.Second
+)
+
 type SentryConfig struct {
-	Level          string           `yaml:"level" default:"warn"`
-	DSN            string           `yaml:"dsn"`
-	SampleRate     float64          `yaml:"sampleRate" default:"1.0"`
-	IgnoreErrors   []string         `yaml:"ignoreErrors"`
-	SendDefaultPII bool             `yaml:"sendDefaultPII"`
-	Env            string           `yaml:"env"`
-	Transport      sentry.Transport `yaml:"-"`
+	// Level はイベントとして送信するレベル。nilのときはWARN
+	Level            *Level        `yaml:"level" default:"warn"`
+	DSN              string        `yaml:"dsn"`
+	SampleRate       float64       `yaml:"sampleRate" default:"1.0"`
+	IgnoreErrors     []string      `yaml:"ignoreErrors"`
+	SendDefaultPII   bool          `yaml:"sendDefaultPII"`
+	Env              string        `yaml:"env"`
+	Release          string        `yaml:"release"`
+	Debug            bool          `yaml:"debug"`
+	EnableTracing    bool          `yaml:"enableTracing"`
+	TracesSampleRate float64       `yaml:"tracesSampleRate"`
+	MaxBreadcrumbs   int           `yaml:"maxBreadcrumbs"`
+	FlushTimeout     time.Duration `yaml:"flushTimeout" default:"2s"`
+	// NormalizeMessage を有効にするとFingerprintがないイベントを正規化したメッセージでまとめる
+	NormalizeMessage  bool              `yaml:"normalizeMessage"`
+	MessageNormalizer MessageNormalizer `yaml:"-"`
+	Transport         sentry.Transport  `yaml:"-"`
 }
 
 func (c SentryConfig) Validate() error {
@@ -30,37 +46,296 @@ func (c *SentryConfig) SentryOptions(environment string) sentry.ClientOptions {
 		environment = c.Env
 	}
 	return sentry.ClientOptions{
-		Dsn:            c.DSN,
-		IgnoreErrors:   c.IgnoreErrors,
-		Environment:    environment,
-		SampleRate:     c.SampleRate,
-		SendDefaultPII: c.SendDefaultPII,
-		Transport:      c.Transport,
+		Dsn:              c.DSN,
+		IgnoreErrors:     c.IgnoreErrors,
+		Environment:      environment,
+		Release:          c.Release,
+		Debug:            c.Debug,
+		SampleRate:       c.SampleRate,
+		EnableTracing:    c.EnableTracing,
+		TracesSampleRate: c.TracesSampleRate,
+		MaxBreadcrumbs:   c.MaxBreadcrumbs,
+		SendDefaultPII:   c.SendDefaultPII,
+		Transport:        c.Transport,
 	}
 }
 
+// getLevel は未指定のときにタグと同じWARNを返す
 func (c *SentryConfig) getLevel() slog.Level {
-	switch strings.ToLower(c.Level) {
-	case "debug":
-		return slog.LevelDebug
-	case "info":
-		return slog.LevelInfo
-	case "warn", "warning":
-		return slog.LevelWarn
-	case "err", "error":
-		return slog.LevelError
-	default:
-		return slog.LevelInfo
+	return levelOr(c.Level, slog.LevelWarn)
+}
+
+func (c *SentryConfig) normalizer() MessageNormalizer {
+	if c.MessageNormalizer != nil {
+		return c.MessageNormalizer
+	}
+	if c.NormalizeMessage {
+		return DefaultMessageNormalizer
+	}
+	return nil
+}
+
+func (c *SentryConfig) flushTimeout() time.Duration {
+	if c.FlushTimeout <= 0 {
+		return defaultSentryFlushTimeout
+	}
+	return c.FlushTimeout
+}
+
+type SentryOption interface {
+	apply(opt *sentryOption)
+}
+
+type sentryOptionFn func(opt *sentryOption)
+
+func (fn sentryOptionFn) apply(opt *sentryOption) {
+	fn(opt)
+}
+
+type sentryOption struct {
+	breadcrumbLevel slog.Leveler
+	userFn          func(ctx context.Context) (sentry.User, bool)
+	requestIDKey    string
+	tracking        []ErrorTrackingOption
+}
+
+// WithSentryBreadcrumbLevel はイベントのレベル未満でこのレベル以上のレコードをパンくずとして記録する
+// パンくずはリクエスト毎のスコープに記録し、同じリクエストで次に送信するイベントに添付する。デフォルトはINFO
+// スコープはWithSentryScope、またはsentryhttpなどでコンテキストに設定されたHubのものを使う
+func WithSentryBreadcrumbLevel(level slog.Leveler) SentryOption {
+	return sentryOptionFn(func(opt *sentryOption) {
+		opt.breadcrumbLevel = level
+	})
+}
+
+// WithSentryUser はコンテキストからイベントのユーザーを取得する関数を指定する
+//
+//	logging.WithSentryUser(func(ctx context.Context) (sentry.User, bool) {
+//		info, ok := auth.AuthFromContext[TokenInfo](ctx)
+//		if !ok {
+//			return sentry.User{}, false
+//		}
+//		return sentry.User{ID: info.Subject}, true
+//	})
+func WithSentryUser(fn func(ctx context.Context) (sentry.User, bool)) SentryOption {
+	return sentryOptionFn(func(opt *sentryOption) {
+		opt.userFn = fn
+	})
+}
+
+// WithSentryRequestIDKey はAppendCtxで追加された属性のうち、request_idタグにするキーを指定する
+// デフォルトは "request-id"
+func WithSentryRequestIDKey(key string) SentryOption {
+	return sentryOptionFn(func(opt *sentryOption) {
+		opt.requestIDKey = key
+	})
+}
+
+// WithSentryErrorTracking は送信しないエラーの条件を指定する
+//
+//	logging.WithSentryErrorTracking(
+//		logging.WithIgnoreErrors(context.Canceled),
+//		logging.WithIgnoreConnectCodes(connect.CodeNotFound),
+//	)
+func WithSentryErrorTracking(opts ...ErrorTrackingOption) SentryOption {
+	return sentryOptionFn(func(opt *sentryOption) {
+		opt.tracking = append(opt.tracking, opts...)
+	})
+}
+
+type sentryScopeKey struct{}
+
+// WithSentryScope はリクエスト毎にパンくずを記録するスコープをコンテキストに設定する
+// コンテキストに既にスコープかHubがあればそのまま返す
+func WithSentryScope(ctx context.Context) context.Context {
+	if sentryScope(ctx) != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, sentryScopeKey{}, sentry.NewScope())
+}
+
+// sentryScope はコンテキストのHubのスコープ、なければWithSentryScopeのスコープを返す
+func sentryScope(ctx context.Context) *sentry.Scope {
+	if hub := sentry.GetHubFromContext(ctx); hub != nil {
+		return hub.Scope()
+	}
+	scope, _ := ctx.Value(sentryScopeKey{}).(*sentry.Scope)
+	return scope
+}
+
+type sentryHandler struct {
+	slog.Handler
+	hub          *sentry.Hub
+	level        slog.Level
+	option       *sentryOption
+	flushTimeout time.Duration
+}
+
+var (
+	_ Handle = (*sentryHandler)(nil)
+)
+
+// NewSentryHandler はハンドラー毎にSentryのクライアントとHubを作成する
+// グローバルのHubは変更しない。イベントは非同期に送信し、パンくずは呼び出し元で記録する
+func NewSentryHandler(conf *SentryConfig, environment string, opts ...SentryOption) (Handle, error) {
+	o := &sentryOption{
+		breadcrumbLevel: slog.LevelInfo,
+		requestIDKey:    "request-id",
+	}
+	for _, opt := range opts {
+		opt.apply(o)
+	}
+	client, err := sentry.NewClient(conf.SentryOptions(environment))
+	if err != nil {
+		return nil, err
+	}
+	hub := sentry.NewHub(client, sentry.NewScope())
+
+	h := &sentryHandler{
+		hub:          hub,
+		level:        conf.getLevel(),
+		option:       o,
+		flushTimeout: conf.flushTimeout(),
+	}
+	h.Handler = NewAsyncHandler(slogsentry.Option{
+		Level:           h.level,
+		Hub:             hub,
+		Converter:       sentryConverter,
+		AttrFromContext: []func(ctx context.Context) []slog.Attr{h.contextAttrs},
+		BeforeSend:      sentryFingerprint(conf.normalizer()),
+	}.NewSentryHandler())
+	return NewErrorTracking(h, o.tracking...), nil
+}
+
+func (h *sentryHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if level >= h.level {
+		return true
 	}
+	return level >= h.option.breadcrumbLevel.Level() && sentryScope(ctx) != nil
 }
 
-func NewSentryHandler(conf *SentryConfig, environment string) Handle {
-	if err := sentry.Init(conf.SentryOptions(environment)); err != nil {
-		slog.Error("Sentry initialize")
+func (h *sentryHandler) Handle(ctx context.Context, record slog.Record) error {
+	scope := sentryScope(ctx)
+	if record.Level < h.level {
+		// パンくずはキューに積まずに記録し、イベントがキューから溢れないようにする
+		if scope != nil && record.Level >= h.option.breadcrumbLevel.Level() {
+			// クライアントのMaxBreadcrumbsとBeforeBreadcrumbを適用する
+			sentry.NewHub(h.hub.Client(), scope).AddBreadcrumb(sentryBreadcrumb(record), nil)
+		}
+		return nil
+	}
+	// コンテキストのHubのクライアントではなく、このハンドラーのクライアントで送信する
+	hub := h.hub
+	if scope != nil {
+		// 非同期に送信するためスコープを複製し、パンくずはこのイベントにだけ添付する
+		hub = sentry.NewHub(h.hub.Client(), scope.Clone())
+		scope.ClearBreadcrumbs()
 	}
+	return h.Handler.Handle(sentry.SetHubOnContext(ctx, hub), record)
+}
 
-	option := slogsentry.Option{
-		Level: conf.getLevel(),
+// contextAttrs はユーザーとリクエストIDをslog-sentryが解釈する属性にする
+func (h *sentryHandler) contextAttrs(ctx context.Context) []slog.Attr {
+	var attrs []slog.Attr
+	if h.option.userFn != nil {
+		if user, ok := h.option.userFn(ctx); ok {
+			attrs = append(attrs, slog.Group("user",
+				slog.String("id", user.ID),
+				slog.String("email", user.Email),
+				slog.String("username", user.Username),
+				slog.String("ip_address", user.IPAddress),
+				slog.String("name", user.Name),
+			))
+		}
+	}
+	for _, a := range AttrsFromContext(ctx) {
+		if a.Key == h.option.requestIDKey {
+			attrs = append(attrs, slog.Group("tags", slog.String("request_id", a.Value.String())))
+			break
+		}
+	}
+	return attrs
+}
+
+func (h *sentryHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &sentryHandler{
+		Handler:      h.Handler.WithAttrs(attrs),
+		hub:          h.hub,
+		level:        h.level,
+		option:       h.option,
+		flushTimeout: h.flushTimeout,
+	}
+}
+
+func (h *sentryHandler) WithGroup(name string) slog.Handler {
+	return &sentryHandler{
+		Handler:      h.Handler.WithGroup(name),
+		hub:          h.hub,
+		level:        h.level,
+		option:       h.option,
+		flushTimeout: h.flushTimeout,
+	}
+}
+
+// Close はキューのイベントを処理し、送信待ちのイベントをFlushTimeoutまで待って送信してクライアントを閉じる
+func (h *sentryHandler) Close() error {
+	var err error
+	if v, ok := h.Handler.(io.Closer); ok {
+		err = v.Close()
+	}
+	h.hub.Flush(h.flushTimeout)
+	h.hub.Client().Close()
+	return err
+}
+
+// sentryConverter はslog-sentryが変換できないTRACEやFATALなどのレベルも変換する
+func sentryConverter(addSource bool, replaceAttr func(groups []string, a slog.Attr) slog.Attr, loggerAttr []slog.Attr, groups []string, record *slog.Record, hub *sentry.Hub) *sentry.Event {
+	event := slogsentry.DefaultConverter(addSource, replaceAttr, loggerAttr, groups, record, hub)
+	event.Level = sentryLevel(record.Level)
+	return event
+}
+
+// sentryFingerprint はFingerprintが指定されていないイベントを正規化したメッセージでまとめる
+// Fingerprintの属性はslog-sentryがevent.Fingerprintに変換する
+func sentryFingerprint(normalize MessageNormalizer) func(event *sentry.Event) *sentry.Event {
+	return func(event *sentry.Event) *sentry.Event {
+		if normalize != nil && len(event.Fingerprint) == 0 {
+			event.Fingerprint = []string{normalize(event.Message)}
+		}
+		return event
+	}
+}
+
+func sentryBreadcrumb(record slog.Record) *sentry.Breadcrumb {
+	var data map[string]any
+	if record.NumAttrs() > 0 {
+		data = make(map[string]any, record.NumAttrs())
+		record.Attrs(func(a slog.Attr) bool {
+			data[a.Key] = a.Value.Resolve().Any()
+			return true
+		})
+	}
+	return &sentry.Breadcrumb{
+		Type:      "default",
+		Category:  "log",
+		Message:   record.Message,
+		Data:      data,
+		Level:     sentryLevel(record.Level),
+		Timestamp: record.Time,
+	}
+}
+
+func sentryLevel(level slog.Level) sentry.Level {
+	switch {
+	case level < slog.LevelInfo:
+		return sentry.LevelDebug
+	case level < slog.LevelWarn:
+		return sentry.LevelInfo
+	case level < slog.LevelError:
+		return sentry.LevelWarning
+	case level < LevelFatal:
+		return sentry.LevelError
+	default:
+		return sentry.LevelFatal
 	}
-	return NewErrorTracking(NewAsyncHandler(option.NewSentryHandler()))
 }
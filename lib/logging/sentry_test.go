@@ -1,6 +1,8 @@
 package logging
 
 import (
+	"context"
+	"errors"
 	"log/slog"
 	"sync"
 	"testing"
@@ -14,6 +16,7 @@ type TransportMock struct {
 	mu        sync.Mutex
 	events    []*originalsentry.Event
 	lastEvent *originalsentry.Event
+	flushed   int
 }
 
 func (t *TransportMock) Configure(options originalsentry.ClientOptions) {}
@@ -24,6 +27,15 @@ func (t *TransportMock) SendEvent(event *originalsentry.Event) {
 	t.lastEvent = event
 }
 func (t *TransportMock) Flush(timeout time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.flushed++
+	return true
+}
+func (t *TransportMock) FlushWithContext(ctx context.Context) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.flushed++
 	return true
 }
 func (t *TransportMock) Events() []*originalsentry.Event {
@@ -40,12 +52,208 @@ func TestSentry(t *testing.T) {
 		require.Len(transport.events, 1)
 	}()
 	conf := SentryConfig{
-		Level:     "ERROR",
+		Level:     NewLevel(slog.LevelError),
 		Transport: transport,
 	}
-	h := NewSentryHandler(&conf, "test")
+	h, err := NewSentryHandler(&conf, "test")
+	require.NoError(err)
 	defer h.Close()
 	log := slog.New(h)
 	slog.SetDefault(log)
 	slog.Error("This is test")
 }
+
+func TestSentryInitError(t *testing.T) {
+	h, err := NewSentryHandler(&SentryConfig{DSN: "invalid-dsn"}, "test")
+	require.Error(t, err)
+	require.Nil(t, h)
+}
+
+func TestSentryHandlerHub(t *testing.T) {
+	transport := &TransportMock{}
+	h, err := NewSentryHandler(&SentryConfig{Level: NewLevel(slog.LevelError), Transport: transport}, "test")
+	require.NoError(t, err)
+
+	// グローバルのHubは変更しない
+	require.Nil(t, originalsentry.CurrentHub().Client())
+
+	slog.New(h).Error("dedicated hub")
+	require.NoError(t, h.Close())
+	require.Len(t, transport.Events(), 1)
+	require.Equal(t, "test", transport.Events()[0].Environment)
+	// Closeで送信待ちのイベントを送信する
+	require.Equal(t, 1, transport.flushed)
+}
+
+func TestSentryHandlerErrorTracking(t *testing.T) {
+	transport := &TransportMock{}
+	h, err := NewSentryHandler(&SentryConfig{Level: NewLevel(slog.LevelError), Transport: transport}, "test",
+		WithSentryErrorTracking(WithIgnoreErrors(context.Canceled)),
+	)
+	require.NoError(t, err)
+
+	log := slog.New(h)
+	log.Error("canceled", slog.Any("error", context.Canceled))
+	log.Error("failed", slog.Any("error", errors.New("boom")))
+	require.NoError(t, h.Close())
+	require.Len(t, transport.Events(), 1)
+	require.Equal(t, "failed", transport.Events()[0].Message)
+}
+
+func TestSentryHandlerCustomLevels(t *testing.T) {
+	transport := &TransportMock{}
+	h, err := NewSentryHandler(&SentryConfig{Level: NewLevel(slog.LevelError), Transport: transport}, "test")
+	require.NoError(t, err)
+
+	log := slog.New(h)
+	log.Log(t.Context(), LevelFatal, "fatal")
+	log.Log(t.Context(), slog.LevelError+1, "error+1")
+	require.NoError(t, h.Close())
+
+	// slog-sentryの変換表にないレベルも変換する
+	events := transport.Events()
+	require.Len(t, events, 2)
+	require.Equal(t, originalsentry.LevelFatal, events[0].Level)
+	require.Equal(t, originalsentry.LevelError, events[1].Level)
+}
+
+func TestSentryHandlerBreadcrumbs(t *testing.T) {
+	transport := &TransportMock{}
+	h, err := NewSentryHandler(&SentryConfig{Level: NewLevel(slog.LevelError), Transport: transport}, "test")
+	require.NoError(t, err)
+
+	ctx := WithSentryScope(context.Background())
+	log := slog.New(h)
+	log.DebugContext(ctx, "debug message")
+	log.InfoContext(ctx, "step 1", slog.String("key", "value"))
+	log.WarnContext(ctx, "step 2")
+	log.ErrorContext(ctx, "first error")
+	log.ErrorContext(ctx, "second error")
+	require.NoError(t, h.Close())
+
+	events := transport.Events()
+	require.Len(t, events, 2)
+
+	// イベントのレベル未満のレコードは次のイベントに添付する
+	breadcrumbs := events[0].Breadcrumbs
+	require.Len(t, breadcrumbs, 2)
+	require.Equal(t, "step 1", breadcrumbs[0].Message)
+	require.Equal(t, originalsentry.LevelInfo, breadcrumbs[0].Level)
+	require.Equal(t, map[string]any{"key": "value"}, breadcrumbs[0].Data)
+	require.Equal(t, "step 2", breadcrumbs[1].Message)
+	require.Equal(t, originalsentry.LevelWarning, breadcrumbs[1].Level)
+
+	// 添付したパンくずは次のイベントには添付しない
+	require.Empty(t, events[1].Breadcrumbs)
+}
+
+func TestSentryHandlerBreadcrumbsPerRequest(t *testing.T) {
+	transport := &TransportMock{}
+	h, err := NewSentryHandler(&SentryConfig{Level: NewLevel(slog.LevelError), Transport: transport}, "test")
+	require.NoError(t, err)
+
+	log := slog.New(h)
+	ctx1 := WithSentryScope(context.Background())
+	ctx2 := WithSentryScope(context.Background())
+	// スコープが設定済みであれば同じものを使う
+	require.Equal(t, ctx1, WithSentryScope(ctx1))
+	// スコープがなければパンくずを記録しない
+	require.False(t, h.Enabled(context.Background(), slog.LevelInfo))
+	require.True(t, h.Enabled(ctx1, slog.LevelInfo))
+
+	log.InfoContext(ctx1, "request 1")
+	log.InfoContext(ctx2, "request 2")
+	log.Info("without scope")
+	log.ErrorContext(ctx2, "request 2 failed")
+	log.Error("failed without scope")
+	require.NoError(t, h.Close())
+
+	// 他のリクエストのパンくずは添付しない
+	events := transport.Events()
+	require.Len(t, events, 2)
+	require.Len(t, events[0].Breadcrumbs, 1)
+	require.Equal(t, "request 2", events[0].Breadcrumbs[0].Message)
+	require.Empty(t, events[1].Breadcrumbs)
+}
+
+func TestSentryHandlerContextHub(t *testing.T) {
+	transport := &TransportMock{}
+	h, err := NewSentryHandler(&SentryConfig{Level: NewLevel(slog.LevelError), Transport: transport}, "test")
+	require.NoError(t, err)
+
+	// sentryhttpなどが設定したHubはスコープだけ使い、このハンドラーのクライアントで送信する
+	other := &TransportMock{}
+	client, err := originalsentry.NewClient(originalsentry.ClientOptions{Transport: other})
+	require.NoError(t, err)
+	hub := originalsentry.NewHub(client, originalsentry.NewScope())
+	hub.Scope().SetTag("route", "/users")
+	ctx := originalsentry.SetHubOnContext(context.Background(), hub)
+
+	log := slog.New(h)
+	log.InfoContext(ctx, "step")
+	log.ErrorContext(ctx, "failed")
+	require.NoError(t, h.Close())
+
+	require.Empty(t, other.Events())
+	events := transport.Events()
+	require.Len(t, events, 1)
+	require.Equal(t, "/users", events[0].Tags["route"])
+	require.Len(t, events[0].Breadcrumbs, 1)
+	require.Equal(t, 1, transport.flushed)
+	// 添付したパンくずはコンテキストのスコープから消す
+	event := hub.Scope().ApplyToEvent(&originalsentry.Event{}, nil, nil)
+	require.Empty(t, event.Breadcrumbs)
+}
+
+func TestSentryHandlerContext(t *testing.T) {
+	type tokenInfo struct {
+		subject string
+	}
+	type tokenInfoKey struct{}
+
+	transport := &TransportMock{}
+	h, err := NewSentryHandler(&SentryConfig{Level: NewLevel(slog.LevelError), Transport: transport}, "test",
+		WithSentryUser(func(ctx context.Context) (originalsentry.User, bool) {
+			info, ok := ctx.Value(tokenInfoKey{}).(*tokenInfo)
+			if !ok {
+				return originalsentry.User{}, false
+			}
+			return originalsentry.User{ID: info.subject}, true
+		}),
+	)
+	require.NoError(t, err)
+
+	ctx := context.WithValue(context.Background(), tokenInfoKey{}, &tokenInfo{subject: "user-1"})
+	ctx = AppendCtx(ctx, slog.String("request-id", "req-1"))
+	log := slog.New(h)
+	log.ErrorContext(ctx, "with context")
+	log.Error("without context")
+	require.NoError(t, h.Close())
+
+	// 認証情報とリクエストIDをイベントに付与する
+	events := transport.Events()
+	require.Len(t, events, 2)
+	require.Equal(t, "user-1", events[0].User.ID)
+	require.Equal(t, "req-1", events[0].Tags["request_id"])
+	require.Empty(t, events[1].User.ID)
+	require.NotContains(t, events[1].Tags, "request_id")
+}
+
+func TestSentryHandlerFingerprint(t *testing.T) {
+	transport := &TransportMock{}
+	conf := &SentryConfig{Level: NewLevel(slog.LevelError), NormalizeMessage: true, Transport: transport}
+	h, err := NewSentryHandler(conf, "test")
+	require.NoError(t, err)
+
+	log := slog.New(h)
+	log.Error("user 42 not found", Fingerprint("user-not-found"))
+	log.Error("order 12345 failed")
+	require.NoError(t, h.Close())
+
+	events := transport.Events()
+	require.Len(t, events, 2)
+	// Fingerprintの属性を優先する
+	require.Equal(t, []string{"user-not-found"}, events[0].Fingerprint)
+	// 指定がなければ正規化したメッセージでまとめる
+	require.Equal(t, []string{"order <num> failed"}, events[1].Fingerprint)
+}
@@ -12,10 +12,12 @@ const (
 	SentryHandler  = LoggingHandle("sentry")
 	RollbarHandler = LoggingHandle("rollbar")
 	DatadogHandler = LoggingHandle("datadog")
+	OTLPHandler    = LoggingHandle("otlp")
+	ConsoleHandler = LoggingHandle("console")
 )
 
 var (
-	LoggingHandlers = []LoggingHandle{JsonHandler, TextHandler, SentryHandler, RollbarHandler, DatadogHandler}
+	LoggingHandlers = []LoggingHandle{JsonHandler, TextHandler, SentryHandler, RollbarHandler, DatadogHandler, OTLPHandler, ConsoleHandler}
 )
 
 func LoggingHandlersToInf() []any {
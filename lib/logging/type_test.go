@@ -23,6 +23,12 @@ func TestLoggingHandle(t *testing.T) {
 	handle = DatadogHandler
 	assert.Equal(t, "datadog", handle.String())
 
+	handle = OTLPHandler
+	assert.Equal(t, "otlp", handle.String())
+
+	handle = ConsoleHandler
+	assert.Equal(t, "console", handle.String())
+
 	// カスタムハンドル名のテスト
 	customHandle := LoggingHandle("custom")
 	assert.Equal(t, "custom", customHandle.String())